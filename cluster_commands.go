@@ -4,6 +4,7 @@ import "context"
 
 type ClusterCmdable interface {
 	ClusterMyShardID(ctx context.Context) *StringCmd
+	ClusterMyID(ctx context.Context) *StringCmd
 	ClusterSlots(ctx context.Context) *ClusterSlotsCmd
 	ClusterShards(ctx context.Context) *ClusterShardsCmd
 	ClusterLinks(ctx context.Context) *ClusterLinksCmd
@@ -22,9 +23,14 @@ type ClusterCmdable interface {
 	ClusterDelSlotsRange(ctx context.Context, min, max int) *StatusCmd
 	ClusterSaveConfig(ctx context.Context) *StatusCmd
 	ClusterSlaves(ctx context.Context, nodeID string) *StringSliceCmd
+	ClusterReplicas(ctx context.Context, nodeID string) *StringSliceCmd
 	ClusterFailover(ctx context.Context) *StatusCmd
 	ClusterAddSlots(ctx context.Context, slots ...int) *StatusCmd
 	ClusterAddSlotsRange(ctx context.Context, min, max int) *StatusCmd
+	ClusterSetSlotImporting(ctx context.Context, slot int, nodeID string) *StatusCmd
+	ClusterSetSlotMigrating(ctx context.Context, slot int, nodeID string) *StatusCmd
+	ClusterSetSlotNode(ctx context.Context, slot int, nodeID string) *StatusCmd
+	ClusterSetSlotStable(ctx context.Context, slot int) *StatusCmd
 	ReadOnly(ctx context.Context) *StatusCmd
 	ReadWrite(ctx context.Context) *StatusCmd
 }
@@ -35,6 +41,12 @@ func (c cmdable) ClusterMyShardID(ctx context.Context) *StringCmd {
 	return cmd
 }
 
+func (c cmdable) ClusterMyID(ctx context.Context) *StringCmd {
+	cmd := NewStringCmd(ctx, "cluster", "myid")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) ClusterSlots(ctx context.Context) *ClusterSlotsCmd {
 	cmd := NewClusterSlotsCmd(ctx, "cluster", "slots")
 	_ = c(ctx, cmd)
@@ -152,6 +164,12 @@ func (c cmdable) ClusterSlaves(ctx context.Context, nodeID string) *StringSliceC
 	return cmd
 }
 
+func (c cmdable) ClusterReplicas(ctx context.Context, nodeID string) *StringSliceCmd {
+	cmd := NewStringSliceCmd(ctx, "cluster", "replicas", nodeID)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) ClusterFailover(ctx context.Context) *StatusCmd {
 	cmd := NewStatusCmd(ctx, "cluster", "failover")
 	_ = c(ctx, cmd)
@@ -179,6 +197,36 @@ func (c cmdable) ClusterAddSlotsRange(ctx context.Context, min, max int) *Status
 	return c.ClusterAddSlots(ctx, slots...)
 }
 
+// ClusterSetSlotImporting marks the slot as being imported from the node
+// with the given ID.
+func (c cmdable) ClusterSetSlotImporting(ctx context.Context, slot int, nodeID string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "cluster", "setslot", slot, "importing", nodeID)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// ClusterSetSlotMigrating marks the slot as being migrated to the node
+// with the given ID.
+func (c cmdable) ClusterSetSlotMigrating(ctx context.Context, slot int, nodeID string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "cluster", "setslot", slot, "migrating", nodeID)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// ClusterSetSlotNode assigns the slot to the node with the given ID.
+func (c cmdable) ClusterSetSlotNode(ctx context.Context, slot int, nodeID string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "cluster", "setslot", slot, "node", nodeID)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// ClusterSetSlotStable clears the importing and migrating state of the slot.
+func (c cmdable) ClusterSetSlotStable(ctx context.Context, slot int) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "cluster", "setslot", slot, "stable")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) ReadOnly(ctx context.Context) *StatusCmd {
 	cmd := NewStatusCmd(ctx, "readonly")
 	_ = c(ctx, cmd)
@@ -518,7 +518,8 @@ func (cmd *SliceCmd) String() string {
 }
 
 // Scan scans the results from the map into a destination struct. The map keys
-// are matched in the Redis struct fields by the `redis:"field"` tag.
+// are matched in the Redis struct fields by the `redis:"field"` tag, which also
+// takes the options "omitempty", "default=value" and "layout=layout".
 func (cmd *SliceCmd) Scan(dst interface{}) error {
 	if cmd.err != nil {
 		return cmd.err
@@ -1262,7 +1263,8 @@ func (cmd *MapStringStringCmd) String() string {
 }
 
 // Scan scans the results from the map into a destination struct. The map keys
-// are matched in the Redis struct fields by the `redis:"field"` tag.
+// are matched in the Redis struct fields by the `redis:"field"` tag, which also
+// takes the options "omitempty", "default=value" and "layout=layout".
 func (cmd *MapStringStringCmd) Scan(dest interface{}) error {
 	if cmd.err != nil {
 		return cmd.err
@@ -1279,7 +1281,7 @@ func (cmd *MapStringStringCmd) Scan(dest interface{}) error {
 		}
 	}
 
-	return nil
+	return strct.ScanDefaults()
 }
 
 func (cmd *MapStringStringCmd) readReply(rd *proto.Reader) error {
@@ -1480,6 +1482,29 @@ type XMessage struct {
 	Values map[string]interface{}
 }
 
+// Scan scans the values of the message into a destination struct. The values
+// are matched in the struct fields by the `redis:"field"` tag like in
+// MapStringStringCmd.Scan, and the fields of nested structs by
+// `redis:"field.nested"`.
+func (m XMessage) Scan(dst interface{}) error {
+	strct, err := hscan.Struct(dst)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range m.Values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if err := strct.Scan(k, s); err != nil {
+			return err
+		}
+	}
+
+	return strct.ScanDefaults()
+}
+
 type XMessageSliceCmd struct {
 	baseCmd
 
@@ -9,10 +9,10 @@ import (
 	"net"
 	"reflect"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9/internal"
+	"github.com/redis/go-redis/v9/internal/hscan"
 )
 
 // KeepTTL is a Redis KEEPTTL option to keep existing TTL, it requires your redis-server version >= 6.0,
@@ -101,42 +101,239 @@ func appendArg(dst []interface{}, arg interface{}) []interface{} {
 }
 
 // appendStructField appends the field and value held by the structure v to dst, and returns the appended dst.
+// Fields of nested structs are appended as "<field>.<nested field>" and fields of embedded
+// structs without a tag are promoted, like hscan decodes them. The tag options are the
+// ones of hscan.ParseTag: nil pointers are skipped and "layout" formats time.Time fields.
+// See structFieldValue for the conversion of the values.
 func appendStructField(dst []interface{}, v reflect.Value) []interface{} {
+	return appendStructFieldPrefix(dst, v, "", map[reflect.Type]bool{v.Type(): true})
+}
+
+// appendStructFieldPrefix appends the fields of the struct with the prefix.
+// Like hscan, it doesn't follow pointers back to the struct types on
+// the path, so the values of such fields are written as they are.
+func appendStructFieldPrefix(dst []interface{}, v reflect.Value, prefix string, path map[reflect.Type]bool) []interface{} {
 	typ := v.Type()
 	for i := 0; i < typ.NumField(); i++ {
-		tag := typ.Field(i).Tag.Get("redis")
-		if tag == "" || tag == "-" {
+		f := typ.Field(i)
+		tag := f.Tag.Get("redis")
+		if tag == "-" {
 			continue
 		}
-		name, opt, _ := strings.Cut(tag, ",")
-		if name == "" {
+		opts := hscan.ParseTag(tag)
+		name := opts.Name
+
+		field := v.Field(i)
+
+		if hscan.IsNestedStruct(f.Type) && !path[indirectType(f.Type)] {
+			if name == "" && !f.Anonymous {
+				continue
+			}
+			// Skipped by hscan, like encoding/json does.
+			if name == "" && f.Type.Kind() == reflect.Pointer && !f.IsExported() {
+				continue
+			}
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			if name != "" {
+				name = prefix + name + "."
+			} else {
+				name = prefix
+			}
+			path[field.Type()] = true
+			dst = appendStructFieldPrefix(dst, field, name, path)
+			delete(path, field.Type())
 			continue
 		}
 
-		field := v.Field(i)
+		if name == "" {
+			continue
+		}
 
 		// miss field
-		if omitEmpty(opt) && isEmptyValue(field) {
+		if opts.OmitEmpty && isEmptyValue(field) {
 			continue
 		}
-
-		if field.CanInterface() {
-			dst = append(dst, name, field.Interface())
+		// nil pointers are scanned back as missing fields.
+		if field.Kind() == reflect.Pointer && field.IsNil() {
+			continue
+		}
+		if !field.CanInterface() {
+			continue
 		}
+
+		dst = append(dst, prefix+name, structFieldValue(field, opts.Layout))
 	}
 
 	return dst
 }
 
-func omitEmpty(opt string) bool {
-	for opt != "" {
-		var name string
-		name, opt, _ = strings.Cut(opt, ",")
-		if name == "omitempty" {
-			return true
+// structFieldValue returns the value of the struct field as an argument.
+// Pointers are dereferenced, encoding.TextMarshaler values are written as
+// text and the values of named basic types are converted to the basic types.
+func structFieldValue(v reflect.Value, layout string) interface{} {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if layout != "" {
+			return hscan.FormatTime(value, layout)
+		}
+		return value
+	case *time.Time:
+		if value == nil {
+			return nil
 		}
+		return structFieldValue(v.Elem(), layout)
+	case time.Duration, encoding.BinaryMarshaler, net.IP:
+		return value
+	case encoding.TextMarshaler:
+		return textMarshaler{value}
 	}
-	return false
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return structFieldValue(v.Elem(), layout)
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+// textMarshaler writes an encoding.TextMarshaler as an encoding.BinaryMarshaler,
+// so the errors of MarshalText are returned when the command is written.
+type textMarshaler struct {
+	encoding.TextMarshaler
+}
+
+func (m textMarshaler) MarshalBinary() ([]byte, error) {
+	return m.MarshalText()
+}
+
+// StructToArgsOptions select the fields returned by StructToArgs.
+type StructToArgsOptions struct {
+	// Fields limits the fields to the ones with these names, for example
+	// "name" or "home.city" for the field of a nested struct.
+	// Names that are not fields or whose value is missing are ignored.
+	Fields []string
+	// Prev is a previous value of the struct. Only the fields whose value
+	// changed are returned, so the hash can be updated partially.
+	// The fields that had a value in Prev and became missing, because
+	// they are empty with omitempty or nil pointers, are returned as
+	// removed fields.
+	Prev interface{}
+}
+
+// StructToArgs returns the field and value pairs of the struct v that HSet
+// writes, using the same `redis:"field,omitempty,layout=layout"` tags as
+// HGetAll(...).Scan. Nil pointers are skipped and encoding.TextMarshaler
+// values are written as text. The options may be nil.
+//
+// With opt.Prev, the names of the fields that must be deleted with HDel,
+// so they are scanned back as missing, are returned as removed.
+func StructToArgs(v interface{}, opt *StructToArgsOptions) (args []interface{}, removed []string, err error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = appendStructField(nil, rv)
+	if opt == nil {
+		return args, nil, nil
+	}
+
+	selected := func(name string) bool { return true }
+	if len(opt.Fields) > 0 {
+		fields := make(map[string]struct{}, len(opt.Fields))
+		for _, field := range opt.Fields {
+			fields[field] = struct{}{}
+		}
+		selected = func(name string) bool {
+			_, ok := fields[name]
+			return ok
+		}
+		args = filterStructArgs(args, func(name string, value interface{}) bool {
+			return selected(name)
+		})
+	}
+
+	if opt.Prev != nil {
+		prev, err := structValue(opt.Prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		if prev.Type() != rv.Type() {
+			return nil, nil, fmt.Errorf("redis: StructToArgs Prev is %s, not %s", prev.Type(), rv.Type())
+		}
+
+		prevArgs := appendStructField(nil, prev)
+		prevValues := make(map[string]interface{}, len(prevArgs)/2)
+		for i := 0; i < len(prevArgs); i += 2 {
+			prevValues[prevArgs[i].(string)] = prevArgs[i+1]
+		}
+
+		names := make(map[string]struct{}, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			names[args[i].(string)] = struct{}{}
+		}
+		for i := 0; i < len(prevArgs); i += 2 {
+			name := prevArgs[i].(string)
+			if _, ok := names[name]; !ok && selected(name) {
+				removed = append(removed, name)
+			}
+		}
+
+		args = filterStructArgs(args, func(name string, value interface{}) bool {
+			prevValue, ok := prevValues[name]
+			return !ok || !reflect.DeepEqual(value, prevValue)
+		})
+	}
+
+	return args, removed, nil
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("redis: StructToArgs(non-struct %T)", v)
+	}
+	return rv, nil
+}
+
+// filterStructArgs keeps the field and value pairs for which keep returns true.
+func filterStructArgs(args []interface{}, keep func(name string, value interface{}) bool) []interface{} {
+	n := 0
+	for i := 0; i < len(args); i += 2 {
+		if keep(args[i].(string), args[i+1]) {
+			args[n], args[n+1] = args[i], args[i+1]
+			n += 2
+		}
+	}
+	return args[:n]
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
 }
 
 func isEmptyValue(v reflect.Value) bool {
@@ -153,6 +350,10 @@ func isEmptyValue(v reflect.Value) bool {
 		return v.Float() == 0
 	case reflect.Interface, reflect.Pointer:
 		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType && v.CanInterface() {
+			return v.Interface().(time.Time).IsZero()
+		}
 	}
 	return false
 }
@@ -2379,6 +2379,87 @@ var _ = Describe("Commands", func() {
 			}))
 		})
 
+		It("should HSetStruct", func() {
+			type Address struct {
+				City string `redis:"city"`
+			}
+			type User struct {
+				Name    string    `redis:"name"`
+				Age     *int      `redis:"age"`
+				Home    Address   `redis:"home"`
+				Born    time.Time `redis:"born,layout=DateOnly"`
+				Comment string    `redis:"comment,omitempty"`
+			}
+
+			age := 30
+			u := User{
+				Name: "alice",
+				Age:  &age,
+				Home: Address{City: "Paris"},
+				Born: time.Date(1990, 1, 2, 0, 0, 0, 0, time.UTC),
+			}
+			n, err := client.HSetStruct(ctx, "hash", &u, nil).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(int64(4)))
+
+			var got User
+			Expect(client.HGetAll(ctx, "hash").Scan(&got)).NotTo(HaveOccurred())
+			Expect(got).To(Equal(u))
+
+			prev := u
+			u.Home.City = "Lyon"
+			Expect(client.HMSetStruct(ctx, "hash", &u, &redis.StructToArgsOptions{Prev: &prev}).Val()).To(BeTrue())
+			Expect(client.HGet(ctx, "hash", "home.city").Val()).To(Equal("Lyon"))
+
+			cmd := client.HSetStruct(ctx, "hash", &u, &redis.StructToArgsOptions{Prev: &u})
+			Expect(cmd.Err()).NotTo(HaveOccurred())
+			Expect(cmd.Val()).To(BeZero())
+
+			u.Comment = "hi"
+			set, err := client.HSetNXStruct(ctx, "hash", &u, &redis.StructToArgsOptions{
+				Fields: []string{"comment"},
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(set).To(BeTrue())
+			set, err = client.HSetNXStruct(ctx, "hash", &u, &redis.StructToArgsOptions{
+				Fields: []string{"name"},
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(set).To(BeFalse())
+
+			err = client.HSetNXStruct(ctx, "hash", &u, nil).Err()
+			Expect(err).To(MatchError("redis: HSetNXStruct selected 5 fields, not 1"))
+
+			// Fields that became missing are deleted with the changed ones
+			// written, in one command.
+			prev = u
+			u.Age = nil
+			u.Comment = ""
+			u.Name = "bob"
+			cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSetStruct(ctx, "hash", &u, &redis.StructToArgsOptions{Prev: &prev})
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmds).To(HaveLen(1))
+			Expect(cmds[0].(*redis.IntCmd).Val()).To(BeZero())
+			Expect(client.HExists(ctx, "hash", "age").Val()).To(BeFalse())
+			Expect(client.HExists(ctx, "hash", "comment").Val()).To(BeFalse())
+			Expect(client.HGet(ctx, "hash", "name").Val()).To(Equal("bob"))
+
+			prev = u
+			u.Comment = "hi"
+			Expect(client.HMSetStruct(ctx, "hash", &u, &redis.StructToArgsOptions{Prev: &prev}).Val()).To(BeTrue())
+			prev = u
+			u.Comment = ""
+			Expect(client.HMSetStruct(ctx, "hash", &u, &redis.StructToArgsOptions{Prev: &prev}).Val()).To(BeTrue())
+			Expect(client.HExists(ctx, "hash", "comment").Val()).To(BeFalse())
+
+			got = User{}
+			Expect(client.HGetAll(ctx, "hash").Scan(&got)).NotTo(HaveOccurred())
+			Expect(got).To(Equal(u))
+		})
+
 		It("should HSetNX", func() {
 			hSetNX := client.HSetNX(ctx, "hash", "key", "hello")
 			Expect(hSetNX.Err()).NotTo(HaveOccurred())
@@ -5524,6 +5605,57 @@ var _ = Describe("Commands", func() {
 			}))
 		})
 
+		It("should XAdd and scan structs", func() {
+			type Address struct {
+				City string `redis:"city"`
+			}
+			type Meta struct {
+				Source string `redis:"source"`
+			}
+			type Event struct {
+				Meta
+				Name    string    `redis:"name"`
+				Count   int       `redis:"count"`
+				At      time.Time `redis:"at"`
+				Address Address   `redis:"address"`
+				Extra   *Address  `redis:"extra"`
+			}
+
+			at := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+			id, err := client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "stream",
+				Values: &Event{
+					Meta:    Meta{Source: "api"},
+					Name:    "signup",
+					Count:   2,
+					At:      at,
+					Address: Address{City: "Paris"},
+				},
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			vals, err := client.XRange(ctx, "stream", id, id).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vals).To(HaveLen(1))
+			Expect(vals[0].Values).To(Equal(map[string]interface{}{
+				"source":       "api",
+				"name":         "signup",
+				"count":        "2",
+				"at":           at.Format(time.RFC3339Nano),
+				"address.city": "Paris",
+			}))
+
+			var event Event
+			Expect(vals[0].Scan(&event)).NotTo(HaveOccurred())
+			Expect(event).To(Equal(Event{
+				Meta:    Meta{Source: "api"},
+				Name:    "signup",
+				Count:   2,
+				At:      at,
+				Address: Address{City: "Paris"},
+			}))
+		})
+
 		It("should XAdd with MaxLen", func() {
 			id, err := client.XAdd(ctx, &redis.XAddArgs{
 				Stream: "stream",
@@ -140,6 +140,10 @@ func isLoadingError(err error) bool {
 	return strings.HasPrefix(err.Error(), "LOADING ")
 }
 
+func isTryAgainError(err error) bool {
+	return strings.HasPrefix(err.Error(), "TRYAGAIN ")
+}
+
 func isReadOnlyError(err error) bool {
 	return strings.HasPrefix(err.Error(), "READONLY ")
 }
@@ -18,6 +18,7 @@ type GenericCmdable interface {
 	ExpireLT(ctx context.Context, key string, expiration time.Duration) *BoolCmd
 	Keys(ctx context.Context, pattern string) *StringSliceCmd
 	Migrate(ctx context.Context, host, port, key string, db int, timeout time.Duration) *StatusCmd
+	MigrateKeys(ctx context.Context, a *MigrateArgs) *StatusCmd
 	Move(ctx context.Context, key string, db int) *BoolCmd
 	ObjectFreq(ctx context.Context, key string) *IntCmd
 	ObjectRefCount(ctx context.Context, key string) *IntCmd
@@ -154,6 +155,53 @@ func (c cmdable) Migrate(ctx context.Context, host, port, key string, db int, ti
 	return cmd
 }
 
+// MigrateArgs are the arguments of MIGRATE called with the KEYS option.
+type MigrateArgs struct {
+	Host    string
+	Port    string
+	DB      int
+	Timeout time.Duration
+	// Copy keeps the keys on the source instance.
+	Copy bool
+	// Replace replaces existing keys on the destination instance.
+	Replace bool
+	// Username and Password authenticate against the destination instance.
+	Username string
+	Password string
+	Keys     []string
+}
+
+// MigrateKeys atomically transfers the keys to the destination instance.
+// It returns NOKEY when none of the keys exist on the source instance.
+func (c cmdable) MigrateKeys(ctx context.Context, a *MigrateArgs) *StatusCmd {
+	args := make([]interface{}, 0, 12+len(a.Keys))
+	args = append(args, "migrate", a.Host, a.Port, "", a.DB, formatMs(ctx, a.Timeout))
+	if a.Copy {
+		args = append(args, "copy")
+	}
+	if a.Replace {
+		args = append(args, "replace")
+	}
+	if a.Password != "" {
+		if a.Username != "" {
+			args = append(args, "auth2", a.Username, a.Password)
+		} else {
+			args = append(args, "auth", a.Password)
+		}
+	}
+	args = append(args, "keys")
+	keyPos := len(args)
+	for _, key := range a.Keys {
+		args = append(args, key)
+	}
+
+	cmd := NewStatusCmd(ctx, args...)
+	cmd.SetFirstKeyPos(int8(keyPos))
+	cmd.setReadTimeout(a.Timeout)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) Move(ctx context.Context, key string, db int) *BoolCmd {
 	cmd := NewBoolCmd(ctx, "move", key, db)
 	_ = c(ctx, cmd)
@@ -1,6 +1,9 @@
 package redis
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 type HashCmdable interface {
 	HDel(ctx context.Context, key string, fields ...string) *IntCmd
@@ -15,6 +18,9 @@ type HashCmdable interface {
 	HSet(ctx context.Context, key string, values ...interface{}) *IntCmd
 	HMSet(ctx context.Context, key string, values ...interface{}) *BoolCmd
 	HSetNX(ctx context.Context, key, field string, value interface{}) *BoolCmd
+	HSetStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *IntCmd
+	HMSetStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *BoolCmd
+	HSetNXStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *BoolCmd
 	HScan(ctx context.Context, key string, cursor uint64, match string, count int64) *ScanCmd
 	HVals(ctx context.Context, key string) *StringSliceCmd
 	HRandField(ctx context.Context, key string, count int) *StringSliceCmd
@@ -140,6 +146,94 @@ func (c cmdable) HSetNX(ctx context.Context, key, field string, value interface{
 	return cmd
 }
 
+// HSetStruct writes the fields of the struct v selected by opt with HSET,
+// see StructToArgs. The fields that became missing since opt.Prev are
+// deleted in the same atomic step, by a script that runs HDEL and HSET.
+// Nothing is sent when no field changed since opt.Prev.
+func (c cmdable) HSetStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *IntCmd {
+	values, removed, err := StructToArgs(v, opt)
+	if err != nil {
+		cmd := NewIntCmd(ctx, "hset", key)
+		cmd.SetErr(err)
+		return cmd
+	}
+
+	cmd := NewIntCmd(ctx, hsetStructArgs("hset", key, values, removed)...)
+	if len(values) == 0 && len(removed) == 0 {
+		return cmd
+	}
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// HMSetStruct is like HSetStruct, but writes the fields with HMSET.
+func (c cmdable) HMSetStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *BoolCmd {
+	values, removed, err := StructToArgs(v, opt)
+	if err != nil {
+		cmd := NewBoolCmd(ctx, "hmset", key)
+		cmd.SetErr(err)
+		return cmd
+	}
+
+	cmd := NewBoolCmd(ctx, hsetStructArgs("hmset", key, values, removed)...)
+	if len(values) == 0 && len(removed) == 0 {
+		return cmd
+	}
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// hsetStructScript deletes the removed fields and writes the others.
+// ARGV holds the write command, the number of removed fields, the removed
+// fields and the field and value pairs.
+const hsetStructScript = `
+local n = tonumber(ARGV[2])
+redis.call('hdel', KEYS[1], unpack(ARGV, 3, n + 2))
+if #ARGV > n + 2 then
+	return redis.call(ARGV[1], KEYS[1], unpack(ARGV, n + 3))
+end
+if ARGV[1] == 'hmset' then
+	return redis.status_reply('OK')
+end
+return 0`
+
+// hsetStructArgs returns the arguments of the HSET or HMSET command,
+// or of the script that also deletes the removed fields.
+func hsetStructArgs(name, key string, values []interface{}, removed []string) []interface{} {
+	if len(removed) == 0 {
+		args := make([]interface{}, 2, 2+len(values))
+		args[0] = name
+		args[1] = key
+		return append(args, values...)
+	}
+
+	args := make([]interface{}, 0, 6+len(removed)+len(values))
+	args = append(args, "eval", hsetStructScript, 1, key, name, len(removed))
+	for _, field := range removed {
+		args = append(args, field)
+	}
+	return append(args, values...)
+}
+
+// HSetNXStruct writes a field of the struct v with HSETNX. The options must
+// select exactly one field, for example with opt.Fields. Removed fields
+// are not deleted.
+func (c cmdable) HSetNXStruct(ctx context.Context, key string, v interface{}, opt *StructToArgsOptions) *BoolCmd {
+	values, _, err := StructToArgs(v, opt)
+	if err == nil && len(values) != 2 {
+		err = fmt.Errorf("redis: HSetNXStruct selected %d fields, not 1", len(values)/2)
+	}
+	if err != nil {
+		cmd := NewBoolCmd(ctx, "hsetnx", key)
+		cmd.SetErr(err)
+		return cmd
+	}
+
+	cmd := NewBoolCmd(ctx, "hsetnx", key, values[0], values[1])
+	_ = c(ctx, cmd)
+	return cmd
+}
+
 func (c cmdable) HVals(ctx context.Context, key string) *StringSliceCmd {
 	cmd := NewStringSliceCmd(ctx, "hvals", key)
 	_ = c(ctx, cmd)
@@ -37,7 +37,7 @@ var (
 		reflect.Array:         decodeUnsupported,
 		reflect.Chan:          decodeUnsupported,
 		reflect.Func:          decodeUnsupported,
-		reflect.Interface:     decodeUnsupported,
+		reflect.Interface:     decodeInterface,
 		reflect.Map:           decodeUnsupported,
 		reflect.Ptr:           decodeUnsupported,
 		reflect.Slice:         decodeSlice,
@@ -65,10 +65,15 @@ func Struct(dst interface{}) (StructValue, error) {
 		return StructValue{}, fmt.Errorf("redis.Scan(non-struct %T)", dst)
 	}
 
-	return StructValue{
-		spec:  globalStructMap.get(v.Type()),
+	spec := globalStructMap.get(v.Type())
+	strct := StructValue{
+		spec:  spec,
 		value: v,
-	}, nil
+	}
+	if len(spec.defaults) > 0 {
+		strct.scanned = make(map[string]struct{}, len(spec.defaults))
+	}
+	return strct, nil
 }
 
 // Scan scans the results from a key-value Redis map result set to a destination struct.
@@ -100,7 +105,7 @@ func Scan(dst interface{}, keys []interface{}, vals []interface{}) error {
 		}
 	}
 
-	return nil
+	return strct.ScanDefaults()
 }
 
 func decodeBool(f reflect.Value, s string) error {
@@ -202,6 +207,27 @@ func decodeSlice(f reflect.Value, s string) error {
 	return nil
 }
 
+// decodeInterface sets the string to an empty interface.
+func decodeInterface(f reflect.Value, s string) error {
+	if f.NumMethod() > 0 {
+		return decodeUnsupported(f, s)
+	}
+	f.Set(reflect.ValueOf(s))
+	return nil
+}
+
+// decodeTime returns a decoder of time.Time with the layout.
+func decodeTime(layout string) decoderFunc {
+	return func(f reflect.Value, s string) error {
+		t, err := ParseTime(s, layout)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+}
+
 func decodeUnsupported(v reflect.Value, s string) error {
 	return fmt.Errorf("redis.Scan(unsupported %s)", v.Type())
 }
@@ -217,4 +217,145 @@ var _ = Describe("Scan", func() {
 		Expect(Scan(&tt, i{"time"}, i{now.Format(time.RFC3339Nano)})).NotTo(HaveOccurred())
 		Expect(now.Unix()).To(Equal(tt.Time.Unix()))
 	})
+
+	It("scans nested and embedded structs", func() {
+		type Address struct {
+			City string `redis:"city"`
+			Zip  int    `redis:"zip"`
+		}
+		type Base struct {
+			ID int `redis:"id"`
+		}
+		type User struct {
+			Base
+			Name     string   `redis:"name"`
+			Home     Address  `redis:"home"`
+			Work     *Address `redis:"work"`
+			Untagged Address
+		}
+
+		var u User
+		Expect(Scan(&u,
+			i{"id", "name", "home.city", "home.zip", "work.city", "city"},
+			i{"1", "alice", "Paris", "75001", "Lyon", "Nice"},
+		)).NotTo(HaveOccurred())
+		Expect(u).To(Equal(User{
+			Base: Base{ID: 1},
+			Name: "alice",
+			Home: Address{City: "Paris", Zip: 75001},
+			Work: &Address{City: "Lyon"},
+		}))
+
+		Expect(Scan(&u, i{"home.zip"}, i{"a"})).To(MatchError(ContainSubstring("struct field User.Zip of type int")))
+	})
+
+	It("doesn't follow pointers back to a struct being scanned", func() {
+		type Node struct {
+			Name string `redis:"name"`
+			Next *Node  `redis:"next"`
+		}
+		type List struct {
+			Head Node `redis:"head"`
+		}
+
+		var n Node
+		Expect(Scan(&n, i{"name"}, i{"first"})).NotTo(HaveOccurred())
+		Expect(n).To(Equal(Node{Name: "first"}))
+		Expect(Scan(&n, i{"next"}, i{"second"})).To(HaveOccurred())
+
+		var l List
+		Expect(Scan(&l, i{"head.name"}, i{"first"})).NotTo(HaveOccurred())
+		Expect(l.Head.Name).To(Equal("first"))
+	})
+})
+
+var _ = Describe("Scan tag options", func() {
+	type User struct {
+		Name    string      `redis:"name,omitempty,default=anonymous"`
+		Age     *int        `redis:"age"`
+		Score   *int        `redis:"score"`
+		Role    string      `redis:"role,default=user"`
+		Level   int         `redis:"level,default=1"`
+		Born    time.Time   `redis:"born,layout=DateOnly"`
+		Seen    *time.Time  `redis:"seen,layout=unix"`
+		Created time.Time   `redis:"created"`
+		IP      textIP      `redis:"ip"`
+		Extra   interface{} `redis:"extra"`
+	}
+
+	It("scans pointers, layouts and defaults", func() {
+		var u User
+		Expect(Scan(&u,
+			i{"name", "age", "level", "born", "seen", "created", "ip", "extra"},
+			i{"", "42", "3", "2000-01-02", "1700000000", "2001-02-03T04:05:06Z", "10.0.0.1", "x"},
+		)).NotTo(HaveOccurred())
+
+		Expect(u.Name).To(Equal("anonymous"))
+		Expect(*u.Age).To(Equal(42))
+		Expect(u.Score).To(BeNil())
+		Expect(u.Role).To(Equal("user"))
+		Expect(u.Level).To(Equal(3))
+		Expect(u.Born).To(Equal(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)))
+		Expect(u.Seen.Unix()).To(Equal(int64(1700000000)))
+		Expect(u.Created).To(Equal(time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)))
+		Expect(u.IP).To(Equal(textIP("10.0.0.1")))
+		Expect(u.Extra).To(Equal("x"))
+
+		Expect(Scan(&u, i{"born"}, i{"02/01/2000"})).To(MatchError(ContainSubstring("struct field User.Born")))
+	})
+
+	It("parses tags", func() {
+		Expect(ParseTag("born,omitempty,layout=RFC1123,default=x")).To(Equal(TagOptions{
+			Name:       "born",
+			OmitEmpty:  true,
+			Default:    "x",
+			HasDefault: true,
+			Layout:     time.RFC1123,
+		}))
+		Expect(ParseTag("seen,layout=2006-01-02")).To(Equal(TagOptions{
+			Name:   "seen",
+			Layout: "2006-01-02",
+		}))
+	})
+})
+
+type textIP string
+
+func (ip *textIP) UnmarshalText(b []byte) error {
+	*ip = textIP(b)
+	return nil
+}
+
+type unexportedInner struct {
+	Inner string `redis:"inner"`
+}
+
+var _ = Describe("Scan unexported embedded structs", func() {
+	It("skips embedded pointers to unexported structs", func() {
+		type Outer struct {
+			*unexportedInner
+			unexportedValue
+			Name string `redis:"name"`
+		}
+
+		var o Outer
+		Expect(Scan(&o, i{"name", "inner", "value"}, i{"alice", "x", "y"})).NotTo(HaveOccurred())
+		Expect(o.Name).To(Equal("alice"))
+		Expect(o.unexportedInner).To(BeNil())
+		Expect(o.Value).To(Equal("y"))
+	})
+
+	It("returns an error for unexported nested pointers", func() {
+		type Outer struct {
+			inner *unexportedInner `redis:"in"`
+		}
+
+		var o Outer
+		Expect(Scan(&o, i{"in.inner"}, i{"x"})).To(MatchError(ContainSubstring("cannot set unexported pointer")))
+		Expect(o.inner).To(BeNil())
+	})
 })
+
+type unexportedValue struct {
+	Value string `redis:"value"`
+}
@@ -4,7 +4,6 @@ import (
 	"encoding"
 	"fmt"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/redis/go-redis/v9/internal/util"
@@ -35,48 +34,126 @@ func (s *structMap) get(t reflect.Type) *structSpec {
 // structSpec contains the list of all fields in a target struct.
 type structSpec struct {
 	m map[string]*structField
+	// defaults are the keys of the fields with a default value.
+	defaults []string
 }
 
 func (s *structSpec) set(tag string, sf *structField) {
 	s.m[tag] = sf
+	if sf.hasDefault {
+		s.defaults = append(s.defaults, tag)
+	}
 }
 
 func newStructSpec(t reflect.Type, fieldTag string) *structSpec {
-	numField := t.NumField()
 	out := &structSpec{
-		m: make(map[string]*structField, numField),
+		m: make(map[string]*structField, t.NumField()),
 	}
+	out.add(t, fieldTag, "", nil, map[reflect.Type]bool{t: true})
+	return out
+}
 
-	for i := 0; i < numField; i++ {
+// add adds the fields of the struct type with the prefix. Fields of nested
+// structs are named "<field>.<nested field>" and fields of embedded structs
+// without a tag are promoted. Path holds the struct types being added, so
+// a pointer back to one of them is not followed but left unsupported.
+func (s *structSpec) add(t reflect.Type, fieldTag, prefix string, index []int, path map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
 		tag := f.Tag.Get(fieldTag)
-		if tag == "" || tag == "-" {
+		if tag == "-" {
+			continue
+		}
+		opts := ParseTag(tag)
+		if opts.Name == "" {
+			// Like encoding/json, skip embedded pointers to unexported
+			// structs, which can't be allocated.
+			if f.Anonymous && f.Type.Kind() == reflect.Ptr && !f.IsExported() {
+				continue
+			}
+			if f.Anonymous && IsNestedStruct(f.Type) && !path[indirect(f.Type)] {
+				s.addNested(indirect(f.Type), fieldTag, prefix, fieldIndex, path)
+			}
 			continue
 		}
 
-		tag = strings.Split(tag, ",")[0]
-		if tag == "" {
+		if IsNestedStruct(f.Type) && !path[indirect(f.Type)] {
+			s.addNested(indirect(f.Type), fieldTag, prefix+opts.Name+".", fieldIndex, path)
 			continue
 		}
 
-		// Use the built-in decoder.
-		kind := f.Type.Kind()
-		if kind == reflect.Pointer {
-			kind = f.Type.Elem().Kind()
+		sf := &structField{
+			index:      fieldIndex,
+			omitEmpty:  opts.OmitEmpty,
+			def:        opts.Default,
+			hasDefault: opts.HasDefault,
+		}
+		if typ := indirect(f.Type); typ == timeType && opts.Layout != "" {
+			sf.layout = opts.Layout
+			sf.fn = decodeTime(opts.Layout)
+		} else {
+			// Use the built-in decoder.
+			sf.fn = decoders[typ.Kind()]
 		}
-		out.set(tag, &structField{index: i, fn: decoders[kind]})
+		s.set(prefix+opts.Name, sf)
 	}
+}
 
-	return out
+func (s *structSpec) addNested(t reflect.Type, fieldTag, prefix string, index []int, path map[reflect.Type]bool) {
+	path[t] = true
+	s.add(t, fieldTag, prefix, index, path)
+	delete(path, t)
+}
+
+var (
+	scannerType           = reflect.TypeOf((*Scanner)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// IsNestedStruct reports whether the fields of the struct type are mapped
+// separately, because the struct can't decode or encode itself as one value.
+// The encoder of HSetStruct uses it too, so a struct is read back the way
+// it is written.
+func IsNestedStruct(t reflect.Type) bool {
+	t = indirect(t)
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	ptr := reflect.PointerTo(t)
+	return !ptr.Implements(scannerType) &&
+		!ptr.Implements(textUnmarshalerType) &&
+		!ptr.Implements(binaryMarshalerType) &&
+		!ptr.Implements(binaryUnmarshalerType)
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
 }
 
 //------------------------------------------------------------------------------
 
 // structField represents a single field in a target struct.
 type structField struct {
-	index int
+	// index is the index sequence of the field, see reflect.Value.FieldByIndex.
+	index []int
 	fn    decoderFunc
+
+	omitEmpty  bool
+	def        string
+	hasDefault bool
+	// layout is the layout of a time.Time field, which is then parsed
+	// by fn instead of UnmarshalText.
+	layout string
 }
 
 //------------------------------------------------------------------------------
@@ -84,6 +161,8 @@ type structField struct {
 type StructValue struct {
 	spec  *structSpec
 	value reflect.Value
+	// scanned holds the scanned keys of the fields with a default value.
+	scanned map[string]struct{}
 }
 
 func (s StructValue) Scan(key string, value string) error {
@@ -91,8 +170,35 @@ func (s StructValue) Scan(key string, value string) error {
 	if !ok {
 		return nil
 	}
+	if field.omitEmpty && value == "" {
+		return nil
+	}
+	if field.hasDefault {
+		s.scanned[key] = struct{}{}
+	}
+	return s.decode(field, value)
+}
 
-	v := s.value.Field(field.index)
+// ScanDefaults sets the fields with a default value that were not scanned.
+// It is called once all the values are scanned.
+func (s StructValue) ScanDefaults() error {
+	for _, key := range s.spec.defaults {
+		if _, ok := s.scanned[key]; ok {
+			continue
+		}
+		field := s.spec.m[key]
+		if err := s.decode(field, field.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s StructValue) decode(field *structField, value string) error {
+	v, err := s.field(field.index)
+	if err != nil {
+		return err
+	}
 	isPtr := v.Kind() == reflect.Ptr
 
 	if isPtr && v.IsNil() {
@@ -103,12 +209,14 @@ func (s StructValue) Scan(key string, value string) error {
 		isPtr = true
 	}
 
-	if isPtr && v.Type().NumMethod() > 0 && v.CanInterface() {
+	if isPtr && field.layout == "" && v.Type().NumMethod() > 0 && v.CanInterface() {
 		switch scan := v.Interface().(type) {
 		case Scanner:
 			return scan.ScanRedis(value)
 		case encoding.TextUnmarshaler:
 			return scan.UnmarshalText(util.StringToBytes(value))
+		case encoding.BinaryUnmarshaler:
+			return scan.UnmarshalBinary(util.StringToBytes(value))
 		}
 	}
 
@@ -118,8 +226,28 @@ func (s StructValue) Scan(key string, value string) error {
 
 	if err := field.fn(v, value); err != nil {
 		t := s.value.Type()
+		f := t.FieldByIndex(field.index)
 		return fmt.Errorf("cannot scan redis.result %s into struct field %s.%s of type %s, error-%s",
-			value, t.Name(), t.Field(field.index).Name, t.Field(field.index).Type, err.Error())
+			value, t.Name(), f.Name, f.Type, err.Error())
 	}
 	return nil
 }
+
+// field returns the field with the index sequence, allocating
+// the nil pointers to nested structs on the way.
+func (s StructValue) field(index []int) (reflect.Value, error) {
+	v := s.value
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("redis.Scan(cannot set unexported pointer to struct %s)", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
@@ -0,0 +1,97 @@
+package hscan
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagOptions are the options of a `redis:"name,option,option=value"` struct tag:
+//   - omitempty: empty values are not written, and empty strings are scanned
+//     like missing fields.
+//   - default=value: the value scanned when the field is missing.
+//   - layout=layout: the layout of a time.Time field, either a time.Parse
+//     layout, the name of a time package layout like "RFC1123",
+//     "unix" or "unixmilli".
+//
+// Option values end at the next comma, so layouts with commas must be
+// given by their name.
+type TagOptions struct {
+	Name       string
+	OmitEmpty  bool
+	Default    string
+	HasDefault bool
+	Layout     string
+}
+
+// ParseTag parses the value of a `redis` struct tag.
+func ParseTag(tag string) TagOptions {
+	name, opts, _ := strings.Cut(tag, ",")
+	o := TagOptions{Name: name}
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "omitempty":
+			o.OmitEmpty = true
+		case "default":
+			o.Default = value
+			o.HasDefault = true
+		case "layout":
+			if l, ok := layouts[value]; ok {
+				value = l
+			}
+			o.Layout = value
+		}
+	}
+	return o
+}
+
+var layouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    "2006-01-02 15:04:05",
+	"DateOnly":    "2006-01-02",
+	"TimeOnly":    "15:04:05",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ParseTime parses the time with the layout of a tag.
+func ParseTime(s, layout string) (time.Time, error) {
+	switch layout {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unix" {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	}
+	return time.Parse(layout, s)
+}
+
+// FormatTime formats the time with the layout of a tag.
+func FormatTime(t time.Time, layout string) string {
+	switch layout {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(layout)
+}
@@ -20,7 +20,10 @@ type Conn struct {
 	bw *bufio.Writer
 	wr *proto.Writer
 
-	Inited    bool
+	Inited bool
+	// Protocol is the RESP version agreed with the server when the
+	// connection was initialized.
+	Protocol  int
 	pooled    bool
 	createdAt time.Time
 }
@@ -2,8 +2,13 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -77,6 +82,377 @@ var _ = Describe("newClusterState", func() {
 	})
 })
 
+func TestClusterStateReadRouter(t *testing.T) {
+	opt := &ClusterOptions{
+		NodeZone: func(addr string) string {
+			if addr == "10.0.0.2:7000" {
+				return "us-east-1b"
+			}
+			return "us-east-1a"
+		},
+		ReadRouter: ReadRouterFunc(func(nodes []ReadRouterNode) int {
+			for i, node := range nodes {
+				if node.Zone == "us-east-1b" {
+					return i
+				}
+			}
+			return -1
+		}),
+	}
+	opt.init()
+	if !opt.ReadOnly {
+		t.Fatal("ReadRouter should enable ReadOnly")
+	}
+
+	nodes := newClusterNodes(opt)
+	defer nodes.Close()
+
+	state, err := newClusterState(nodes, []ClusterSlot{{
+		Start: 0,
+		End:   999,
+		Nodes: []ClusterNode{{Addr: "10.0.0.1:7000"}, {Addr: "10.0.0.2:7000"}},
+	}, {
+		Start: 1000,
+		End:   1999,
+		Nodes: []ClusterNode{{Addr: "10.0.0.3:7000"}, {Addr: "10.0.0.4:7000"}},
+	}}, "10.0.0.1:7000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := state.slotRoutedNode(opt.ReadRouter, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := node.Client.getAddr(); addr != "10.0.0.2:7000" {
+		t.Fatalf("got %q, wanted the replica in us-east-1b", addr)
+	}
+
+	node, err = state.slotRoutedNode(opt.ReadRouter, 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := node.Client.getAddr(); addr != "10.0.0.3:7000" {
+		t.Fatalf("got %q, wanted the master", addr)
+	}
+}
+
+func TestClusterAddressMapper(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []string
+
+	opt := &ClusterOptions{
+		AddressMapper: func(addr string) string {
+			return strings.Replace(addr, "10.0.0.", "203.0.113.", 1)
+		},
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, addr)
+			mu.Unlock()
+			return nil, errors.New("dial refused")
+		},
+		MaxRetries: -1,
+	}
+	opt.init()
+
+	nodes := newClusterNodes(opt)
+	defer nodes.Close()
+
+	state, err := newClusterState(nodes, []ClusterSlot{{
+		Start: 0,
+		End:   16383,
+		Nodes: []ClusterNode{{Addr: "10.0.0.1:7000"}},
+	}}, "10.0.0.1:7000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := state.slotMasterNode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := node.Client.getAddr(); addr != "10.0.0.1:7000" {
+		t.Fatalf("got %q, wanted the announced address", addr)
+	}
+
+	_ = node.Client.Ping(context.Background()).Err()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) == 0 || dialed[0] != "203.0.113.1:7000" {
+		t.Fatalf("got %q, wanted the mapped address to be dialed", dialed)
+	}
+}
+
+func TestFailoverAddressMapper(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []string
+
+	// The sentinel announces the master with its internal address.
+	sentinel := func() net.Conn {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			rd := proto.NewReader(server)
+			for {
+				reply, err := rd.ReadReply()
+				if err != nil {
+					return
+				}
+				args := reply.([]interface{})
+				var resp string
+				switch strings.ToLower(args[0].(string)) {
+				case "hello":
+					resp = "-ERR unknown command 'HELLO'\r\n"
+				case "sentinel":
+					if strings.ToLower(args[1].(string)) == "get-master-addr-by-name" {
+						resp = "*2\r\n$8\r\n10.0.0.2\r\n$4\r\n6379\r\n"
+					} else {
+						resp = "*0\r\n"
+					}
+				default:
+					resp = "+OK\r\n"
+				}
+				if _, err := server.Write([]byte(resp)); err != nil {
+					return
+				}
+			}
+		}()
+		return client
+	}
+
+	client := NewFailoverClient(&FailoverOptions{
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{"10.0.0.1:26379"},
+		AddressMapper: func(addr string) string {
+			return strings.Replace(addr, "10.0.0.", "203.0.113.", 1)
+		},
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, addr)
+			mu.Unlock()
+			if addr == "203.0.113.1:26379" {
+				return sentinel(), nil
+			}
+			return nil, errors.New("dial refused")
+		},
+		MaxRetries: -1,
+	})
+	defer client.Close()
+
+	_ = client.Ping(context.Background()).Err()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) < 2 || dialed[0] != "203.0.113.1:26379" {
+		t.Fatalf("got %q, wanted the mapped sentinel address to be dialed", dialed)
+	}
+	for _, addr := range dialed {
+		if strings.HasPrefix(addr, "10.0.0.") {
+			t.Fatalf("got %q, wanted only mapped addresses to be dialed", dialed)
+		}
+	}
+	if !containsString(dialed, "203.0.113.2:6379") {
+		t.Fatalf("got %q, wanted the mapped master address to be dialed", dialed)
+	}
+}
+
+func TestZoneReadRouter(t *testing.T) {
+	router := NewZoneReadRouter("a")
+
+	tests := []struct {
+		name  string
+		nodes []ReadRouterNode
+		want  int
+	}{{
+		name: "closest node in zone",
+		nodes: []ReadRouterNode{
+			{Master: true, Zone: "b", Latency: time.Millisecond},
+			{Zone: "a", Latency: 3 * time.Millisecond},
+			{Zone: "a", Latency: 2 * time.Millisecond},
+		},
+		want: 2,
+	}, {
+		name: "skips failing nodes in zone",
+		nodes: []ReadRouterNode{
+			{Master: true, Zone: "b", Latency: time.Millisecond},
+			{Zone: "a", Latency: 3 * time.Millisecond},
+			{Zone: "a", Latency: 2 * time.Millisecond, Failing: true},
+		},
+		want: 1,
+	}, {
+		name: "closest node in other zones",
+		nodes: []ReadRouterNode{
+			{Master: true, Zone: "b", Latency: 2 * time.Millisecond},
+			{Zone: "c", Latency: time.Millisecond},
+			{Zone: "a", Failing: true},
+		},
+		want: 1,
+	}, {
+		name: "all nodes failing",
+		nodes: []ReadRouterNode{
+			{Master: true, Zone: "b", Failing: true},
+			{Zone: "a", Failing: true},
+		},
+		want: 0,
+	}}
+
+	for _, tt := range tests {
+		if got := router.RouteRead(tt.nodes); got != tt.want {
+			t.Errorf("%s: got %d, wanted %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplicaReadRouter(t *testing.T) {
+	router := NewReplicaReadRouter()
+
+	if got := router.RouteRead([]ReadRouterNode{{Master: true}}); got != 0 {
+		t.Errorf("got %d, wanted the master", got)
+	}
+
+	nodes := []ReadRouterNode{{Master: true}, {Failing: true}, {}, {Failing: true}}
+	for i := 0; i < 10; i++ {
+		if got := router.RouteRead(nodes); got != 2 {
+			t.Fatalf("got %d, wanted the healthy replica", got)
+		}
+	}
+
+	nodes[2].Failing = true
+	if got := router.RouteRead(nodes); got != 0 {
+		t.Errorf("got %d, wanted the master", got)
+	}
+}
+
+func TestParseClusterNodes(t *testing.T) {
+	nodes := parseClusterNodes("" +
+		"07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004,hostname4 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected\n" +
+		"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001,hostname1 myself,master - 0 0 1 connected 0-5460\n" +
+		"67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master - 0 1426238316232 2 connected 5461-10922\n")
+
+	want := map[string]clusterNodeInfo{
+		"07c37dfeb235213a872192d90877d0cd55635b91": {
+			id:   "07c37dfeb235213a872192d90877d0cd55635b91",
+			addr: "127.0.0.1:30004",
+		},
+		"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca": {
+			id:     "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca",
+			addr:   "127.0.0.1:30001",
+			master: true,
+		},
+		"67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1": {
+			id:     "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1",
+			addr:   "127.0.0.1:30002",
+			master: true,
+		},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("got %v, wanted %v", nodes, want)
+	}
+}
+
+func TestPlanClusterRebalance(t *testing.T) {
+	master := func(id string) []ClusterNode {
+		return []ClusterNode{{ID: id}}
+	}
+	slots := []ClusterSlot{
+		{Start: 0, End: 8191, Nodes: master("a")},
+		{Start: 8192, End: 16383, Nodes: master("b")},
+	}
+
+	moves, err := PlanClusterRebalance(slots, map[string]float64{"c": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClusterSlotMove{
+		{SourceID: "a", TargetID: "c", Start: 4096, End: 8191},
+		{SourceID: "b", TargetID: "c", Start: 12288, End: 16383},
+	}
+	if !reflect.DeepEqual(moves, want) {
+		t.Fatalf("got %v, wanted %v", moves, want)
+	}
+
+	moves, err = PlanClusterRebalance(slots, map[string]float64{"a": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []ClusterSlotMove{{SourceID: "a", TargetID: "b", Start: 0, End: 8191}}
+	if !reflect.DeepEqual(moves, want) {
+		t.Fatalf("got %v, wanted %v", moves, want)
+	}
+
+	moves, err = PlanClusterRebalance(slots, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 0 {
+		t.Fatalf("got %v, wanted no moves", moves)
+	}
+
+	moves, err = PlanClusterRebalance([]ClusterSlot{
+		{Start: 0, End: 16383, Nodes: master("a")},
+	}, map[string]float64{"b": 1, "c": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, move := range moves {
+		counts[move.TargetID] += move.End - move.Start + 1
+	}
+	if counts["b"] != 5461 || counts["c"] != 5461 {
+		t.Fatalf("got %v, wanted 5461 slots for b and c", counts)
+	}
+
+	if _, err := PlanClusterRebalance(slots, map[string]float64{"a": 0, "b": 0}); err == nil {
+		t.Fatal("expected an error when all weights are zero")
+	}
+}
+
+func TestParseReplicationLags(t *testing.T) {
+	info := "# Replication\r\n" +
+		"role:master\r\n" +
+		"connected_slaves:3\r\n" +
+		"slave0:ip=127.0.0.1,port=6380,state=online,offset=1234,lag=0\r\n" +
+		"slave1:ip=127.0.0.1,port=6381,state=online,offset=1000,lag=7\r\n" +
+		"slave2:ip=127.0.0.1,port=6382,state=wait_bgsave,offset=0,lag=0\r\n" +
+		"master_replid:8c5f0d6d1c1e0f0b4c7a0e1f9c2d3b4a5e6f7a8b\r\n"
+
+	lags := parseReplicationLags(info)
+	want := map[string]time.Duration{
+		"127.0.0.1:6380": 0,
+		"127.0.0.1:6381": 7 * time.Second,
+	}
+	if !reflect.DeepEqual(lags, want) {
+		t.Fatalf("got %v, wanted %v", lags, want)
+	}
+}
+
+func TestFailoverReplicas(t *testing.T) {
+	replicas := &failoverReplicas{
+		opt:     &FailoverOptions{},
+		clients: make(map[string]*Client),
+	}
+	defer replicas.Close()
+
+	if replicas.Random() != nil {
+		t.Fatal("expected no replica")
+	}
+
+	replicas.SetAddrs([]string{"127.0.0.1:6380", "127.0.0.1:6381"})
+	replicas.Remove("127.0.0.1:6380")
+	if got := replicas.Addrs(); !reflect.DeepEqual(got, []string{"127.0.0.1:6381"}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := replicas.Random().Options().Addr; got != "127.0.0.1:6381" {
+		t.Fatalf("got %s, wanted 127.0.0.1:6381", got)
+	}
+
+	replicas.SetAddrs([]string{"127.0.0.1:6382"})
+	if got := len(replicas.List()); got != 1 {
+		t.Fatalf("got %d clients, wanted 1", got)
+	}
+}
+
 type fixedHash string
 
 func (h fixedHash) Get(string) string {
@@ -149,107 +525,766 @@ func TestRingSetAddrsAndRebalanceRace(t *testing.T) {
 	}
 }
 
-func BenchmarkRingShardingRebalanceLocked(b *testing.B) {
-	opts := &RingOptions{
-		Addrs: make(map[string]string),
+func TestRingWeights(t *testing.T) {
+	ring := NewRing(&RingOptions{
+		Addrs: map[string]string{
+			"a": ":6390",
+			"b": ":6391",
+			"c": ":6392",
+		},
+		Weights: map[string]int{
+			"a": 3,
+			"c": 0,
+		},
 		// Disable heartbeat
 		HeartbeatFrequency: 1 * time.Hour,
+	})
+	defer ring.Close()
+
+	if n := ring.Len(); n != 2 {
+		t.Fatalf("got %d shards, wanted 2", n)
 	}
-	for i := 0; i < 100; i++ {
-		opts.Addrs[fmt.Sprintf("shard%d", i)] = fmt.Sprintf(":63%02d", i)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[ring.sharding.Hash(fmt.Sprintf("key%d", i))]++
+	}
+	if counts["c"] != 0 {
+		t.Fatalf("shard with zero weight got %d keys", counts["c"])
+	}
+	if ratio := float64(counts["a"]) / float64(counts["b"]); ratio < 2.5 || ratio > 3.5 {
+		t.Fatalf("got %v, wanted about 3 times more keys on shard a", counts)
 	}
 
-	ring := NewRing(opts)
+	ring.SetWeights(nil)
+	counts = make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[ring.sharding.Hash(fmt.Sprintf("key%d", i))]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("got %v, wanted keys on all shards", counts)
+	}
+}
+
+func TestRendezvousGetN(t *testing.T) {
+	hash := newRendezvous([]string{"a", "b", "c", "d"}).(ReplicatedConsistentHash)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		shards := hash.GetN(key, 3)
+		if len(shards) != 3 {
+			t.Fatalf("got %v, wanted 3 shards", shards)
+		}
+		if shards[0] != hash.Get(key) {
+			t.Fatalf("got %s, wanted %s first", shards[0], hash.Get(key))
+		}
+		if shards[0] == shards[1] || shards[1] == shards[2] || shards[0] == shards[2] {
+			t.Fatalf("got %v, wanted distinct shards", shards)
+		}
+	}
+
+	if shards := hash.GetN("key", 10); len(shards) != 4 {
+		t.Fatalf("got %v, wanted all 4 shards", shards)
+	}
+}
+
+type firstShardHash []string
+
+func (h firstShardHash) Get(string) string {
+	return h[0]
+}
+
+func TestRingReplicas(t *testing.T) {
+	ring := NewRing(&RingOptions{
+		Addrs: map[string]string{
+			"a": ":6390",
+			"b": ":6391",
+			"c": ":6392",
+		},
+		Weights: map[string]int{
+			"a": 3,
+		},
+		ReplicationFactor: 2,
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	})
 	defer ring.Close()
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		ring.sharding.rebalanceLocked()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		replicas, err := ring.sharding.GetReplicasByKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(replicas) != 2 {
+			t.Fatalf("got %d replicas, wanted 2", len(replicas))
+		}
+		if replicas[0].name != ring.sharding.Hash(key) {
+			t.Fatalf("got %s, wanted %s first", replicas[0].name, ring.sharding.Hash(key))
+		}
+		if replicas[0].name == replicas[1].name {
+			t.Fatalf("got %s twice", replicas[0].name)
+		}
+		if replicas[1].shard != ring.ShardByName(replicas[1].name) {
+			t.Fatalf("got wrong shard for %s", replicas[1].name)
+		}
+	}
+
+	// Hashes without GetN use the order of the shard names.
+	ring.opt.NewConsistentHash = func(shards []string) ConsistentHash {
+		return firstShardHash{"c"}
+	}
+	ring.opt.ReplicationFactor = 3
+	ring.SetWeights(nil)
+
+	replicas, err := ring.sharding.GetReplicasByKey("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, replica := range replicas {
+		names = append(names, replica.name)
+	}
+	if got := strings.Join(names, ","); got != "c,a,b" {
+		t.Fatalf("got %s, wanted c,a,b", got)
 	}
 }
 
-type testCounter struct {
-	mu sync.Mutex
-	t  *testing.T
-	m  map[string]int
+func TestRingReplicationErr(t *testing.T) {
+	replicas := []ringReplica{{name: "a"}, {name: "b"}, {name: "c"}}
+	netErr := errors.New("dial tcp: connection refused")
+
+	tests := []struct {
+		consistency RingWriteConsistency
+		errs        []error
+		ok          bool
+	}{
+		{RingWriteOne, []error{nil, netErr, netErr}, true},
+		{RingWriteOne, []error{netErr, nil, nil}, false},
+		{RingWriteQuorum, []error{nil, nil, netErr}, true},
+		{RingWriteQuorum, []error{nil, netErr, netErr}, false},
+		{RingWriteAll, []error{nil, nil, proto.RedisError("WRONGTYPE")}, true},
+		{RingWriteAll, []error{nil, Nil, netErr}, false},
+		// Fewer shards are up than the replication factor.
+		{RingWriteAll, []error{nil, nil}, true},
+		{RingWriteAll, []error{nil}, true},
+		{RingWriteQuorum, []error{nil, netErr}, false},
+	}
+	for _, test := range tests {
+		ring := &Ring{opt: &RingOptions{
+			ReplicationFactor: 3,
+			WriteConsistency:  test.consistency,
+		}}
+		err := ring.replicationErr(replicas[:len(test.errs)], test.errs)
+		if test.ok {
+			if err != nil {
+				t.Fatalf("%s %v: got %s, wanted no error", test.consistency, test.errs, err)
+			}
+			continue
+		}
+
+		var replErr *RingReplicationError
+		if !errors.As(err, &replErr) {
+			t.Fatalf("%s %v: got %v, wanted RingReplicationError", test.consistency, test.errs, err)
+		}
+		if replErr.Errs["a"] != test.errs[0] && test.errs[0] != nil {
+			t.Fatalf("%s %v: got %v, wanted the error of shard a", test.consistency, test.errs, replErr.Errs)
+		}
+	}
 }
 
-func newTestCounter(t *testing.T) *testCounter {
-	return &testCounter{t: t, m: make(map[string]int)}
+// recordingHook records the pipelined commands instead of sending them.
+type recordingHook struct {
+	mu   *sync.Mutex
+	cmds *[]Cmder
 }
 
-func (ct *testCounter) increment(key string) {
-	ct.mu.Lock()
-	defer ct.mu.Unlock()
-	ct.m[key]++
+func (recordingHook) DialHook(next DialHook) DialHook {
+	return next
 }
 
-func (ct *testCounter) expect(values map[string]int) {
-	ct.mu.Lock()
-	defer ct.mu.Unlock()
-	ct.t.Helper()
-	if !reflect.DeepEqual(values, ct.m) {
-		ct.t.Errorf("expected %v != actual %v", values, ct.m)
+func (recordingHook) ProcessHook(next ProcessHook) ProcessHook {
+	return next
+}
+
+func (h recordingHook) ProcessPipelineHook(next ProcessPipelineHook) ProcessPipelineHook {
+	return func(ctx context.Context, cmds []Cmder) error {
+		h.mu.Lock()
+		*h.cmds = append(*h.cmds, cmds...)
+		h.mu.Unlock()
+		return nil
 	}
 }
 
-func TestRingShardsCleanup(t *testing.T) {
-	const (
-		ringShard1Name = "ringShardOne"
-		ringShard2Name = "ringShardTwo"
+func TestStreamProducerTrim(t *testing.T) {
+	tests := []struct {
+		opt    StreamProducerOptions
+		maxLen bool
+		minID  bool
+	}{
+		{StreamProducerOptions{}, false, false},
+		{StreamProducerOptions{MaxLen: 10}, true, false},
+		{StreamProducerOptions{MaxAge: time.Hour}, false, true},
+		{StreamProducerOptions{MaxLen: 10, MaxAge: time.Hour}, true, false},
+	}
+	for _, test := range tests {
+		var mu sync.Mutex
+		var cmds []Cmder
+		client := NewClient(&Options{})
+		client.AddHook(recordingHook{mu: &mu, cmds: &cmds})
 
-		ringShard1Addr = "shard1.test"
-		ringShard2Addr = "shard2.test"
-	)
+		opt := test.opt
+		p := NewStreamProducer(client, &opt)
+		if _, err := p.Add(context.Background(), &XAddArgs{Stream: "s", Values: []string{"k", "v"}}); err != nil {
+			t.Fatal(err)
+		}
+		_ = p.Close()
+		_ = client.Close()
 
-	t.Run("closes unused shards", func(t *testing.T) {
-		closeCounter := newTestCounter(t)
+		if len(cmds) != 1 {
+			t.Fatalf("got %d commands, wanted 1", len(cmds))
+		}
+		var maxLen, minID bool
+		for _, arg := range cmds[0].Args() {
+			maxLen = maxLen || arg == "maxlen"
+			minID = minID || arg == "minid"
+		}
+		if maxLen != test.maxLen || minID != test.minID {
+			t.Fatalf("%+v: got %v", test.opt, cmds[0].Args())
+		}
+	}
+}
 
-		ring := NewRing(&RingOptions{
-			Addrs: map[string]string{
-				ringShard1Name: ringShard1Addr,
-				ringShard2Name: ringShard2Addr,
-			},
-			NewClient: func(opt *Options) *Client {
-				c := NewClient(opt)
-				c.baseClient.onClose = func() error {
-					closeCounter.increment(opt.Addr)
-					return nil
-				}
-				return c
-			},
-		})
-		closeCounter.expect(map[string]int{})
+type failingHook struct {
+	attempts *int64
+}
 
-		// no change due to the same addresses
-		ring.SetAddrs(map[string]string{
-			ringShard1Name: ringShard1Addr,
-			ringShard2Name: ringShard2Addr,
-		})
-		closeCounter.expect(map[string]int{})
+func (failingHook) DialHook(next DialHook) DialHook {
+	return next
+}
 
-		ring.SetAddrs(map[string]string{
-			ringShard1Name: ringShard1Addr,
-		})
-		closeCounter.expect(map[string]int{ringShard2Addr: 1})
+func (h failingHook) ProcessHook(next ProcessHook) ProcessHook {
+	return func(ctx context.Context, cmd Cmder) error {
+		if cmd.Name() == "set" {
+			atomic.AddInt64(h.attempts, 1)
+		}
+		return io.EOF
+	}
+}
 
-		ring.SetAddrs(map[string]string{
-			ringShard2Name: ringShard2Addr,
-		})
-		closeCounter.expect(map[string]int{ringShard1Addr: 1, ringShard2Addr: 1})
+func (failingHook) ProcessPipelineHook(next ProcessPipelineHook) ProcessPipelineHook {
+	return next
+}
 
-		ring.Close()
-		closeCounter.expect(map[string]int{ringShard1Addr: 1, ringShard2Addr: 2})
-	})
+func TestRingReplicatedRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]*int64)
 
-	t.Run("closes created shards if ring was closed", func(t *testing.T) {
-		createCounter := newTestCounter(t)
-		closeCounter := newTestCounter(t)
+	ring := NewRing(&RingOptions{
+		Addrs: map[string]string{
+			"a": ":6390",
+			"b": ":6391",
+		},
+		NewClient: func(opt *Options) *Client {
+			mu.Lock()
+			n := new(int64)
+			attempts[opt.Addr] = n
+			mu.Unlock()
 
-		var (
-			ring        *Ring
-			shouldClose int32
-		)
+			client := NewClient(opt)
+			client.AddHook(failingHook{attempts: n})
+			return client
+		},
+		ReplicationFactor: 2,
+		WriteConsistency:  RingWriteAll,
+		MaxRetries:        2,
+		MinRetryBackoff:   time.Millisecond,
+		MaxRetryBackoff:   time.Millisecond,
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	})
+	defer ring.Close()
+
+	if err := ring.Set(context.Background(), "key", "value", 0).Err(); err == nil {
+		t.Fatal("wanted an error")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for addr, n := range attempts {
+		if got := atomic.LoadInt64(n); got != 3 {
+			t.Fatalf("%s: got %d attempts, wanted 3", addr, got)
+		}
+	}
+}
+
+func TestRingSplitMultiKeyCmd(t *testing.T) {
+	ctx := context.Background()
+	ring := NewRing(&RingOptions{
+		Addrs: map[string]string{
+			"a": ":6390",
+			"b": ":6391",
+			"c": ":6392",
+		},
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	})
+	defer ring.Close()
+
+	if split := ring.splitMultiKeyCmd(ctx, NewSliceCmd(ctx, "mget", "{a}1", "{a}2")); split != nil {
+		t.Fatalf("got %d sub-commands for keys of one shard", len(split.subs))
+	}
+
+	var keys []interface{}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	cmd := NewSliceCmd(ctx, append([]interface{}{"mget"}, keys...)...)
+	split := ring.splitMultiKeyCmd(ctx, cmd)
+	if split == nil || len(split.subs) != 3 {
+		t.Fatalf("got %v, wanted 3 sub-commands", split)
+	}
+
+	// Reply with the key itself.
+	for _, sub := range split.subs {
+		subArgs := sub.Args()
+		sub.(*SliceCmd).SetVal(subArgs[1:])
+		hash := ring.sharding.Hash(subArgs[1].(string))
+		for _, key := range subArgs[2:] {
+			if h := ring.sharding.Hash(key.(string)); h != hash {
+				t.Fatalf("got keys of shards %s and %s in one sub-command", hash, h)
+			}
+		}
+	}
+	if err := split.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cmd.Val(), keys) {
+		t.Fatalf("got %v, wanted %v", cmd.Val(), keys)
+	}
+
+	del := NewIntCmd(ctx, append([]interface{}{"del"}, keys...)...)
+	split = ring.splitMultiKeyCmd(ctx, del)
+	for _, sub := range split.subs {
+		sub.(*IntCmd).SetVal(int64(len(sub.Args()) - 1))
+	}
+	if err := split.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if del.Val() != 20 {
+		t.Fatalf("got %d, wanted 20", del.Val())
+	}
+
+	if split := ring.splitMultiKeyCmd(ctx, NewStatusCmd(ctx, "mset", "key1", "value", "key2")); split != nil {
+		t.Fatal("split MSET with odd number of arguments")
+	}
+}
+
+func TestKetamaHash(t *testing.T) {
+	// Vectors of the libketama continuum from the memd_4node ketama test
+	// data of the Couchbase clients (gocbcore testdata/memd_4node.exp.json).
+	hash := NewKetamaHash([]string{
+		"10.0.0.195:12000",
+		"localhost:12002",
+		"localhost:12004",
+		"localhost:12006",
+	})
+	vectors := []struct {
+		key, shard string
+	}{
+		{"Key_0", "10.0.0.195:12000"},
+		{"Key_1", "localhost:12006"},
+		{"Key_10", "localhost:12004"},
+		{"Key_100", "localhost:12004"},
+		{"Key_1000", "localhost:12006"},
+		{"Key_1001", "localhost:12002"},
+		{"Key_1002", "localhost:12004"},
+		{"Key_1006", "10.0.0.195:12000"},
+		{"Key_1007", "localhost:12006"},
+		{"Key_1008", "10.0.0.195:12000"},
+		{"Key_101", "localhost:12006"},
+		{"Key_1009", "localhost:12004"},
+	}
+	for _, v := range vectors {
+		if got := hash.Get(v.key); got != v.shard {
+			t.Errorf("%s: got %s, wanted %s", v.key, got, v.shard)
+		}
+	}
+
+	shards := hash.(ReplicatedConsistentHash).GetN("Key_1", 4)
+	if len(shards) != 4 || shards[0] != "localhost:12006" {
+		t.Fatalf("got %v, wanted 4 shards starting with localhost:12006", shards)
+	}
+}
+
+func TestJump(t *testing.T) {
+	// Vectors of the reference implementation.
+	vectors := []struct {
+		key     uint64
+		buckets int
+		bucket  int
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xDEAD10CC, 1, 0},
+		{0xDEAD10CC, 666, 361},
+		{256, 1024, 520},
+	}
+	for _, v := range vectors {
+		if got := jump(v.key, v.buckets); got != v.bucket {
+			t.Errorf("jump(%d, %d): got %d, wanted %d", v.key, v.buckets, got, v.bucket)
+		}
+	}
+
+	// Adding the last shard moves keys only to the new shard.
+	before := NewJumpHash([]string{"a", "b", "c"})
+	after := NewJumpHash([]string{"c", "b", "a", "d"})
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if got := after.Get(key); got != "d" && got != before.Get(key) {
+			t.Fatalf("%s moved from %s to %s", key, before.Get(key), got)
+		}
+	}
+}
+
+func TestMaglevHash(t *testing.T) {
+	shards := []string{"a", "b", "c", "d", "e"}
+	hash := NewMaglevHash(shards).(*maglevHash)
+
+	counts := make(map[int32]int)
+	for _, i := range hash.table {
+		counts[i]++
+	}
+	for i, shard := range shards {
+		// Maglev fills the table almost evenly.
+		if n := counts[int32(i)]; n < maglevTableSize/5-1 || n > maglevTableSize/5+1 {
+			t.Fatalf("shard %s got %d table entries", shard, n)
+		}
+	}
+
+	// Removing a shard moves few keys that belong to other shards.
+	after := NewMaglevHash(shards[:4])
+	var moved int
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if prev := hash.Get(key); prev != "e" && after.Get(key) != prev {
+			moved++
+		}
+	}
+	if moved > 1000 {
+		t.Fatalf("got %d keys moved, wanted less than 1000", moved)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		replicas := hash.GetN(key, 3)
+		if len(replicas) != 3 || replicas[0] != hash.Get(key) {
+			t.Fatalf("got %v, wanted 3 shards starting with %s", replicas, hash.Get(key))
+		}
+	}
+}
+
+func TestParseRingURL(t *testing.T) {
+	opt, err := ParseRingURL("redis://:secret@localhost:6390/2?addr=localhost:6391&consistent_hash=ketama&heartbeat_frequency=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]string{
+		"localhost:6390": "localhost:6390",
+		"localhost:6391": "localhost:6391",
+	}
+	if !reflect.DeepEqual(opt.Addrs, wanted) {
+		t.Fatalf("got %v, wanted %v", opt.Addrs, wanted)
+	}
+	if opt.Password != "secret" || opt.DB != 2 || opt.HeartbeatFrequency != time.Second {
+		t.Fatalf("got %+v", opt)
+	}
+	if _, ok := opt.NewConsistentHash([]string{"a"}).(*ketamaHash); !ok {
+		t.Fatal("wanted ketama hash")
+	}
+
+	for name, typ := range map[string]interface{}{
+		"rendezvous": rendezvousWrapper{},
+		"jump":       jumpHash{},
+		"maglev":     &maglevHash{},
+	} {
+		newHash, err := ConsistentHashByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reflect.TypeOf(newHash([]string{"a"})); got != reflect.TypeOf(typ) {
+			t.Fatalf("%s: got %s", name, got)
+		}
+	}
+
+	if _, err := ParseRingURL("redis://localhost:6390?consistent_hash=modulo"); err == nil {
+		t.Fatal("wanted an error for unknown consistent hash")
+	}
+}
+
+func TestRingShardOptions(t *testing.T) {
+	var mu sync.Mutex
+	dbs := map[string]int{"a": 1, "b": 2}
+
+	addrs := map[string]string{
+		"a": ":6390",
+		"b": ":6391",
+	}
+	ring := NewRing(&RingOptions{
+		Addrs: addrs,
+		DB:    5,
+		ShardOptions: func(name string, opt *Options) {
+			mu.Lock()
+			defer mu.Unlock()
+			if db, ok := dbs[name]; ok {
+				opt.DB = db
+			}
+			opt.Password = name + "-secret"
+		},
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	})
+	defer ring.Close()
+
+	a, b := ring.ShardByName("a"), ring.ShardByName("b")
+	if a.Client.Options().DB != 1 || b.Client.Options().DB != 2 || b.Client.Options().Password != "b-secret" {
+		t.Fatalf("got DB %d and %d, wanted 1 and 2", a.Client.Options().DB, b.Client.Options().DB)
+	}
+
+	mu.Lock()
+	dbs["b"] = 3
+	mu.Unlock()
+	ring.SetAddrs(addrs)
+
+	if ring.ShardByName("a") != a {
+		t.Fatal("shard a was recreated")
+	}
+	if got := ring.ShardByName("b"); got == b || got.Client.Options().DB != 3 {
+		t.Fatalf("shard b was not recreated with DB 3")
+	}
+
+	mu.Lock()
+	delete(dbs, "a")
+	mu.Unlock()
+	ring.SetAddrs(addrs)
+
+	if got := ring.ShardByName("a"); got.Client.Options().DB != 5 {
+		t.Fatalf("got DB %d, wanted the ring DB", got.Client.Options().DB)
+	}
+}
+
+func TestRingShardOptionsSameAddr(t *testing.T) {
+	dbs := map[string]int{"a": 1, "b": 2}
+	addrs := map[string]string{
+		"a": ":6390",
+		"b": ":6390",
+	}
+	ring := NewRing(&RingOptions{
+		Addrs: addrs,
+		ShardOptions: func(name string, opt *Options) {
+			opt.DB = dbs[name]
+		},
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	})
+	defer ring.Close()
+
+	a, b := ring.ShardByName("a"), ring.ShardByName("b")
+	if a == b || a.Client.Options().DB != 1 || b.Client.Options().DB != 2 {
+		t.Fatal("shards with the same address were not created by name")
+	}
+
+	ring.SetAddrs(addrs)
+	if ring.ShardByName("a") != a || ring.ShardByName("b") != b {
+		t.Fatal("shards were recreated")
+	}
+
+	ring.SetAddrs(map[string]string{"a": ":6390"})
+	if ring.ShardByName("a") != a {
+		t.Fatal("shard a was recreated")
+	}
+	if err := a.Client.Ping(context.Background()).Err(); err == ErrClosed {
+		t.Fatal("shard a was closed")
+	}
+	if err := b.Client.Ping(context.Background()).Err(); err != ErrClosed {
+		t.Fatalf("got %v, wanted shard b to be closed", err)
+	}
+}
+
+func TestRingHealthCheckEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	unhealthy := int32(0)
+
+	ring := NewRing(&RingOptions{
+		Addrs: map[string]string{
+			"a": ":6390",
+			"b": ":6391",
+		},
+		HeartbeatFrequency: 10 * time.Millisecond,
+		HealthCheck: func(ctx context.Context, name string, client *Client) error {
+			if name == "b" && atomic.LoadInt32(&unhealthy) == 1 {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+		OnEvent: func(ctx context.Context, event *RingEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch event.Type {
+			case RingRebalance:
+				events = append(events, fmt.Sprintf("%s %d", event.Type, len(event.LiveShards)))
+			default:
+				events = append(events, fmt.Sprintf("%s %s", event.Type, event.Shard))
+			}
+		},
+	})
+	defer ring.Close()
+
+	waitFor := func(want []string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			got := append([]string(nil), events...)
+			mu.Unlock()
+			if reflect.DeepEqual(got, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got events %q, wanted %q", got, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor([]string{"rebalance 2"})
+
+	atomic.StoreInt32(&unhealthy, 1)
+	waitFor([]string{"rebalance 2", "shard down b", "rebalance 1"})
+	if n := ring.Len(); n != 1 {
+		t.Fatalf("got %d shards, wanted 1", n)
+	}
+
+	atomic.StoreInt32(&unhealthy, 0)
+	waitFor([]string{"rebalance 2", "shard down b", "rebalance 1", "shard up b", "rebalance 2"})
+}
+
+func TestParseInfoMemory(t *testing.T) {
+	used, maxMemory, err := parseInfoMemory("# Memory\r\nused_memory:1024\r\nused_memory_human:1.00K\r\nmaxmemory:4096\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 1024 || maxMemory != 4096 {
+		t.Fatalf("got used=%d maxmemory=%d", used, maxMemory)
+	}
+
+	if _, _, err := parseInfoMemory("# Memory\r\n"); err == nil {
+		t.Fatal("expected an error without used_memory")
+	}
+}
+
+func BenchmarkRingShardingRebalanceLocked(b *testing.B) {
+	opts := &RingOptions{
+		Addrs: make(map[string]string),
+		// Disable heartbeat
+		HeartbeatFrequency: 1 * time.Hour,
+	}
+	for i := 0; i < 100; i++ {
+		opts.Addrs[fmt.Sprintf("shard%d", i)] = fmt.Sprintf(":63%02d", i)
+	}
+
+	ring := NewRing(opts)
+	defer ring.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ring.sharding.rebalanceLocked()
+	}
+}
+
+type testCounter struct {
+	mu sync.Mutex
+	t  *testing.T
+	m  map[string]int
+}
+
+func newTestCounter(t *testing.T) *testCounter {
+	return &testCounter{t: t, m: make(map[string]int)}
+}
+
+func (ct *testCounter) increment(key string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.m[key]++
+}
+
+func (ct *testCounter) expect(values map[string]int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.t.Helper()
+	if !reflect.DeepEqual(values, ct.m) {
+		ct.t.Errorf("expected %v != actual %v", values, ct.m)
+	}
+}
+
+func TestRingShardsCleanup(t *testing.T) {
+	const (
+		ringShard1Name = "ringShardOne"
+		ringShard2Name = "ringShardTwo"
+
+		ringShard1Addr = "shard1.test"
+		ringShard2Addr = "shard2.test"
+	)
+
+	t.Run("closes unused shards", func(t *testing.T) {
+		closeCounter := newTestCounter(t)
+
+		ring := NewRing(&RingOptions{
+			Addrs: map[string]string{
+				ringShard1Name: ringShard1Addr,
+				ringShard2Name: ringShard2Addr,
+			},
+			NewClient: func(opt *Options) *Client {
+				c := NewClient(opt)
+				c.baseClient.onClose = func() error {
+					closeCounter.increment(opt.Addr)
+					return nil
+				}
+				return c
+			},
+		})
+		closeCounter.expect(map[string]int{})
+
+		// no change due to the same addresses
+		ring.SetAddrs(map[string]string{
+			ringShard1Name: ringShard1Addr,
+			ringShard2Name: ringShard2Addr,
+		})
+		closeCounter.expect(map[string]int{})
+
+		ring.SetAddrs(map[string]string{
+			ringShard1Name: ringShard1Addr,
+		})
+		closeCounter.expect(map[string]int{ringShard2Addr: 1})
+
+		ring.SetAddrs(map[string]string{
+			ringShard2Name: ringShard2Addr,
+		})
+		closeCounter.expect(map[string]int{ringShard1Addr: 1, ringShard2Addr: 1})
+
+		ring.Close()
+		closeCounter.expect(map[string]int{ringShard1Addr: 1, ringShard2Addr: 2})
+	})
+
+	t.Run("closes created shards if ring was closed", func(t *testing.T) {
+		createCounter := newTestCounter(t)
+		closeCounter := newTestCounter(t)
+
+		var (
+			ring        *Ring
+			shouldClose int32
+		)
 
 		ring = NewRing(&RingOptions{
 			Addrs: map[string]string{
@@ -352,3 +1387,1021 @@ var _ = Describe("withConn", func() {
 		Expect(client.connPool.Len()).To(Equal(1))
 	})
 })
+
+func TestPubSubRouterRecoversPanics(t *testing.T) {
+	var handledErr error
+	router := NewPubSubRouter(nil, &PubSubRouterOptions{
+		OnHandled: func(ctx context.Context, msg *Message, latency time.Duration, err error) {
+			handledErr = err
+		},
+	})
+	route := &PubSubRoute{
+		router: router,
+		name:   "jobs",
+		handler: func(ctx context.Context, msg *Message) error {
+			panic("boom")
+		},
+	}
+
+	router.handle(context.Background(), route, &Message{Channel: "jobs"})
+	if handledErr == nil || !strings.Contains(handledErr.Error(), "boom") {
+		t.Fatalf("got %v, wanted the panic", handledErr)
+	}
+}
+
+func TestPubSubRouterChannels(t *testing.T) {
+	var mu sync.Mutex
+	var full []string
+	router := NewPubSubRouter(nil, &PubSubRouterOptions{
+		QueueSize: 2,
+		OnError: func(ctx context.Context, msg *Message, err error) {
+			if err == ErrPubSubRouterQueueFull {
+				mu.Lock()
+				full = append(full, msg.Payload)
+				mu.Unlock()
+			}
+		},
+	})
+	run := &pubSubRouterRun{
+		router: router,
+		ctx:    context.Background(),
+		queues: make(map[string]*pubSubRouterQueue),
+	}
+
+	release := make(chan struct{})
+	slow := &PubSubRoute{router: router, name: "slow", handler: func(ctx context.Context, msg *Message) error {
+		<-release
+		return nil
+	}}
+	var payloads []string
+	fast := &PubSubRoute{router: router, name: "fast", handler: func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		payloads = append(payloads, msg.Payload)
+		mu.Unlock()
+		return nil
+	}}
+
+	// The handler of the slow channel blocks one message, two wait in
+	// its queue and the last one is dropped.
+	for i := 0; i < 4; i++ {
+		run.dispatch(pubSubDelivery{msg: &Message{Channel: "slow", Payload: strconv.Itoa(i)}, routes: []*PubSubRoute{slow}})
+		if i == 0 {
+			// Let the goroutine take the first message.
+			for {
+				run.mu.Lock()
+				n := len(run.queues["slow"].deliveries)
+				run.mu.Unlock()
+				if n == 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	// The other channels are handled meanwhile, in order.
+	for i := 0; i < 2; i++ {
+		run.dispatch(pubSubDelivery{msg: &Message{Channel: "fast", Payload: strconv.Itoa(i)}, routes: []*PubSubRoute{fast}})
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(payloads)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the slow channel delays the others")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	run.wg.Wait()
+
+	if got := strings.Join(payloads, ","); got != "0,1" {
+		t.Fatalf("got %s, wanted the messages in order", got)
+	}
+	if len(full) != 1 || full[0] != "3" {
+		t.Fatalf("got %q dropped, wanted the last message of the slow channel", full)
+	}
+	if len(run.queues) != 0 {
+		t.Fatalf("got %d queues, wanted the idle queues to be removed", len(run.queues))
+	}
+}
+
+func TestParseKeyspaceEvent(t *testing.T) {
+	tests := []struct {
+		channel, payload string
+		want             KeyspaceEvent
+	}{
+		{"__keyspace@0__:user:1", "hset", KeyspaceEvent{DB: 0, Key: "user:1", Type: KeyspaceEventHSet}},
+		{"__keyevent@15__:expired", "session:abc", KeyspaceEvent{DB: 15, Key: "session:abc", Type: KeyspaceEventExpired}},
+		{"__keyspace@3__:a__:b", "xadd", KeyspaceEvent{DB: 3, Key: "a__:b", Type: KeyspaceEventXAdd}},
+	}
+	for _, test := range tests {
+		event, err := ParseKeyspaceEvent(test.channel, test.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *event != test.want {
+			t.Fatalf("%s: got %v, wanted %v", test.channel, event, test.want)
+		}
+	}
+
+	for _, channel := range []string{"mychannel", "__keyspace@x__:key", "__keyevent@0"} {
+		if _, err := ParseKeyspaceEvent(channel, "set"); err == nil {
+			t.Fatalf("%s: wanted an error", channel)
+		}
+	}
+}
+
+func TestNotifyKeyspaceEventsFlags(t *testing.T) {
+	if got := mergeNotifyFlags("Ex", "KEA"); got != "ExKA" {
+		t.Fatalf("got %q, wanted ExKA", got)
+	}
+	for flags, enabled := range map[string]bool{
+		"":    false,
+		"E":   false,
+		"KE":  false,
+		"Kx":  true,
+		"AKE": true,
+	} {
+		if got := keyspaceNotificationsEnabled(flags, false); got != enabled {
+			t.Fatalf("%q: got %v, wanted %v", flags, got, enabled)
+		}
+	}
+	if keyspaceNotificationsEnabled("Kx", true) || !keyspaceNotificationsEnabled("Ex", true) {
+		t.Fatal("wanted keyevent notifications to require E")
+	}
+}
+
+func TestKeyspaceOptionsPatterns(t *testing.T) {
+	tests := []struct {
+		opt  KeyspaceOptions
+		want []string
+	}{
+		{KeyspaceOptions{}, []string{"__keyspace@3__:*"}},
+		{KeyspaceOptions{DBs: []int{0, 1}, Keys: "user:*"}, []string{"__keyspace@0__:user:*", "__keyspace@1__:user:*"}},
+		{KeyspaceOptions{KeyEvents: true}, []string{"__keyevent@3__:*"}},
+		{
+			KeyspaceOptions{
+				KeyEvents: true,
+				DBs:       []int{0},
+				Types:     []KeyspaceEventType{KeyspaceEventExpired, KeyspaceEventDel},
+			},
+			[]string{"__keyevent@0__:expired", "__keyevent@0__:del"},
+		},
+	}
+	for _, test := range tests {
+		if got := test.opt.patterns(3); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("got %v, wanted %v", got, test.want)
+		}
+	}
+
+	opt := KeyspaceOptions{KeyEvents: true, Keys: "user:*"}
+	if err := opt.validate(); err == nil {
+		t.Fatal("wanted an error for Keys with KeyEvents")
+	}
+}
+
+func TestPubSubChannelOverflow(t *testing.T) {
+	ctx := context.Background()
+
+	newTestChannel := func(policy ChannelOverflowPolicy, dropped *[]string) *channel {
+		pubsub := &PubSub{opt: &Options{}}
+		pubsub.init()
+		c := newChannel(pubsub,
+			WithChannelSize(2),
+			WithChannelHealthCheckInterval(0),
+			WithChannelSendTimeout(time.Millisecond),
+			WithChannelOverflow(policy),
+			WithChannelOnDrop(func(msg *Message) {
+				*dropped = append(*dropped, msg.Payload)
+			}),
+		)
+		c.msgCh = make(chan *Message, c.chanSize)
+		return c
+	}
+	deliver := func(c *channel, payloads ...string) {
+		timer := time.NewTimer(time.Minute)
+		timer.Stop()
+		for _, payload := range payloads {
+			c.deliver(ctx, &Message{Channel: "mychannel", Payload: payload}, timer)
+		}
+	}
+	buffered := func(c *channel) []string {
+		var payloads []string
+		for len(c.msgCh) > 0 {
+			payloads = append(payloads, (<-c.msgCh).Payload)
+		}
+		return payloads
+	}
+
+	tests := []struct {
+		policy   ChannelOverflowPolicy
+		buffered []string
+		dropped  []string
+	}{
+		{ChannelOverflowBlock, []string{"1", "2"}, []string{"3", "4"}},
+		{ChannelOverflowDropNewest, []string{"1", "2"}, []string{"3", "4"}},
+		{ChannelOverflowDropOldest, []string{"3", "4"}, []string{"1", "2"}},
+		{ChannelOverflowDisconnect, []string{"1", "2"}, []string{"3", "4"}},
+	}
+	for _, test := range tests {
+		var dropped []string
+		c := newTestChannel(test.policy, &dropped)
+		deliver(c, "1", "2", "3", "4")
+
+		if got := buffered(c); !reflect.DeepEqual(got, test.buffered) {
+			t.Fatalf("policy %d: got %v buffered, wanted %v", test.policy, got, test.buffered)
+		}
+		if !reflect.DeepEqual(dropped, test.dropped) {
+			t.Fatalf("policy %d: got %v dropped, wanted %v", test.policy, dropped, test.dropped)
+		}
+
+		stats := c.pubSub.Stats()
+		if stats.Delivered != 2 || stats.Dropped != 2 {
+			t.Fatalf("policy %d: got %+v", test.policy, stats)
+		}
+		if closed := c.pubSub.closed; closed != (test.policy == ChannelOverflowDisconnect) {
+			t.Fatalf("policy %d: got closed=%v", test.policy, closed)
+		}
+	}
+}
+
+func TestPubSubLifecycleCallbacks(t *testing.T) {
+	ctx := context.Background()
+
+	var failSubscribe bool
+	pubsub := &PubSub{
+		opt: &Options{WriteTimeout: time.Second},
+		newConn: func(ctx context.Context, _ []string) (*pool.Conn, error) {
+			client, server := net.Pipe()
+			if failSubscribe {
+				_ = server.Close()
+			} else {
+				go func() {
+					buf := make([]byte, 1024)
+					for {
+						if _, err := server.Read(buf); err != nil {
+							return
+						}
+					}
+				}()
+			}
+			return pool.NewConn(client), nil
+		},
+		closeConn: func(cn *pool.Conn) error {
+			return cn.Close()
+		},
+		channels: map[string]struct{}{"mychannel": {}},
+	}
+	pubsub.init()
+
+	var events []string
+	pubsub.OnDisconnect(func(ctx context.Context, reason error) {
+		events = append(events, "disconnect: "+reason.Error())
+	})
+	pubsub.OnReconnect(func(ctx context.Context, downtime time.Duration) {
+		if downtime < 0 {
+			t.Errorf("got negative downtime %s", downtime)
+		}
+		events = append(events, "reconnect")
+		// The callbacks are called outside the lock, so they can use the PubSub.
+		if err := pubsub.Subscribe(ctx, "otherchannel"); err != nil {
+			t.Errorf("got %v, wanted nil", err)
+		}
+	})
+	pubsub.OnResubscribeError(func(ctx context.Context, err error) {
+		events = append(events, "resubscribe error")
+	})
+
+	if _, err := pubsub.connWithLock(ctx); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("got %q for the first connection, wanted no events", events)
+	}
+
+	failSubscribe = true
+	pubsub.mu.Lock()
+	pubsub.reconnect(ctx, errors.New("boom"))
+	pubsub.unlock()
+
+	failSubscribe = false
+	if _, err := pubsub.connWithLock(ctx); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+
+	wanted := []string{"disconnect: boom", "resubscribe error", "reconnect"}
+	if !reflect.DeepEqual(events, wanted) {
+		t.Fatalf("got %q, wanted %q", events, wanted)
+	}
+	if _, ok := pubsub.channels["otherchannel"]; !ok {
+		t.Fatalf("got %v, wanted otherchannel to be subscribed", pubsub.channels)
+	}
+
+	events = nil
+	if err := pubsub.Close(); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("got %q on Close, wanted no events", events)
+	}
+}
+
+func TestPubSubMux(t *testing.T) {
+	ctx := context.Background()
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	connPool := pool.NewConnPool(&pool.Options{
+		Dialer: func(context.Context) (net.Conn, error) {
+			return nil, errors.New("dial is disabled")
+		},
+		PoolSize: 1,
+	})
+	defer connPool.Close()
+
+	base := &baseClient{opt: &Options{}, connPool: connPool}
+	mux := newPubSubMux(base)
+	conn := &pubSubMuxConn{cn: pool.NewConn(client)}
+	mux.conn = conn
+	go mux.listen(conn)
+
+	// The server confirms subscriptions like Redis, or rejects them.
+	var writeMu sync.Mutex
+	write := func(s string) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, _ = server.Write([]byte(s))
+	}
+	var reject int32
+	cmds := make(chan []interface{}, 10)
+	go func() {
+		rd := proto.NewReader(server)
+		counts := make(map[string]int)
+		for {
+			reply, err := rd.ReadReply()
+			if err != nil {
+				return
+			}
+			cmd := reply.([]interface{})
+			kind := cmd[0].(string)
+			switch kind {
+			case "subscribe", "unsubscribe":
+				if atomic.LoadInt32(&reject) == 1 {
+					write("-NOPERM no permissions to access a channel\r\n")
+					break
+				}
+				for _, name := range cmd[1:] {
+					if kind == "subscribe" {
+						counts[name.(string)]++
+					} else {
+						delete(counts, name.(string))
+					}
+					write(fmt.Sprintf(">3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n",
+						len(kind), kind, len(name.(string)), name, len(counts)))
+				}
+			}
+			if kind != "subscribe" || len(cmd) <= 10 {
+				cmds <- cmd
+			}
+		}
+	}()
+	expectCmd := func(wanted ...interface{}) {
+		t.Helper()
+		select {
+		case cmd := <-cmds:
+			if !reflect.DeepEqual(cmd, wanted) {
+				t.Fatalf("got %q, wanted %q", cmd, wanted)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got no command, wanted %q", wanted)
+		}
+	}
+	expectMsg := func(pubsub *PubSub, wanted interface{}) {
+		t.Helper()
+		msg, err := pubsub.ReceiveTimeout(ctx, time.Second)
+		if err != nil {
+			t.Fatalf("got %v, wanted nil", err)
+		}
+		if !reflect.DeepEqual(msg, wanted) {
+			t.Fatalf("got %v, wanted %v", msg, wanted)
+		}
+	}
+
+	pubsub1 := mux.pubSub()
+	pubsub2 := mux.pubSub()
+
+	if err := pubsub1.Subscribe(ctx, "mychannel"); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectCmd("subscribe", "mychannel")
+	expectMsg(pubsub1, &Subscription{Kind: "subscribe", Channel: "mychannel", Count: 1})
+
+	if err := pubsub2.Subscribe(ctx, "mychannel", "other"); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectCmd("subscribe", "other")
+	expectMsg(pubsub2, &Subscription{Kind: "subscribe", Channel: "mychannel", Count: 1})
+	expectMsg(pubsub2, &Subscription{Kind: "subscribe", Channel: "other", Count: 2})
+
+	pingErr := make(chan error, 1)
+	go func() {
+		pingErr <- pubsub2.Ping(ctx, "hi")
+	}()
+	expectCmd("ping", "hi")
+
+	write(">3\r\n$7\r\nmessage\r\n$9\r\nmychannel\r\n$5\r\nhello\r\n$2\r\nhi\r\n")
+	expectMsg(pubsub1, &Message{Channel: "mychannel", Payload: "hello"})
+	expectMsg(pubsub2, &Message{Channel: "mychannel", Payload: "hello"})
+
+	if err := <-pingErr; err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectMsg(pubsub2, &Pong{Payload: "hi"})
+
+	// The error reply of SUBSCRIBE is returned and isn't taken for
+	// the reply of PING.
+	atomic.StoreInt32(&reject, 1)
+	if err := pubsub1.Subscribe(ctx, "denied"); !isRedisError(err) {
+		t.Fatalf("got %v, wanted the NOPERM error", err)
+	}
+	expectCmd("subscribe", "denied")
+	atomic.StoreInt32(&reject, 0)
+	if _, ok := pubsub1.channels["denied"]; ok {
+		t.Fatal("got the denied channel, wanted it to be removed")
+	}
+	if _, ok := mux.channels["denied"]; ok {
+		t.Fatal("got the denied channel in the mux, wanted it to be removed")
+	}
+
+	go func() {
+		pingErr <- pubsub1.Ping(ctx, "first")
+	}()
+	expectCmd("ping", "first")
+	write("$5\r\nfirst\r\n")
+	if err := <-pingErr; err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectMsg(pubsub1, &Pong{Payload: "first"})
+
+	// The reply of a cancelled PING is discarded.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		pingErr <- pubsub1.Ping(cancelCtx, "cancelled")
+	}()
+	expectCmd("ping", "cancelled")
+	cancel()
+	if err := <-pingErr; err != context.Canceled {
+		t.Fatalf("got %v, wanted %v", err, context.Canceled)
+	}
+	go func() {
+		pingErr <- pubsub1.Ping(ctx, "second")
+	}()
+	expectCmd("ping", "second")
+	write("$9\r\ncancelled\r\n$6\r\nsecond\r\n")
+	if err := <-pingErr; err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectMsg(pubsub1, &Pong{Payload: "second"})
+
+	// Subscribing to more channels than the queue holds doesn't block.
+	pubsub3 := mux.pubSub()
+	channels := make([]string, 150)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("channel%d", i)
+	}
+	subErr := make(chan error, 1)
+	go func() {
+		subErr <- pubsub3.Subscribe(ctx, channels...)
+	}()
+	select {
+	case err := <-subErr:
+		if err != nil {
+			t.Fatalf("got %v, wanted nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe is blocked")
+	}
+	for i, channel := range channels {
+		expectMsg(pubsub3, &Subscription{Kind: "subscribe", Channel: channel, Count: i + 1})
+	}
+
+	// The commands of the client share the connection, except the
+	// blocking ones.
+	getErr := make(chan error, 1)
+	get := NewStringCmd(ctx, "get", "key")
+	go func() {
+		getErr <- mux.process(ctx, base, get)
+	}()
+	expectCmd("get", "key")
+	write("$5\r\nvalue\r\n")
+	if err := <-getErr; err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if get.Val() != "value" {
+		t.Fatalf("got %q, wanted value", get.Val())
+	}
+	blpop := NewStringSliceCmd(ctx, "blpop", "list", 0)
+	blpop.setReadTimeout(0)
+	if err := mux.process(ctx, base, blpop); err == nil || err.Error() != "dial is disabled" {
+		t.Fatalf("got %v, wanted the pool to be used", err)
+	}
+
+	// A PubSub that doesn't receive its messages doesn't block the others.
+	slow := mux.pubSub()
+	if err := slow.Subscribe(ctx, "mychannel"); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	expectMsg(slow, &Subscription{Kind: "subscribe", Channel: "mychannel", Count: 1})
+	for i := 0; i <= pubSubMuxQueueSize; i++ {
+		write(">3\r\n$7\r\nmessage\r\n$9\r\nmychannel\r\n$4\r\nslow\r\n")
+	}
+	// The reply is read after the messages were dispatched.
+	go func() {
+		getErr <- mux.process(ctx, base, get)
+	}()
+	expectCmd("get", "key")
+	write("$5\r\nvalue\r\n")
+	if err := <-getErr; err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if err := pubsub1.Close(); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if dropped := slow.Stats().Dropped; dropped != 1 {
+		t.Fatalf("got %d dropped messages, wanted 1", dropped)
+	}
+	if err := slow.Close(); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+
+	if err := pubsub2.Unsubscribe(ctx); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+	if err := pubsub3.Close(); err != nil {
+		t.Fatalf("got %v, wanted nil", err)
+	}
+
+	// Without subscriptions the connection is closed and the commands
+	// use the pool.
+	for i := 0; ; i++ {
+		mux.mu.Lock()
+		closed := mux.conn == nil && conn.closing && len(conn.pending) == 0
+		mux.mu.Unlock()
+		if closed {
+			break
+		}
+		if i == 100 {
+			t.Fatal("got the connection open, wanted it to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := mux.process(ctx, base, NewStatusCmd(ctx, "ping")); err == nil || err.Error() != "dial is disabled" {
+		t.Fatalf("got %v, wanted the pool to be used", err)
+	}
+}
+
+func TestPubSubMuxRESP2(t *testing.T) {
+	ctx := context.Background()
+
+	// The server doesn't know HELLO, so the connection stays on RESP2.
+	client := NewClient(&Options{
+		MultiplexPubSub: true,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				rd := proto.NewReader(server)
+				for {
+					reply, err := rd.ReadReply()
+					if err != nil {
+						return
+					}
+					resp := "+OK\r\n"
+					if strings.ToLower(reply.([]interface{})[0].(string)) == "hello" {
+						resp = "-ERR unknown command 'HELLO'\r\n"
+					}
+					if _, err := server.Write([]byte(resp)); err != nil {
+						return
+					}
+				}
+			}()
+			return client, nil
+		},
+	})
+	defer client.Close()
+
+	pubsub := client.Subscribe(ctx)
+	if pubsub.muxed == nil {
+		t.Fatal("got a dedicated PubSub, wanted a multiplexed one")
+	}
+	if err := pubsub.Subscribe(ctx, "mychannel"); err != errPubSubMuxRESP2 {
+		t.Fatalf("got %v, wanted %v", err, errPubSubMuxRESP2)
+	}
+	_ = pubsub.Close()
+
+	pubsub = client.Subscribe(ctx)
+	defer pubsub.Close()
+	if pubsub.muxed != nil {
+		t.Fatal("got a multiplexed PubSub, wanted a dedicated one")
+	}
+}
+
+func TestXRangeIteratorTailContext(t *testing.T) {
+	// The server has no entries, and XREAD waits for its BLOCK timeout.
+	xread := make(chan []interface{}, 10)
+	client := NewClient(&Options{
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				rd := proto.NewReader(server)
+				for {
+					reply, err := rd.ReadReply()
+					if err != nil {
+						return
+					}
+					cmd := reply.([]interface{})
+					resp := "+OK\r\n"
+					switch strings.ToLower(cmd[0].(string)) {
+					case "hello":
+						resp = "-ERR unknown command 'HELLO'\r\n"
+					case "xrange":
+						resp = "*0\r\n"
+					case "xread":
+						xread <- cmd
+						block, _ := strconv.Atoi(cmd[4].(string))
+						time.Sleep(time.Duration(block) * time.Millisecond)
+						resp = "*-1\r\n"
+					}
+					if _, err := server.Write([]byte(resp)); err != nil {
+						return
+					}
+				}
+			}()
+			return client, nil
+		},
+	})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it := NewXRangeIterator(client, &XRangeIteratorArgs{Stream: "mystream", Tail: true})
+	done := make(chan bool, 1)
+	go func() {
+		done <- it.Next(ctx)
+	}()
+
+	cmd := <-xread
+	if block := cmd[3:5]; block[0] != "block" || block[1] != "1000" {
+		t.Fatalf("got %v, wanted a finite default BLOCK", cmd)
+	}
+	cancel()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("Next returned an entry")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Next ignores the context")
+	}
+	if err := it.Err(); err != context.Canceled {
+		t.Fatalf("got %v, wanted %v", err, context.Canceled)
+	}
+}
+
+func TestXPrevID(t *testing.T) {
+	tests := []struct {
+		start string
+		id    string
+	}{
+		{"-", "0-0"},
+		{"(1000-5", "1000-5"},
+		{"1000-5", "1000-4"},
+		{"1000-0", "999-18446744073709551615"},
+		{"1000", "999-18446744073709551615"},
+		{"0", "0-0"},
+	}
+	for _, test := range tests {
+		if id := xPrevID(test.start); id != test.id {
+			t.Errorf("xPrevID(%q) = %q, wanted %q", test.start, id, test.id)
+		}
+	}
+}
+
+func TestAppendStructFieldNested(t *testing.T) {
+	type Address struct {
+		City string `redis:"city,omitempty"`
+	}
+	type Base struct {
+		ID int `redis:"id"`
+	}
+	type User struct {
+		Base
+		Name     string    `redis:"name"`
+		At       time.Time `redis:"at"`
+		Home     Address   `redis:"home"`
+		Work     *Address  `redis:"work"`
+		Untagged Address
+	}
+
+	at := time.Unix(0, 0)
+	args := appendArg(nil, &User{
+		Base: Base{ID: 1},
+		Name: "alice",
+		At:   at,
+		Home: Address{City: "Paris"},
+		Work: &Address{},
+	})
+	wanted := []interface{}{"id", int64(1), "name", "alice", "at", at, "home.city", "Paris"}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+}
+
+func TestAppendStructFieldOptions(t *testing.T) {
+	type User struct {
+		Name    string     `redis:"name,omitempty"`
+		Age     *int       `redis:"age"`
+		Score   *int       `redis:"score"`
+		Born    time.Time  `redis:"born,layout=DateOnly"`
+		Seen    *time.Time `redis:"seen,layout=unix"`
+		Deleted time.Time  `redis:"deleted,omitempty"`
+		Role    string     `redis:"role,default=user"`
+	}
+
+	age := 0
+	seen := time.Unix(1700000000, 0)
+	args := appendArg(nil, &User{
+		Age:  &age,
+		Born: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		Seen: &seen,
+	})
+	wanted := []interface{}{"age", int64(0), "born", "2000-01-02", "seen", "1700000000", "role", ""}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+}
+
+// binaryPoint is written and scanned as one value, even though its
+// fields are tagged.
+type binaryPoint struct {
+	X int `redis:"x"`
+	Y int `redis:"y"`
+}
+
+func (p binaryPoint) MarshalBinary() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func (p *binaryPoint) UnmarshalBinary(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+func TestStructFieldBinaryMarshaler(t *testing.T) {
+	type Place struct {
+		Name  string       `redis:"name"`
+		Point binaryPoint  `redis:"point"`
+		Prev  *binaryPoint `redis:"prev"`
+	}
+
+	place := Place{Name: "home", Point: binaryPoint{1, 2}, Prev: &binaryPoint{3, 4}}
+	args, _, err := StructToArgs(&place, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []interface{}{"name", "home", "point", binaryPoint{1, 2}, "prev", &binaryPoint{3, 4}}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+
+	values := map[string]string{"name": "home", "point": "1,2", "prev": "3,4"}
+	var got Place
+	if err := NewMapStringStringResult(values, nil).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, place) {
+		t.Fatalf("got %v, wanted %v", got, place)
+	}
+}
+
+func TestStructToArgsCycle(t *testing.T) {
+	type Node struct {
+		Name string `redis:"name"`
+		Next *Node  `redis:"next"`
+	}
+
+	n := &Node{Name: "first"}
+	n.Next = n
+	args, _, err := StructToArgs(n, &StructToArgsOptions{Fields: []string{"name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []interface{}{"name", "first"}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+}
+
+func TestHSetStructArgs(t *testing.T) {
+	args := hsetStructArgs("hset", "key", []interface{}{"name", "alice"}, nil)
+	wanted := []interface{}{"hset", "key", "name", "alice"}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+
+	// The removed fields are deleted by the same script.
+	args = hsetStructArgs("hmset", "key", []interface{}{"name", "alice"}, []string{"age", "comment"})
+	wanted = []interface{}{"eval", hsetStructScript, 1, "key", "hmset", 2, "age", "comment", "name", "alice"}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+	if pos := cmdFirstKeyPos(NewIntCmd(context.Background(), args...)); pos != 3 {
+		t.Fatalf("got key position %d, wanted 3", pos)
+	}
+}
+
+type textLevel int
+
+func (l textLevel) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("level-%d", int(l))), nil
+}
+
+func TestStructToArgs(t *testing.T) {
+	type Status string
+	type Address struct {
+		City string `redis:"city"`
+	}
+	type User struct {
+		Name   string    `redis:"name"`
+		Status Status    `redis:"status"`
+		Level  textLevel `redis:"level"`
+		Home   Address   `redis:"home"`
+		Age    *int      `redis:"age,omitempty"`
+	}
+
+	age := 30
+	u := User{
+		Name:   "alice",
+		Status: "active",
+		Level:  2,
+		Home:   Address{City: "Paris"},
+		Age:    &age,
+	}
+
+	args, removed, err := StructToArgs(&u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []interface{}{
+		"name", "alice",
+		"status", "active",
+		"level", textMarshaler{textLevel(2)},
+		"home.city", "Paris",
+		"age", int64(30),
+	}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+
+	args, _, err = StructToArgs(u, &StructToArgsOptions{Fields: []string{"home.city", "age", "unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted = []interface{}{"home.city", "Paris", "age", int64(30)}
+	if !reflect.DeepEqual(args, wanted) {
+		t.Fatalf("got %v, wanted %v", args, wanted)
+	}
+
+	prev := u
+	prevAge := 29
+	prev.Age = &prevAge
+	prev.Home.City = "Lyon"
+	args, removed, err = StructToArgs(&u, &StructToArgsOptions{Prev: &prev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted = []interface{}{"home.city", "Paris", "age", int64(30)}
+	if !reflect.DeepEqual(args, wanted) || removed != nil {
+		t.Fatalf("got %v and removed %v, wanted %v", args, removed, wanted)
+	}
+
+	// Fields that became missing are removed.
+	cleared := u
+	cleared.Age = nil
+	cleared.Name = ""
+	args, removed, err = StructToArgs(&cleared, &StructToArgsOptions{Prev: &u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted = []interface{}{"name", ""}
+	if !reflect.DeepEqual(args, wanted) || !reflect.DeepEqual(removed, []string{"age"}) {
+		t.Fatalf("got %v and removed %v, wanted %v and removed age", args, removed, wanted)
+	}
+	_, removed, err = StructToArgs(&cleared, &StructToArgsOptions{Prev: &u, Fields: []string{"name"}})
+	if err != nil || removed != nil {
+		t.Fatalf("got removed %v and %v, wanted none", removed, err)
+	}
+
+	if _, _, err := StructToArgs(&u, &StructToArgsOptions{Prev: &Address{}}); err == nil {
+		t.Fatal("expected an error for a Prev of another type")
+	}
+	if _, _, err := StructToArgs("user", nil); err == nil {
+		t.Fatal("expected an error for a non-struct")
+	}
+}
+
+func TestClusterShardedPubSubSSubscribe(t *testing.T) {
+	var once sync.Once
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	opt := &ClusterOptions{
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			once.Do(func() { close(dialing) })
+			<-release
+			return nil, errors.New("dial is disabled")
+		},
+		MaxRetries: -1,
+	}
+	opt.init()
+
+	nodes := newClusterNodes(opt)
+	defer nodes.Close()
+	state, err := newClusterState(nodes, []ClusterSlot{{
+		Start: 0,
+		End:   16383,
+		Nodes: []ClusterNode{{Addr: "10.0.0.1:7000"}},
+	}}, "10.0.0.1:7000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ClusterClient{opt: opt, nodes: nodes}
+	c.state = newClusterStateHolder(func(context.Context) (*clusterState, error) {
+		return state, nil
+	})
+
+	pubsub := c.shardedPubSub()
+	defer pubsub.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pubsub.SSubscribe(context.Background(), "mychannel")
+	}()
+	<-dialing
+
+	// SSUBSCRIBE is in flight, which must not block other callers.
+	done := make(chan string, 1)
+	go func() {
+		_ = pubsub.Unsubscribe(context.Background(), "other")
+		done <- pubsub.String()
+	}()
+	select {
+	case s := <-done:
+		if s != "PubSub(mychannel)" {
+			t.Fatalf("got %q, wanted PubSub(mychannel)", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SSubscribe blocks other callers")
+	}
+
+	close(release)
+	if err := <-errCh; err == nil {
+		t.Fatal("expected an error")
+	}
+	if s := pubsub.String(); s != "PubSub()" {
+		t.Fatalf("got %q, wanted the failed channel to be forgotten", s)
+	}
+}
+
+func TestClusterShardedPubSubReceiveContext(t *testing.T) {
+	opt := &ClusterOptions{}
+	opt.init()
+	pubsub := (&ClusterClient{opt: opt}).shardedPubSub()
+	defer pubsub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := pubsub.Receive(ctx)
+		errCh <- err
+	}()
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("got %v, wanted %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Receive ignores the context")
+	}
+}
@@ -2,6 +2,12 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ScanIterator is used to incrementally iterate over a collection of elements.
@@ -64,3 +70,233 @@ func (it *ScanIterator) Val() string {
 	}
 	return v
 }
+
+// ScanAllIterator is used to incrementally iterate over the keys
+// of several servers, for example all shards of a Ring.
+type ScanAllIterator struct {
+	clients []*Client
+	scan    func(ctx context.Context, client *Client) *ScanCmd
+	// keep reports whether the key scanned on the i-th client is returned.
+	keep func(i int, key string) bool
+
+	pos int
+	it  *ScanIterator
+	err error
+}
+
+// Err returns the last iterator error, if any.
+func (it *ScanAllIterator) Err() error {
+	return it.err
+}
+
+// Next advances the cursor and returns true if more values can be read.
+func (it *ScanAllIterator) Next(ctx context.Context) bool {
+	for it.err == nil && it.pos < len(it.clients) {
+		if it.it == nil {
+			it.it = it.scan(ctx, it.clients[it.pos]).Iterator()
+			if err := it.it.Err(); err != nil {
+				it.err = err
+				return false
+			}
+		}
+
+		for it.it.Next(ctx) {
+			if it.keep == nil || it.keep(it.pos, it.it.Val()) {
+				return true
+			}
+		}
+		if err := it.it.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		it.pos++
+		it.it = nil
+	}
+	return false
+}
+
+// Val returns the key at the current cursor position.
+func (it *ScanAllIterator) Val() string {
+	if it.err != nil || it.it == nil {
+		return ""
+	}
+	return it.it.Val()
+}
+
+// XRangeIterator is used to incrementally iterate over the entries of
+// a stream. It is returned by NewXRangeIterator.
+type XRangeIterator struct {
+	client Cmdable
+	args   XRangeIteratorArgs
+
+	// start and end are the bounds of the next page.
+	start string
+	end   string
+	// done is set when the range is exhausted.
+	done bool
+	// lastID is the ID of the last fetched entry.
+	lastID string
+
+	page []XMessage
+	pos  int
+	err  error
+}
+
+// NewXRangeIterator returns an iterator over the entries of the stream
+// that fetches pages with XRANGE or XREVRANGE using the client.
+func NewXRangeIterator(client Cmdable, a *XRangeIteratorArgs) *XRangeIterator {
+	it := &XRangeIterator{
+		client: client,
+		args:   *a,
+		start:  a.Start,
+		end:    a.End,
+	}
+	if !a.StartTime.IsZero() {
+		it.start = strconv.FormatInt(a.StartTime.UnixMilli(), 10)
+	}
+	if !a.EndTime.IsZero() {
+		it.end = strconv.FormatInt(a.EndTime.UnixMilli(), 10)
+	}
+	if it.args.Tail && (it.args.Reverse || (it.end != "" && it.end != "+")) {
+		it.err = errors.New("redis: XRangeIterator Tail can't be used with Reverse or End")
+	}
+	if it.start == "" {
+		it.start = "-"
+	}
+	if it.end == "" {
+		it.end = "+"
+	}
+	if it.args.Count <= 0 {
+		it.args.Count = 100
+	}
+	if it.args.Tail && it.args.Block <= 0 {
+		it.args.Block = time.Second
+	}
+	return it
+}
+
+// Err returns the last iterator error, if any.
+func (it *XRangeIterator) Err() error {
+	return it.err
+}
+
+// Next advances the cursor and returns true if more values can be read.
+// In Tail mode it waits for new entries once the end of the stream is reached.
+func (it *XRangeIterator) Next(ctx context.Context) bool {
+	for it.err == nil {
+		if it.pos < len(it.page) {
+			it.pos++
+			return true
+		}
+		if it.done && !it.args.Tail {
+			return false
+		}
+
+		if it.done {
+			// XREAD doesn't see the context unless ContextTimeoutEnabled
+			// is set, so it is checked between the reads.
+			if err := ctx.Err(); err != nil {
+				it.err = err
+				return false
+			}
+			it.fetchTail(ctx)
+		} else {
+			it.fetchRange(ctx)
+		}
+	}
+	return false
+}
+
+func (it *XRangeIterator) fetchRange(ctx context.Context) {
+	var cmd *XMessageSliceCmd
+	if it.args.Reverse {
+		cmd = it.client.XRevRangeN(ctx, it.args.Stream, it.end, it.start, it.args.Count)
+	} else {
+		cmd = it.client.XRangeN(ctx, it.args.Stream, it.start, it.end, it.args.Count)
+	}
+	msgs, err := cmd.Result()
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	it.page, it.pos = msgs, 0
+	if len(msgs) > 0 {
+		it.lastID = msgs[len(msgs)-1].ID
+		if it.args.Reverse {
+			it.end = "(" + it.lastID
+		} else {
+			it.start = "(" + it.lastID
+		}
+	}
+	if int64(len(msgs)) < it.args.Count {
+		it.done = true
+	}
+}
+
+func (it *XRangeIterator) fetchTail(ctx context.Context) {
+	if it.lastID == "" {
+		it.lastID = xPrevID(it.start)
+	}
+
+	streams, err := it.client.XRead(ctx, &XReadArgs{
+		Streams: []string{it.args.Stream, it.lastID},
+		Count:   it.args.Count,
+		Block:   it.args.Block,
+	}).Result()
+	if err == Nil {
+		return
+	}
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	it.page, it.pos = nil, 0
+	if len(streams) > 0 {
+		it.page = streams[0].Messages
+	}
+	if len(it.page) > 0 {
+		it.lastID = it.page[len(it.page)-1].ID
+	}
+}
+
+// Val returns the entry at the current cursor position.
+func (it *XRangeIterator) Val() XMessage {
+	var v XMessage
+	if it.err == nil && it.pos > 0 && it.pos <= len(it.page) {
+		v = it.page[it.pos-1]
+	}
+	return v
+}
+
+// xPrevID returns the ID that XREAD reads after to return the entries
+// starting at the range start.
+func xPrevID(start string) string {
+	if start == "-" {
+		return "0-0"
+	}
+	if strings.HasPrefix(start, "(") {
+		return start[1:]
+	}
+
+	msPart, seqPart, hasSeq := strings.Cut(start, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return start
+	}
+	if hasSeq {
+		seq, err := strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return start
+		}
+		if seq > 0 {
+			return fmt.Sprintf("%d-%d", ms, seq-1)
+		}
+	}
+	if ms == 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("%d-%d", ms-1, uint64(math.MaxUint64))
+}
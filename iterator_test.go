@@ -1,7 +1,9 @@
 package redis_test
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
@@ -134,3 +136,137 @@ var _ = Describe("ScanIterator", func() {
 		Expect(vals).To(HaveLen(2))
 	})
 })
+
+var _ = Describe("XRangeIterator", func() {
+	var client *redis.Client
+	var ids []string
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+		ids = nil
+		for i := 1; i <= 5; i++ {
+			id, err := client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "mystream",
+				ID:     fmt.Sprintf("%d-0", i*1000),
+				Values: []string{"n", fmt.Sprint(i)},
+			}).Result()
+			Expect(err).NotTo(HaveOccurred())
+			ids = append(ids, id)
+		}
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	collect := func(it *redis.XRangeIterator) []string {
+		var got []string
+		for it.Next(ctx) {
+			got = append(got, it.Val().ID)
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		return got
+	}
+
+	It("iterates across pages", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream: "mystream",
+			Count:  2,
+		})
+		Expect(collect(it)).To(Equal(ids))
+	})
+
+	It("iterates in reverse", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream:  "mystream",
+			Count:   2,
+			Reverse: true,
+		})
+		Expect(collect(it)).To(Equal([]string{ids[4], ids[3], ids[2], ids[1], ids[0]}))
+	})
+
+	It("iterates by time", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream:    "mystream",
+			StartTime: time.UnixMilli(2000),
+			EndTime:   time.UnixMilli(4000),
+			Count:     2,
+		})
+		Expect(collect(it)).To(Equal(ids[1:4]))
+	})
+
+	It("tails the stream", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream: "mystream",
+			Start:  ids[3],
+			Count:  2,
+			Tail:   true,
+			Block:  100 * time.Millisecond,
+		})
+
+		for _, id := range ids[3:] {
+			Expect(it.Next(ctx)).To(BeTrue())
+			Expect(it.Val().ID).To(Equal(id))
+		}
+
+		go func() {
+			defer GinkgoRecover()
+
+			time.Sleep(200 * time.Millisecond)
+			err := client.XAdd(ctx, &redis.XAddArgs{
+				Stream: "mystream",
+				ID:     "6000-0",
+				Values: []string{"n", "6"},
+			}).Err()
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		Expect(it.Next(ctx)).To(BeTrue())
+		Expect(it.Val().ID).To(Equal("6000-0"))
+		Expect(it.Val().Values).To(Equal(map[string]interface{}{"n": "6"}))
+	})
+
+	It("tails an empty range from the start", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream: "mystream",
+			Start:  "7000",
+			Tail:   true,
+		})
+
+		Expect(client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "mystream",
+			ID:     "7000-0",
+			Values: []string{"n", "7"},
+		}).Err()).NotTo(HaveOccurred())
+
+		Expect(it.Next(ctx)).To(BeTrue())
+		Expect(it.Val().ID).To(Equal("7000-0"))
+	})
+
+	It("stops tailing when the context is canceled", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream: "mystream",
+			Start:  "8000",
+			Tail:   true,
+			Block:  100 * time.Millisecond,
+		})
+
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(200*time.Millisecond, cancel)
+
+		Expect(it.Next(ctx)).To(BeFalse())
+		Expect(it.Err()).To(Equal(context.Canceled))
+	})
+
+	It("fails in Tail mode with an end", func() {
+		it := redis.NewXRangeIterator(client, &redis.XRangeIteratorArgs{
+			Stream: "mystream",
+			End:    ids[2],
+			Tail:   true,
+		})
+		Expect(it.Next(ctx)).To(BeFalse())
+		Expect(it.Err()).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,341 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9/internal"
+)
+
+// KeyspaceEventType is the type of a keyspace notification,
+// for example "set", "del" or "expired".
+type KeyspaceEventType string
+
+const (
+	KeyspaceEventSet        KeyspaceEventType = "set"
+	KeyspaceEventDel        KeyspaceEventType = "del"
+	KeyspaceEventExpire     KeyspaceEventType = "expire"
+	KeyspaceEventExpired    KeyspaceEventType = "expired"
+	KeyspaceEventEvicted    KeyspaceEventType = "evicted"
+	KeyspaceEventRenameFrom KeyspaceEventType = "rename_from"
+	KeyspaceEventRenameTo   KeyspaceEventType = "rename_to"
+	KeyspaceEventIncrBy     KeyspaceEventType = "incrby"
+	KeyspaceEventAppend     KeyspaceEventType = "append"
+	KeyspaceEventLPush      KeyspaceEventType = "lpush"
+	KeyspaceEventRPush      KeyspaceEventType = "rpush"
+	KeyspaceEventLPop       KeyspaceEventType = "lpop"
+	KeyspaceEventRPop       KeyspaceEventType = "rpop"
+	KeyspaceEventSAdd       KeyspaceEventType = "sadd"
+	KeyspaceEventSRem       KeyspaceEventType = "srem"
+	KeyspaceEventZAdd       KeyspaceEventType = "zadd"
+	KeyspaceEventZRem       KeyspaceEventType = "zrem"
+	KeyspaceEventHSet       KeyspaceEventType = "hset"
+	KeyspaceEventHDel       KeyspaceEventType = "hdel"
+	KeyspaceEventXAdd       KeyspaceEventType = "xadd"
+	KeyspaceEventXTrim      KeyspaceEventType = "xtrim"
+	KeyspaceEventNew        KeyspaceEventType = "new"
+)
+
+// KeyspaceEvent is a keyspace or keyevent notification.
+type KeyspaceEvent struct {
+	// DB is the database of the key.
+	DB int
+	// Key is the key that was changed.
+	Key string
+	// Type is the event type.
+	Type KeyspaceEventType
+	// Addr is the address of the server that sent the notification.
+	Addr string
+}
+
+func (e *KeyspaceEvent) String() string {
+	return fmt.Sprintf("KeyspaceEvent<%d %s: %s>", e.DB, e.Type, e.Key)
+}
+
+// ParseKeyspaceEvent parses a message received on a
+// __keyspace@<db>__:<key> or __keyevent@<db>__:<event> channel.
+func ParseKeyspaceEvent(channel, payload string) (*KeyspaceEvent, error) {
+	var keyspace bool
+	switch {
+	case strings.HasPrefix(channel, "__keyspace@"):
+		keyspace = true
+		channel = channel[len("__keyspace@"):]
+	case strings.HasPrefix(channel, "__keyevent@"):
+		channel = channel[len("__keyevent@"):]
+	default:
+		return nil, fmt.Errorf("redis: not a keyspace notification channel: %q", channel)
+	}
+
+	db, name, ok := strings.Cut(channel, "__:")
+	if !ok {
+		return nil, fmt.Errorf("redis: can't parse keyspace notification channel: %q", channel)
+	}
+	n, err := strconv.Atoi(db)
+	if err != nil {
+		return nil, fmt.Errorf("redis: can't parse keyspace notification db: %q", db)
+	}
+
+	event := &KeyspaceEvent{DB: n}
+	if keyspace {
+		event.Key, event.Type = name, KeyspaceEventType(payload)
+	} else {
+		event.Key, event.Type = payload, KeyspaceEventType(name)
+	}
+	return event, nil
+}
+
+//------------------------------------------------------------------------------
+
+// KeyspaceOptions are used to configure SubscribeKeyspace.
+type KeyspaceOptions struct {
+	// DBs are the databases to watch. Default is the DB of the client.
+	DBs []int
+	// Keys is the glob pattern of the keys to watch. Default is "*".
+	// It can't be used with KeyEvents.
+	Keys string
+	// Types are the event types to deliver. Default is all types.
+	Types []KeyspaceEventType
+	// KeyEvents subscribes to the __keyevent@<db>__:<type> channels of
+	// Types instead of the __keyspace@<db>__:<key> channels, so the server
+	// only sends the events of these types. It requires the "E" flag
+	// instead of "K" in notify-keyspace-events.
+	KeyEvents bool
+
+	// NotifyFlags are added to the notify-keyspace-events config with
+	// CONFIG SET, for example "KA". If empty, the config is only checked
+	// to have keyspace notifications enabled.
+	NotifyFlags string
+	// SkipConfig disables CONFIG GET and CONFIG SET for servers that
+	// don't allow them.
+	SkipConfig bool
+
+	// ChannelOptions are passed to PubSub.Channel.
+	ChannelOptions []ChannelOption
+}
+
+func (opt *KeyspaceOptions) validate() error {
+	if opt.KeyEvents && opt.Keys != "" && opt.Keys != "*" {
+		return errors.New("redis: KeyspaceOptions.Keys can't be used with KeyEvents")
+	}
+	return nil
+}
+
+func (opt *KeyspaceOptions) patterns(defaultDB int) []string {
+	dbs := opt.DBs
+	if len(dbs) == 0 {
+		dbs = []int{defaultDB}
+	}
+
+	if opt.KeyEvents {
+		var patterns []string
+		for _, db := range dbs {
+			if len(opt.Types) == 0 {
+				patterns = append(patterns, fmt.Sprintf("__keyevent@%d__:*", db))
+				continue
+			}
+			for _, typ := range opt.Types {
+				patterns = append(patterns, fmt.Sprintf("__keyevent@%d__:%s", db, typ))
+			}
+		}
+		return patterns
+	}
+
+	keys := opt.Keys
+	if keys == "" {
+		keys = "*"
+	}
+	patterns := make([]string, len(dbs))
+	for i, db := range dbs {
+		patterns[i] = fmt.Sprintf("__keyspace@%d__:%s", db, keys)
+	}
+	return patterns
+}
+
+// KeyspaceSubscriber delivers typed keyspace notifications.
+type KeyspaceSubscriber struct {
+	pubsubs []*PubSub
+	addrs   []string
+	types   map[KeyspaceEventType]struct{}
+	opts    []ChannelOption
+
+	chOnce sync.Once
+	ch     chan *KeyspaceEvent
+}
+
+// SubscribeKeyspace enables or checks keyspace notifications and subscribes
+// to the changes of the keys in the databases of the options.
+func (c *Client) SubscribeKeyspace(ctx context.Context, opt *KeyspaceOptions) (*KeyspaceSubscriber, error) {
+	if opt == nil {
+		opt = &KeyspaceOptions{}
+	}
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	if err := enableKeyspaceNotifications(ctx, c, opt); err != nil {
+		return nil, err
+	}
+
+	s := newKeyspaceSubscriber(opt)
+	s.add(c.PSubscribe(ctx, opt.patterns(c.opt.DB)...), c.opt.Addr)
+	return s, nil
+}
+
+// SubscribeKeyspace enables or checks keyspace notifications on every
+// master and subscribes to the changes of the keys, because keyspace
+// notifications are sent only to the clients of the node that stores the key.
+// Masters added after the call are not watched.
+func (c *ClusterClient) SubscribeKeyspace(ctx context.Context, opt *KeyspaceOptions) (*KeyspaceSubscriber, error) {
+	if opt == nil {
+		opt = &KeyspaceOptions{}
+	}
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	s := newKeyspaceSubscriber(opt)
+
+	var mu sync.Mutex
+	err := c.ForEachMaster(ctx, func(ctx context.Context, master *Client) error {
+		if err := enableKeyspaceNotifications(ctx, master, opt); err != nil {
+			return err
+		}
+
+		pubsub := master.PSubscribe(ctx, opt.patterns(0)...)
+
+		mu.Lock()
+		s.add(pubsub, master.opt.Addr)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newKeyspaceSubscriber(opt *KeyspaceOptions) *KeyspaceSubscriber {
+	s := &KeyspaceSubscriber{
+		opts: opt.ChannelOptions,
+	}
+	if len(opt.Types) > 0 {
+		s.types = make(map[KeyspaceEventType]struct{}, len(opt.Types))
+		for _, typ := range opt.Types {
+			s.types[typ] = struct{}{}
+		}
+	}
+	return s
+}
+
+func (s *KeyspaceSubscriber) add(pubsub *PubSub, addr string) {
+	s.pubsubs = append(s.pubsubs, pubsub)
+	s.addrs = append(s.addrs, addr)
+}
+
+// enableKeyspaceNotifications adds the flags of the options to
+// notify-keyspace-events or checks that keyspace notifications are enabled.
+func enableKeyspaceNotifications(ctx context.Context, client *Client, opt *KeyspaceOptions) error {
+	if opt.SkipConfig {
+		return nil
+	}
+
+	cfg, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+	current := cfg["notify-keyspace-events"]
+
+	if opt.NotifyFlags == "" {
+		if !keyspaceNotificationsEnabled(current, opt.KeyEvents) {
+			return fmt.Errorf("redis: keyspace notifications are disabled on %s (notify-keyspace-events=%q)",
+				client.opt.Addr, current)
+		}
+		return nil
+	}
+
+	flags := mergeNotifyFlags(current, opt.NotifyFlags)
+	if flags == current {
+		return nil
+	}
+	return client.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+}
+
+// keyspaceNotificationsEnabled reports whether the notify-keyspace-events
+// flags enable __keyspace@ channels, or __keyevent@ channels with
+// keyEvents, for at least one class of events.
+func keyspaceNotificationsEnabled(flags string, keyEvents bool) bool {
+	channels := 'K'
+	if keyEvents {
+		channels = 'E'
+	}
+	return strings.ContainsRune(flags, channels) && strings.Trim(flags, "KE") != ""
+}
+
+func mergeNotifyFlags(current, flags string) string {
+	merged := []byte(current)
+	for i := 0; i < len(flags); i++ {
+		if strings.IndexByte(string(merged), flags[i]) == -1 {
+			merged = append(merged, flags[i])
+		}
+	}
+	return string(merged)
+}
+
+// Channel returns a Go channel for concurrently receiving events.
+// The channel is closed together with the KeyspaceSubscriber.
+func (s *KeyspaceSubscriber) Channel() <-chan *KeyspaceEvent {
+	s.chOnce.Do(func() {
+		s.ch = make(chan *KeyspaceEvent, 100)
+
+		var wg sync.WaitGroup
+		for i, pubsub := range s.pubsubs {
+			wg.Add(1)
+			go func(pubsub *PubSub, addr string) {
+				defer wg.Done()
+				s.listen(pubsub, addr)
+			}(pubsub, s.addrs[i])
+		}
+
+		go func() {
+			wg.Wait()
+			close(s.ch)
+		}()
+	})
+	return s.ch
+}
+
+func (s *KeyspaceSubscriber) listen(pubsub *PubSub, addr string) {
+	for msg := range pubsub.Channel(s.opts...) {
+		event, err := ParseKeyspaceEvent(msg.Channel, msg.Payload)
+		if err != nil {
+			internal.Logger.Printf(context.TODO(), "%s", err)
+			continue
+		}
+		if s.types != nil {
+			if _, ok := s.types[event.Type]; !ok {
+				continue
+			}
+		}
+		event.Addr = addr
+
+		select {
+		case s.ch <- event:
+		case <-pubsub.exit:
+			return
+		}
+	}
+}
+
+// Close unsubscribes from the notifications and closes the channel.
+func (s *KeyspaceSubscriber) Close() error {
+	var firstErr error
+	for _, pubsub := range s.pubsubs {
+		if err := pubsub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
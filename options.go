@@ -48,6 +48,19 @@ type Options struct {
 	// Protocol 2 or 3. Use the version to negotiate RESP version with redis-server.
 	// Default is 3.
 	Protocol int
+	// MultiplexPubSub makes the PubSubs of the client share one RESP3
+	// connection instead of holding a connection each. Messages are
+	// dispatched from push frames to the PubSubs by channel. While there
+	// are subscriptions, the PINGs of the PubSubs and the commands and
+	// pipelines of the client run on the shared connection too, except
+	// transactions and the commands that block or change the state of the
+	// connection, which use the pool. The connection is closed when the
+	// last subscription is removed. The listener doesn't wait for a PubSub
+	// that doesn't receive its messages: past 1000 queued messages, they
+	// are dropped and counted in PubSubStats.Dropped. It is ignored with
+	// Protocol 2, and PubSubs have their own connections again once the
+	// server refuses RESP3.
+	MultiplexPubSub bool
 	// Use the specified Username to authenticate the current connection
 	// with one of the connections defined in the ACL list when connecting
 	// to a Redis 6.0 instance, or greater, that is using the Redis ACL system.
@@ -23,6 +23,31 @@ import (
 
 var errClusterNoNodes = fmt.Errorf("redis: cluster has no nodes")
 
+// TxSlotMigratingError is returned by ClusterClient.TxPipeline when the keys
+// of a transaction are split between the source and the target node of a slot
+// that is being migrated, so the transaction can't be executed atomically.
+// The transaction can be retried once the migration is finished.
+type TxSlotMigratingError struct {
+	// Slot is the slot being migrated.
+	Slot int
+	// Addr is the address of the node the slot is being migrated to.
+	Addr string
+	// Err is the error returned while queueing the transaction.
+	Err error
+}
+
+func (e *TxSlotMigratingError) Error() string {
+	if e.Addr == "" {
+		return fmt.Sprintf("redis: transaction crosses migrating slot %d: %s", e.Slot, e.Err)
+	}
+	return fmt.Sprintf("redis: transaction crosses migrating slot %d (migrating to %s): %s",
+		e.Slot, e.Addr, e.Err)
+}
+
+func (e *TxSlotMigratingError) Unwrap() error {
+	return e.Err
+}
+
 // ClusterOptions are used to configure a cluster client and should be
 // passed to NewClusterClient.
 type ClusterOptions struct {
@@ -48,6 +73,21 @@ type ClusterOptions struct {
 	// Allows routing read-only commands to the random master or slave node.
 	// It automatically enables ReadOnly.
 	RouteRandomly bool
+	// Picks the node that serves read-only commands among the nodes of the slot.
+	// It takes precedence over RouteByLatency and RouteRandomly and
+	// automatically enables ReadOnly.
+	ReadRouter ReadRouter
+	// Optional function that returns the zone of the node with the given
+	// address. The zone is passed to ReadRouter.
+	NodeZone func(addr string) string
+
+	// Optional function that translates the address announced by a node into
+	// the address used to dial it, e.g. to reach nodes behind NAT or outside
+	// of a Kubernetes network. It applies to every learned node address,
+	// including seed addresses and MOVED and ASK redirects, so it should return
+	// unknown addresses unchanged. Errors and hooks keep reporting the
+	// announced address.
+	AddressMapper func(addr string) string
 
 	// Optional function that returns cluster slots information.
 	// It is useful to manually create cluster of standalone Redis servers
@@ -98,7 +138,7 @@ func (opt *ClusterOptions) init() {
 		opt.MaxRedirects = 3
 	}
 
-	if opt.RouteByLatency || opt.RouteRandomly {
+	if opt.RouteByLatency || opt.RouteRandomly || opt.ReadRouter != nil {
 		opt.ReadOnly = true
 	}
 
@@ -266,6 +306,10 @@ func setupClusterQueryParams(u *url.URL, o *ClusterOptions) (*ClusterOptions, er
 	return o, nil
 }
 
+func (opt *ClusterOptions) measureLatency() bool {
+	return opt.RouteByLatency || opt.ReadRouter != nil
+}
+
 func (opt *ClusterOptions) clientOptions() *Options {
 	return &Options{
 		ClientName: opt.ClientName,
@@ -311,6 +355,8 @@ func (opt *ClusterOptions) clientOptions() *Options {
 type clusterNode struct {
 	Client *Client
 
+	zone string
+
 	latency    uint32 // atomic
 	generation uint32 // atomic
 	failing    uint32 // atomic
@@ -319,12 +365,19 @@ type clusterNode struct {
 func newClusterNode(clOpt *ClusterOptions, addr string) *clusterNode {
 	opt := clOpt.clientOptions()
 	opt.Addr = addr
+	if clOpt.AddressMapper != nil {
+		opt.Dialer = addrMapperDialer(opt, clOpt.AddressMapper)
+	}
 	node := clusterNode{
 		Client: clOpt.NewClient(opt),
 	}
 
+	if clOpt.NodeZone != nil {
+		node.zone = clOpt.NodeZone(addr)
+	}
+
 	node.latency = math.MaxUint32
-	if clOpt.RouteByLatency {
+	if clOpt.measureLatency() {
 		go node.updateLatency()
 	}
 
@@ -492,7 +545,7 @@ func (c *clusterNodes) GC(generation uint32) {
 	for addr, node := range c.nodes {
 		if node.Generation() >= generation {
 			c.activeAddrs = append(c.activeAddrs, addr)
-			if c.opt.RouteByLatency {
+			if c.opt.measureLatency() {
 				go node.updateLatency()
 			}
 			continue
@@ -684,6 +737,20 @@ func replaceLoopbackHost(nodeAddr, originHost string) string {
 	return net.JoinHostPort(originHost, nodePort)
 }
 
+// addrMapperDialer returns a dialer that connects to the address returned by
+// the mapper, so the client itself keeps using the announced address.
+func addrMapperDialer(
+	opt *Options, mapper func(addr string) string,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := opt.Dialer
+	if dialer == nil {
+		dialer = NewDialer(opt)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer(ctx, network, mapper(addr))
+	}
+}
+
 func isLoopback(host string) bool {
 	ip := net.ParseIP(host)
 	if ip == nil {
@@ -767,6 +834,29 @@ func (c *clusterState) slotRandomNode(slot int) (*clusterNode, error) {
 	return nodes[randomNodes[0]], nil
 }
 
+func (c *clusterState) slotRoutedNode(router ReadRouter, slot int) (*clusterNode, error) {
+	nodes := c.slotNodes(slot)
+	if len(nodes) == 0 {
+		return c.nodes.Random()
+	}
+
+	routeNodes := make([]ReadRouterNode, len(nodes))
+	for i, node := range nodes {
+		routeNodes[i] = ReadRouterNode{
+			Addr:    node.Client.getAddr(),
+			Master:  i == 0,
+			Latency: node.Latency(),
+			Failing: node.Failing(),
+			Zone:    node.zone,
+		}
+	}
+
+	if i := router.RouteRead(routeNodes); i > 0 && i < len(nodes) {
+		return nodes[i], nil
+	}
+	return nodes[0], nil
+}
+
 func (c *clusterState) slotNodes(slot int) []*clusterNode {
 	i := sort.Search(len(c.slots), func(i int) bool {
 		return c.slots[i].end >= slot
@@ -931,11 +1021,12 @@ func (c *ClusterClient) process(ctx context.Context, cmd Cmder) error {
 			}
 		}
 
+		asking := ask
 		if ask {
 			ask = false
 
 			pipe := node.Client.Pipeline()
-			_ = pipe.Process(ctx, NewCmd(ctx, "asking"))
+			_ = pipe.Process(ctx, newAskingCmd(ctx))
 			_ = pipe.Process(ctx, cmd)
 			_, lastErr = pipe.Exec(ctx)
 		} else {
@@ -975,6 +1066,13 @@ func (c *ClusterClient) process(ctx context.Context, cmd Cmder) error {
 			continue
 		}
 
+		// Keys of a multi-key command are split between the nodes of
+		// a migrating slot - retry the same node after a backoff.
+		if isTryAgainError(lastErr) {
+			ask = asking
+			continue
+		}
+
 		if shouldRetry(lastErr, cmd.readTimeout() == nil) {
 			// First retry the same node.
 			if attempt == 0 {
@@ -1256,6 +1354,8 @@ func (c *ClusterClient) mapCmdsByNode(ctx context.Context, cmdsMap *cmdsMap, cmd
 		return err
 	}
 
+	cmds = withoutAskingCmds(cmds)
+
 	if c.opt.ReadOnly && c.cmdsAreReadOnly(ctx, cmds) {
 		for _, cmd := range cmds {
 			slot := c.cmdSlot(ctx, cmd)
@@ -1351,6 +1451,16 @@ func (c *ClusterClient) pipelineReadCmds(
 			continue
 		}
 
+		if isTryAgainError(err) {
+			// Retry on the same node, preserving the ASK redirect.
+			if i > 0 && isAskingCmd(cmds[i-1]) {
+				failedCmds.Add(node, newAskingCmd(ctx), cmd)
+			} else {
+				failedCmds.Add(node, cmd)
+			}
+			continue
+		}
+
 		if c.opt.ReadOnly && isBadConn(err, false, node.Client.getAddr()) {
 			node.MarkAsFailing()
 		}
@@ -1364,7 +1474,7 @@ func (c *ClusterClient) pipelineReadCmds(
 		}
 	}
 
-	if err := cmds[0].Err(); err != nil && shouldRetry(err, true) {
+	if err := cmds[0].Err(); err != nil && shouldRetry(err, true) && !isTryAgainError(err) {
 		_ = c.mapCmdsByNode(ctx, failedCmds, cmds)
 		return err
 	}
@@ -1392,7 +1502,7 @@ func (c *ClusterClient) checkMovedErr(
 	}
 
 	if ask {
-		failedCmds.Add(node, NewCmd(ctx, "asking"), cmd)
+		failedCmds.Add(node, newAskingCmd(ctx), cmd)
 		return true
 	}
 
@@ -1476,7 +1586,13 @@ func (c *ClusterClient) mapCmdsBySlot(ctx context.Context, cmds []Cmder) map[int
 func (c *ClusterClient) processTxPipelineNode(
 	ctx context.Context, node *clusterNode, cmds []Cmder, failedCmds *cmdsMap,
 ) {
-	cmds = wrapMultiExec(ctx, cmds)
+	// ASKING must be sent before MULTI, the flag is then kept
+	// for all commands of the transaction.
+	if isAskingCmd(cmds[0]) {
+		cmds = append([]Cmder{cmds[0]}, wrapMultiExec(ctx, cmds[1:])...)
+	} else {
+		cmds = wrapMultiExec(ctx, cmds)
+	}
 	_ = node.Client.withProcessPipelineHook(ctx, cmds, func(ctx context.Context, cmds []Cmder) error {
 		cn, err := node.Client.getConn(ctx)
 		if err != nil {
@@ -1509,12 +1625,20 @@ func (c *ClusterClient) processTxPipelineNodeConn(
 	}
 
 	return cn.WithReader(c.context(ctx), c.opt.ReadTimeout, func(rd *proto.Reader) error {
+		if isAskingCmd(cmds[0]) {
+			if err := cmds[0].readReply(rd); err != nil {
+				setCmdsErr(cmds, err)
+				return err
+			}
+			cmds = cmds[1:]
+		}
+
 		statusCmd := cmds[0].(*StatusCmd)
 		// Trim multi and exec.
 		trimmedCmds := cmds[1 : len(cmds)-1]
 
 		if err := c.txPipelineReadQueued(
-			ctx, rd, statusCmd, trimmedCmds, failedCmds,
+			ctx, node, rd, statusCmd, trimmedCmds, failedCmds,
 		); err != nil {
 			setCmdsErr(cmds, err)
 
@@ -1532,6 +1656,7 @@ func (c *ClusterClient) processTxPipelineNodeConn(
 
 func (c *ClusterClient) txPipelineReadQueued(
 	ctx context.Context,
+	node *clusterNode,
 	rd *proto.Reader,
 	statusCmd *StatusCmd,
 	cmds []Cmder,
@@ -1542,16 +1667,54 @@ func (c *ClusterClient) txPipelineReadQueued(
 		return err
 	}
 
+	var askAddr string
+	var asked int
+	var migratingErr error
 	for _, cmd := range cmds {
 		err := statusCmd.readReply(rd)
-		if err == nil || c.checkMovedErr(ctx, cmd, err, failedCmds) || isRedisError(err) {
+		if err == nil {
+			continue
+		}
+		if _, ask, addr := isMovedError(err); ask {
+			askAddr = addr
+			asked++
+			if migratingErr == nil {
+				migratingErr = err
+			}
+			continue
+		}
+		if isTryAgainError(err) {
+			migratingErr = err
+			continue
+		}
+		if c.checkMovedErr(ctx, cmd, err, failedCmds) || isRedisError(err) {
 			continue
 		}
 		return err
 	}
 
+	if migratingErr != nil && asked == len(cmds) {
+		// All keys were already migrated - run the transaction on the target node.
+		askNode, err := c.nodes.GetOrCreate(askAddr)
+		if err != nil {
+			return err
+		}
+		failedCmds.Add(askNode, append([]Cmder{newAskingCmd(ctx)}, cmds...)...)
+		migratingErr = nil
+	}
+
 	// Parse number of replies.
 	line, err := rd.ReadLine()
+	if migratingErr != nil {
+		if err == nil || isRedisError(err) {
+			return &TxSlotMigratingError{
+				Slot: c.cmdSlot(ctx, cmds[0]),
+				Addr: askAddr,
+				Err:  migratingErr,
+			}
+		}
+		return err
+	}
 	if err != nil {
 		if err == Nil {
 			err = TxFailedErr
@@ -1586,9 +1749,7 @@ func (c *ClusterClient) cmdsMoved(
 	}
 
 	if ask {
-		for _, cmd := range cmds {
-			failedCmds.Add(node, NewCmd(ctx, "asking"), cmd)
-		}
+		failedCmds.Add(node, append([]Cmder{newAskingCmd(ctx)}, cmds...)...)
 		return nil
 	}
 
@@ -1717,8 +1878,12 @@ func (c *ClusterClient) PSubscribe(ctx context.Context, channels ...string) *Pub
 }
 
 // SSubscribe Subscribes the client to the specified shard channels.
+// Each shard channel is subscribed on the master that owns its slot and
+// messages from all masters are delivered through the same PubSub.
+// Channels are resubscribed on the new owner after a slot migration
+// or a failover.
 func (c *ClusterClient) SSubscribe(ctx context.Context, channels ...string) *PubSub {
-	pubsub := c.pubSub()
+	pubsub := c.shardedPubSub()
 	if len(channels) > 0 {
 		_ = pubsub.SSubscribe(ctx, channels...)
 	}
@@ -1822,6 +1987,9 @@ func (c *ClusterClient) cmdNode(
 }
 
 func (c *ClusterClient) slotReadOnlyNode(state *clusterState, slot int) (*clusterNode, error) {
+	if c.opt.ReadRouter != nil {
+		return state.slotRoutedNode(c.opt.ReadRouter, slot)
+	}
 	if c.opt.RouteByLatency {
 		return state.slotClosestNode(slot)
 	}
@@ -1897,6 +2065,32 @@ loop:
 	return ss
 }
 
+// newAskingCmd returns the ASKING command that must precede
+// a command redirected with an ASK error.
+func newAskingCmd(ctx context.Context) Cmder {
+	return NewStatusCmd(ctx, "asking")
+}
+
+func isAskingCmd(cmd Cmder) bool {
+	return cmd.Name() == "asking"
+}
+
+func withoutAskingCmds(cmds []Cmder) []Cmder {
+	for i, cmd := range cmds {
+		if !isAskingCmd(cmd) {
+			continue
+		}
+		filtered := append([]Cmder(nil), cmds[:i]...)
+		for _, cmd := range cmds[i+1:] {
+			if !isAskingCmd(cmd) {
+				filtered = append(filtered, cmd)
+			}
+		}
+		return filtered
+	}
+	return cmds
+}
+
 //------------------------------------------------------------------------------
 
 type cmdsMap struct {
@@ -0,0 +1,478 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ClusterSlotMove describes a range of slots moved between two masters.
+type ClusterSlotMove struct {
+	SourceID string
+	TargetID string
+	Start    int
+	End      int
+}
+
+// ClusterMigrateOptions configure how ClusterClient moves slots between masters.
+type ClusterMigrateOptions struct {
+	// Number of keys fetched with CLUSTER GETKEYSINSLOT and moved with
+	// a single MIGRATE command.
+	// Default is 100 keys.
+	BatchSize int
+	// Timeout of a single MIGRATE command.
+	// Default is 60 seconds.
+	Timeout time.Duration
+	// Replace keys that already exist on the target master.
+	Replace bool
+
+	// Optional function that is called after every migrated batch of keys
+	// and every moved slot.
+	Progress func(progress ClusterMigrateProgress)
+}
+
+func (opt *ClusterMigrateOptions) init() {
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 100
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 60 * time.Second
+	}
+}
+
+// ClusterMigrateProgress reports the progress of a slot move.
+type ClusterMigrateProgress struct {
+	Move ClusterSlotMove
+	// The slot being moved.
+	Slot int
+	// Number of keys migrated so far.
+	Keys int64
+	// Number of slots of the move that are owned by the target master.
+	DoneSlots int
+}
+
+// ClusterMigrateError is returned when a slot can't be moved. Calling
+// MigrateSlots again with the same move resumes it from the failed slot.
+type ClusterMigrateError struct {
+	Slot int
+	Err  error
+}
+
+func (e *ClusterMigrateError) Error() string {
+	return fmt.Sprintf("redis: migrating slot %d failed: %s", e.Slot, e.Err)
+}
+
+func (e *ClusterMigrateError) Unwrap() error {
+	return e.Err
+}
+
+// clusterNodeInfo is a node parsed from the CLUSTER NODES reply.
+type clusterNodeInfo struct {
+	id     string
+	addr   string
+	master bool
+}
+
+func parseClusterNodes(s string) map[string]clusterNodeInfo {
+	nodes := make(map[string]clusterNodeInfo)
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		// Strip the cluster bus port and the hostname: ip:port@cport[,hostname].
+		addr := fields[1]
+		if i := strings.IndexAny(addr, "@,"); i >= 0 {
+			addr = addr[:i]
+		}
+
+		var master bool
+		for _, flag := range strings.Split(fields[2], ",") {
+			if flag == "master" {
+				master = true
+			}
+		}
+
+		nodes[fields[0]] = clusterNodeInfo{
+			id:     fields[0],
+			addr:   addr,
+			master: master,
+		}
+	}
+	return nodes
+}
+
+func (c *ClusterClient) clusterNodesByID(ctx context.Context) (map[string]clusterNodeInfo, error) {
+	node, err := c.nodes.Random()
+	if err != nil {
+		return nil, err
+	}
+	s, err := node.Client.ClusterNodes(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterNodes(s), nil
+}
+
+func (c *ClusterClient) clusterNodeByID(
+	nodes map[string]clusterNodeInfo, id string,
+) (*clusterNode, clusterNodeInfo, error) {
+	info, ok := nodes[id]
+	if !ok {
+		return nil, info, fmt.Errorf("redis: cluster node %s not found", id)
+	}
+	if !info.master {
+		return nil, info, fmt.Errorf("redis: cluster node %s is not a master", id)
+	}
+	node, err := c.nodes.GetOrCreate(info.addr)
+	if err != nil {
+		return nil, info, err
+	}
+	return node, info, nil
+}
+
+func slotOwnerID(slots []ClusterSlot, slot int) string {
+	for _, s := range slots {
+		if slot >= s.Start && slot <= s.End && len(s.Nodes) > 0 {
+			return s.Nodes[0].ID
+		}
+	}
+	return ""
+}
+
+// MigrateSlots moves a range of slots from the source to the target master.
+// For every slot it marks the slot as importing on the target and as migrating
+// on the source, moves the keys in batches with CLUSTER GETKEYSINSLOT and
+// MIGRATE, and finally assigns the slot to the target on all masters.
+//
+// Slots already owned by the target are skipped, so a failed move can be
+// resumed by calling MigrateSlots again with the same move.
+func (c *ClusterClient) MigrateSlots(
+	ctx context.Context, move ClusterSlotMove, opt *ClusterMigrateOptions,
+) error {
+	if opt == nil {
+		opt = new(ClusterMigrateOptions)
+	}
+	opt.init()
+
+	if move.Start < 0 || move.End > 16383 || move.Start > move.End {
+		return fmt.Errorf("redis: invalid slot range %d-%d", move.Start, move.End)
+	}
+
+	nodes, err := c.clusterNodesByID(ctx)
+	if err != nil {
+		return err
+	}
+	source, _, err := c.clusterNodeByID(nodes, move.SourceID)
+	if err != nil {
+		return err
+	}
+	target, targetInfo, err := c.clusterNodeByID(nodes, move.TargetID)
+	if err != nil {
+		return err
+	}
+
+	var masters []*Client
+	for _, info := range nodes {
+		if !info.master || info.id == move.SourceID || info.id == move.TargetID {
+			continue
+		}
+		node, err := c.nodes.GetOrCreate(info.addr)
+		if err != nil {
+			return err
+		}
+		masters = append(masters, node.Client)
+	}
+
+	sourceSlots, err := source.Client.ClusterSlots(ctx).Result()
+	if err != nil {
+		return err
+	}
+	targetSlots, err := target.Client.ClusterSlots(ctx).Result()
+	if err != nil {
+		return err
+	}
+
+	m := &slotMigration{
+		opt:     opt,
+		move:    move,
+		source:  source.Client,
+		target:  target.Client,
+		masters: masters,
+		addr:    targetInfo.addr,
+		auth:    c.opt,
+	}
+	m.progress.Move = move
+
+	defer c.state.LazyReload()
+
+	for slot := move.Start; slot <= move.End; slot++ {
+		m.progress.Slot = slot
+
+		if slotOwnerID(targetSlots, slot) == move.TargetID {
+			// The move was interrupted after the target took over the slot.
+			if slotOwnerID(sourceSlots, slot) != move.TargetID {
+				err := m.source.ClusterSetSlotNode(ctx, slot, move.TargetID).Err()
+				if err != nil {
+					return &ClusterMigrateError{Slot: slot, Err: err}
+				}
+			}
+			m.progress.DoneSlots++
+			m.report()
+			continue
+		}
+
+		if owner := slotOwnerID(sourceSlots, slot); owner != move.SourceID {
+			return &ClusterMigrateError{
+				Slot: slot,
+				Err:  fmt.Errorf("redis: slot is owned by node %q", owner),
+			}
+		}
+
+		if err := m.migrateSlot(ctx, slot); err != nil {
+			return &ClusterMigrateError{Slot: slot, Err: err}
+		}
+		m.progress.DoneSlots++
+		m.report()
+	}
+
+	return nil
+}
+
+type slotMigration struct {
+	opt     *ClusterMigrateOptions
+	move    ClusterSlotMove
+	source  *Client
+	target  *Client
+	masters []*Client
+	addr    string
+	auth    *ClusterOptions
+
+	progress ClusterMigrateProgress
+}
+
+func (m *slotMigration) report() {
+	if m.opt.Progress != nil {
+		m.opt.Progress(m.progress)
+	}
+}
+
+func (m *slotMigration) migrateSlot(ctx context.Context, slot int) error {
+	host, port, err := net.SplitHostPort(m.addr)
+	if err != nil {
+		return err
+	}
+
+	if err := m.target.ClusterSetSlotImporting(ctx, slot, m.move.SourceID).Err(); err != nil {
+		return err
+	}
+	if err := m.source.ClusterSetSlotMigrating(ctx, slot, m.move.TargetID).Err(); err != nil {
+		return err
+	}
+
+	username, password := m.auth.Username, m.auth.Password
+	if m.auth.CredentialsProvider != nil {
+		username, password = m.auth.CredentialsProvider()
+	}
+
+	for {
+		keys, err := m.source.ClusterGetKeysInSlot(ctx, slot, m.opt.BatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		err = m.source.MigrateKeys(ctx, &MigrateArgs{
+			Host:     host,
+			Port:     port,
+			Timeout:  m.opt.Timeout,
+			Replace:  m.opt.Replace,
+			Username: username,
+			Password: password,
+			Keys:     keys,
+		}).Err()
+		if err != nil {
+			return err
+		}
+
+		m.progress.Keys += int64(len(keys))
+		m.report()
+	}
+
+	// Assign the slot to the target first, so the slot is never left
+	// without an owner if the move is interrupted.
+	if err := m.target.ClusterSetSlotNode(ctx, slot, m.move.TargetID).Err(); err != nil {
+		return err
+	}
+	if err := m.source.ClusterSetSlotNode(ctx, slot, m.move.TargetID).Err(); err != nil {
+		return err
+	}
+	// Other masters learn about the new owner through the cluster bus,
+	// updating them directly only speeds up the propagation.
+	for _, master := range m.masters {
+		_ = master.ClusterSetSlotNode(ctx, slot, m.move.TargetID).Err()
+	}
+	return nil
+}
+
+// PlanClusterRebalance computes the slot moves that distribute the slots
+// between masters proportionally to their weights. The current layout is
+// taken from slots, e.g. the CLUSTER SLOTS reply, and weights are keyed by
+// node ID. Masters that own slots but are missing from weights have weight 1,
+// and masters with weight 0 give away all their slots.
+func PlanClusterRebalance(slots []ClusterSlot, weights map[string]float64) ([]ClusterSlotMove, error) {
+	owned := make(map[string][]int)
+	var numSlots int
+	for _, s := range slots {
+		if len(s.Nodes) == 0 || s.Nodes[0].ID == "" {
+			return nil, fmt.Errorf("redis: slots %d-%d have no master ID", s.Start, s.End)
+		}
+		id := s.Nodes[0].ID
+		for slot := s.Start; slot <= s.End; slot++ {
+			owned[id] = append(owned[id], slot)
+		}
+		numSlots += s.End - s.Start + 1
+	}
+
+	ids := make([]string, 0, len(owned)+len(weights))
+	for id := range owned {
+		ids = append(ids, id)
+	}
+	for id := range weights {
+		if _, ok := owned[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var totalWeight float64
+	for _, id := range ids {
+		w, ok := weights[id]
+		if !ok {
+			w = 1
+		}
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("redis: invalid weight %v of node %s", w, id)
+		}
+		totalWeight += w
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("redis: rebalance requires at least one node with a positive weight")
+	}
+
+	// Give every node its share rounded down and distribute the remaining
+	// slots to the nodes with the largest fractional parts.
+	type share struct {
+		id       string
+		expected int
+		fraction float64
+	}
+	shares := make([]share, len(ids))
+	assigned := 0
+	for i, id := range ids {
+		w, ok := weights[id]
+		if !ok {
+			w = 1
+		}
+		exact := float64(numSlots) * w / totalWeight
+		shares[i] = share{id: id, expected: int(exact), fraction: exact - math.Floor(exact)}
+		assigned += shares[i].expected
+	}
+	byFraction := make([]int, len(shares))
+	for i := range byFraction {
+		byFraction[i] = i
+	}
+	sort.SliceStable(byFraction, func(i, j int) bool {
+		return shares[byFraction[i]].fraction > shares[byFraction[j]].fraction
+	})
+	for i := 0; assigned < numSlots; i++ {
+		shares[byFraction[i%len(byFraction)]].expected++
+		assigned++
+	}
+
+	var donors, receivers []share
+	for _, s := range shares {
+		switch diff := len(owned[s.id]) - s.expected; {
+		case diff > 0:
+			donors = append(donors, share{id: s.id, expected: diff})
+		case diff < 0:
+			receivers = append(receivers, share{id: s.id, expected: -diff})
+		}
+	}
+
+	var moves []ClusterSlotMove
+	for _, r := range receivers {
+		for r.expected > 0 {
+			d := &donors[0]
+			n := d.expected
+			if n > r.expected {
+				n = r.expected
+			}
+
+			// Give away the highest slots of the donor.
+			donorSlots := owned[d.id]
+			moved := donorSlots[len(donorSlots)-n:]
+			owned[d.id] = donorSlots[:len(donorSlots)-n]
+			moves = appendSlotMoves(moves, d.id, r.id, moved)
+
+			d.expected -= n
+			r.expected -= n
+			if d.expected == 0 {
+				donors = donors[1:]
+			}
+		}
+	}
+	return moves, nil
+}
+
+func appendSlotMoves(moves []ClusterSlotMove, source, target string, slots []int) []ClusterSlotMove {
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+		moves = append(moves, ClusterSlotMove{
+			SourceID: source,
+			TargetID: target,
+			Start:    slots[i],
+			End:      slots[j],
+		})
+		i = j + 1
+	}
+	return moves
+}
+
+// Rebalance moves slots between masters so that every master owns a number
+// of slots proportional to its weight, see PlanClusterRebalance. It returns
+// the planned moves. When a move fails, calling Rebalance again with the same
+// weights resumes the rebalance.
+func (c *ClusterClient) Rebalance(
+	ctx context.Context, weights map[string]float64, opt *ClusterMigrateOptions,
+) ([]ClusterSlotMove, error) {
+	node, err := c.nodes.Random()
+	if err != nil {
+		return nil, err
+	}
+	slots, err := node.Client.ClusterSlots(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	moves, err := PlanClusterRebalance(slots, weights)
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range moves {
+		if err := c.MigrateSlots(ctx, move, opt); err != nil {
+			return moves, err
+		}
+	}
+	return moves, nil
+}
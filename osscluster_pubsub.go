@@ -0,0 +1,471 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal"
+	"github.com/redis/go-redis/v9/internal/hashtag"
+	"github.com/redis/go-redis/v9/internal/pool"
+)
+
+// clusterShardedPubSub backs the PubSub returned by ClusterClient.SSubscribe.
+// Shard channels are subscribed on the master that owns their slot using
+// one connection per master, and messages from all connections are merged
+// into a single stream. Regular channels and patterns are subscribed on a
+// single random node.
+type clusterShardedPubSub struct {
+	c      *ClusterClient
+	pubSub *PubSub
+
+	msgCh chan pubSubReply
+
+	mu       sync.Mutex
+	channels map[string]*clusterNode // nil node means the channel must be resubscribed
+	shards   map[*clusterNode]*PubSub
+	global   *PubSub
+	closed   bool
+}
+
+type pubSubReply struct {
+	msg interface{}
+	err error
+}
+
+func (c *ClusterClient) shardedPubSub() *PubSub {
+	pubsub := &PubSub{
+		opt: c.opt.clientOptions(),
+	}
+	pubsub.init()
+
+	pubsub.sharded = &clusterShardedPubSub{
+		c:      c,
+		pubSub: pubsub,
+
+		msgCh: make(chan pubSubReply, 100),
+
+		channels: make(map[string]*clusterNode),
+		shards:   make(map[*clusterNode]*PubSub),
+	}
+	return pubsub
+}
+
+func (s *clusterShardedPubSub) channelNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	if s.global != nil {
+		s.global.mu.Lock()
+		channels = append(channels, mapKeys(s.global.channels)...)
+		channels = append(channels, mapKeys(s.global.patterns)...)
+		s.global.mu.Unlock()
+	}
+	return channels
+}
+
+// nodePubSub returns a PubSub that always connects to the given node.
+func (s *clusterShardedPubSub) nodePubSub(node *clusterNode) *PubSub {
+	pubsub := &PubSub{
+		opt: node.Client.opt,
+
+		newConn: func(ctx context.Context, _ []string) (*pool.Conn, error) {
+			return node.Client.newConn(ctx)
+		},
+		closeConn: node.Client.connPool.CloseConn,
+	}
+	pubsub.init()
+	pubsub.hooks = s.pubSub.hooks
+	return pubsub
+}
+
+// shard returns the PubSub for the node, creating it if needed.
+// s.mu must be held.
+func (s *clusterShardedPubSub) shard(node *clusterNode) *PubSub {
+	if pubsub, ok := s.shards[node]; ok {
+		return pubsub
+	}
+	pubsub := s.nodePubSub(node)
+	s.shards[node] = pubsub
+	go s.listen(pubsub, node)
+	return pubsub
+}
+
+// globalPubSub returns the PubSub for regular channels and patterns.
+// s.mu must be held.
+func (s *clusterShardedPubSub) globalPubSub() *PubSub {
+	if s.global == nil {
+		s.global = s.c.pubSub()
+		s.global.hooks = s.pubSub.hooks
+		go s.listen(s.global, nil)
+	}
+	return s.global
+}
+
+// subscribe subscribes to regular channels or patterns on the global PubSub.
+// The command runs without s.mu held, so a slow node doesn't block Close.
+func (s *clusterShardedPubSub) subscribe(ctx context.Context, redisCmd string, channels ...string) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return pool.ErrClosed
+	}
+	pubsub := s.globalPubSub()
+	s.mu.Unlock()
+
+	if redisCmd == "psubscribe" {
+		return pubsub.PSubscribe(ctx, channels...)
+	}
+	return pubsub.Subscribe(ctx, channels...)
+}
+
+func (s *clusterShardedPubSub) unsubscribe(ctx context.Context, redisCmd string, channels ...string) error {
+	s.mu.Lock()
+	pubsub := s.global
+	s.mu.Unlock()
+
+	if pubsub == nil {
+		return nil
+	}
+	if redisCmd == "punsubscribe" {
+		return pubsub.PUnsubscribe(ctx, channels...)
+	}
+	return pubsub.Unsubscribe(ctx, channels...)
+}
+
+// ssubscribe subscribes each shard channel on the master that owns its slot.
+// The channels are recorded under s.mu and the commands run after it is
+// released. Channels whose SSUBSCRIBE fails are forgotten again.
+func (s *clusterShardedPubSub) ssubscribe(ctx context.Context, channels ...string) error {
+	state, err := s.c.state.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return pool.ErrClosed
+	}
+
+	chansByNode := make(map[*clusterNode][]string)
+	for _, channel := range channels {
+		node, err := state.slotMasterNode(hashtag.Slot(channel))
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		if s.channels[channel] != nil {
+			continue
+		}
+		s.channels[channel] = node
+		chansByNode[node] = append(chansByNode[node], channel)
+	}
+
+	subscribes := make(map[*clusterNode]*PubSub, len(chansByNode))
+	for node := range chansByNode {
+		subscribes[node] = s.shard(node)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for node, channels := range chansByNode {
+		pubsub := subscribes[node]
+		if err := pubsub.SSubscribe(ctx, channels...); err != nil {
+			s.forget(pubsub, node, channels)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// forget removes shard channels that could not be subscribed on the node,
+// unless they were moved to another node in the meantime.
+func (s *clusterShardedPubSub) forget(pubsub *PubSub, node *clusterNode, channels []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pubsub.mu.Lock()
+	for _, channel := range channels {
+		if s.channels[channel] == node {
+			delete(s.channels, channel)
+			delete(pubsub.schannels, channel)
+		}
+	}
+	pubsub.mu.Unlock()
+}
+
+func (s *clusterShardedPubSub) sunsubscribe(ctx context.Context, channels ...string) error {
+	s.mu.Lock()
+	if len(channels) == 0 {
+		for channel := range s.channels {
+			channels = append(channels, channel)
+		}
+	}
+
+	unsubscribes := make(map[*PubSub][]string)
+	for _, channel := range channels {
+		node, ok := s.channels[channel]
+		if !ok {
+			continue
+		}
+		delete(s.channels, channel)
+		if node == nil {
+			continue
+		}
+		if pubsub, ok := s.shards[node]; ok {
+			unsubscribes[pubsub] = append(unsubscribes[pubsub], channel)
+		}
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for pubsub, channels := range unsubscribes {
+		if err := pubsub.SUnsubscribe(ctx, channels...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// resubscribe moves shard channels to the masters that currently own
+// their slots, for example after a slot migration or a failover.
+// The commands run without s.mu held, so they don't block Close and Ping.
+func (s *clusterShardedPubSub) resubscribe(ctx context.Context) {
+	s.mu.Lock()
+	skip := s.closed || len(s.channels) == 0
+	s.mu.Unlock()
+	if skip {
+		return
+	}
+
+	state, err := s.c.state.Reload(ctx)
+	if err != nil {
+		internal.Logger.Printf(ctx, "redis: sharded PubSub failed to reload cluster state: %s", err)
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	unsubscribes := make(map[*PubSub][]string)
+	chansByNode := make(map[*clusterNode][]string)
+	for channel, node := range s.channels {
+		owner, err := state.slotMasterNode(hashtag.Slot(channel))
+		if err != nil || owner == node {
+			continue
+		}
+		if pubsub, ok := s.shards[node]; ok {
+			unsubscribes[pubsub] = append(unsubscribes[pubsub], channel)
+		}
+		s.channels[channel] = owner
+		chansByNode[owner] = append(chansByNode[owner], channel)
+	}
+
+	subscribes := make(map[*clusterNode]*PubSub, len(chansByNode))
+	for node := range chansByNode {
+		subscribes[node] = s.shard(node)
+	}
+
+	used := make(map[*clusterNode]struct{}, len(s.shards))
+	for _, node := range s.channels {
+		if node != nil {
+			used[node] = struct{}{}
+		}
+	}
+	var unused []*PubSub
+	for node, pubsub := range s.shards {
+		if _, ok := used[node]; !ok {
+			delete(s.shards, node)
+			unused = append(unused, pubsub)
+		}
+	}
+	s.mu.Unlock()
+
+	for pubsub, channels := range unsubscribes {
+		_ = pubsub.SUnsubscribe(ctx, channels...)
+	}
+	for node, channels := range chansByNode {
+		if err := subscribes[node].SSubscribe(ctx, channels...); err != nil {
+			internal.Logger.Printf(ctx, "redis: sharded PubSub failed to resubscribe on %s: %s",
+				node.Client.opt.Addr, err)
+			s.pubSub.hooks.resubscribeError(ctx, err)
+		}
+	}
+	for _, pubsub := range unused {
+		_ = pubsub.Close()
+	}
+}
+
+// dropped reports whether a sunsubscribe received from the node was sent by
+// the server rather than requested by the client. That happens when the slot
+// of the channel is migrated away from the node.
+func (s *clusterShardedPubSub) dropped(pubsub *PubSub, node *clusterNode, channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.channels[channel] != node {
+		return false
+	}
+	s.channels[channel] = nil
+
+	pubsub.mu.Lock()
+	delete(pubsub.schannels, channel)
+	pubsub.mu.Unlock()
+
+	return true
+}
+
+// listen forwards messages from the PubSub to the merged stream.
+// The node is nil for the PubSub that serves regular channels.
+func (s *clusterShardedPubSub) listen(pubsub *PubSub, node *clusterNode) {
+	ctx := context.Background()
+
+	var errCount int
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err == pool.ErrClosed {
+			return
+		}
+		if err != nil {
+			if errCount > 0 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			errCount++
+			if node != nil {
+				s.resubscribe(ctx)
+			}
+		} else {
+			errCount = 0
+			if sub, ok := msg.(*Subscription); ok && node != nil && sub.Kind == "sunsubscribe" {
+				if s.dropped(pubsub, node, sub.Channel) {
+					s.resubscribe(ctx)
+				}
+			}
+		}
+
+		select {
+		case s.msgCh <- pubSubReply{msg: msg, err: err}:
+		case <-s.pubSub.exit:
+			return
+		}
+	}
+}
+
+func (s *clusterShardedPubSub) receive(ctx context.Context, timeout time.Duration) (interface{}, error) {
+	return receivePubSubReply(ctx, s.msgCh, s.pubSub.exit, timeout)
+}
+
+// receivePubSubReply receives a reply merged from other connections.
+func receivePubSubReply(
+	ctx context.Context, msgCh <-chan pubSubReply, exit <-chan struct{}, timeout time.Duration,
+) (interface{}, error) {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case reply := <-msgCh:
+		return reply.msg, reply.err
+	case <-exit:
+		return nil, pool.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer:
+		return nil, pubSubTimeoutError{}
+	}
+}
+
+func (s *clusterShardedPubSub) ping(ctx context.Context, payload ...string) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return pool.ErrClosed
+	}
+	pubsubs := make([]*PubSub, 0, len(s.shards)+1)
+	for _, pubsub := range s.shards {
+		pubsubs = append(pubsubs, pubsub)
+	}
+	if s.global != nil {
+		pubsubs = append(pubsubs, s.global)
+	}
+	s.mu.Unlock()
+
+	if len(pubsubs) == 0 {
+		// No connection to ping, so ping the cluster and deliver the Pong
+		// like a connection does.
+		return s.pingCluster(ctx, payload...)
+	}
+
+	var firstErr error
+	for _, pubsub := range pubsubs {
+		if err := pubsub.Ping(ctx, payload...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *clusterShardedPubSub) pingCluster(ctx context.Context, payload ...string) error {
+	args := []interface{}{"ping"}
+	if len(payload) == 1 {
+		args = append(args, payload[0])
+	}
+	cmd := NewStringCmd(ctx, args...)
+	if err := s.c.Process(ctx, cmd); err != nil {
+		return err
+	}
+
+	pong := &Pong{}
+	if len(payload) == 1 {
+		pong.Payload = cmd.Val()
+	}
+	select {
+	case s.msgCh <- pubSubReply{msg: pong}:
+		return nil
+	case <-s.pubSub.exit:
+		return pool.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *clusterShardedPubSub) close() error {
+	s.mu.Lock()
+	s.closed = true
+	pubsubs := make([]*PubSub, 0, len(s.shards)+1)
+	for node, pubsub := range s.shards {
+		delete(s.shards, node)
+		pubsubs = append(pubsubs, pubsub)
+	}
+	if s.global != nil {
+		pubsubs = append(pubsubs, s.global)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, pubsub := range pubsubs {
+		if err := pubsub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type pubSubTimeoutError struct{}
+
+func (pubSubTimeoutError) Error() string   { return "redis: PubSub receive timeout" }
+func (pubSubTimeoutError) Timeout() bool   { return true }
+func (pubSubTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9/internal/rand"
+)
+
+// ReadRouterNode describes a node that is able to serve read-only commands
+// for a slot.
+type ReadRouterNode struct {
+	// Addr is the host:port address of the node.
+	Addr string
+	// Master reports whether the node owns the slot.
+	Master bool
+	// Latency is the measured round trip time to the node.
+	Latency time.Duration
+	// Failing reports whether the node recently failed or is still loading.
+	Failing bool
+	// Zone is the zone returned by the NodeZone option for the node address.
+	Zone string
+}
+
+// ReadRouter picks the node that serves a read-only command.
+type ReadRouter interface {
+	// RouteRead returns the index of the node that should serve the command.
+	// The first node is always the slot master and the rest are replicas.
+	// An index out of range routes the command to the master.
+	RouteRead(nodes []ReadRouterNode) int
+}
+
+// ReadRouterFunc is an adapter to use an ordinary function as a ReadRouter.
+type ReadRouterFunc func(nodes []ReadRouterNode) int
+
+func (fn ReadRouterFunc) RouteRead(nodes []ReadRouterNode) int {
+	return fn(nodes)
+}
+
+// NewZoneReadRouter returns a ReadRouter that picks the closest healthy node
+// in the given zone. When the zone has no healthy nodes it picks the closest
+// healthy node in any zone.
+func NewZoneReadRouter(zone string) ReadRouter {
+	return ReadRouterFunc(func(nodes []ReadRouterNode) int {
+		if i := closestReadNode(nodes, zone, true); i >= 0 {
+			return i
+		}
+		if i := closestReadNode(nodes, "", false); i >= 0 {
+			return i
+		}
+		return 0
+	})
+}
+
+// NewReplicaReadRouter returns a ReadRouter that picks a random healthy
+// replica and falls back to the master when there are no healthy replicas.
+func NewReplicaReadRouter() ReadRouter {
+	return ReadRouterFunc(func(nodes []ReadRouterNode) int {
+		if len(nodes) <= 1 {
+			return 0
+		}
+		for _, n := range rand.Perm(len(nodes) - 1) {
+			if !nodes[n+1].Failing {
+				return n + 1
+			}
+		}
+		return 0
+	})
+}
+
+func closestReadNode(nodes []ReadRouterNode, zone string, sameZone bool) int {
+	idx := -1
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Failing || (sameZone && node.Zone != zone) {
+			continue
+		}
+		if idx == -1 || node.Latency < nodes[idx].Latency {
+			idx = i
+		}
+	}
+	return idx
+}
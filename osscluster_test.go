@@ -575,6 +575,67 @@ var _ = Describe("ClusterClient", func() {
 			}, 30*time.Second).ShouldNot(HaveOccurred())
 		})
 
+		It("supports sharded PubSub across nodes", func() {
+			// The channels hash to slots owned by different masters.
+			channels := []string{"b", "c", "d"}
+
+			pubsub := client.SSubscribe(ctx, channels...)
+			defer pubsub.Close()
+
+			ch := pubsub.Channel()
+
+			for _, channel := range channels {
+				Eventually(func() int64 {
+					return client.SPublish(ctx, channel, "hello "+channel).Val()
+				}, 30*time.Second).Should(Equal(int64(1)))
+			}
+
+			var got []string
+			for range channels {
+				var msg *redis.Message
+				Eventually(ch, 5*time.Second).Should(Receive(&msg))
+				got = append(got, msg.Payload)
+			}
+			Expect(got).To(ConsistOf("hello b", "hello c", "hello d"))
+
+			Expect(pubsub.SUnsubscribe(ctx, "c")).NotTo(HaveOccurred())
+			Eventually(func() int64 {
+				return client.SPublish(ctx, "c", "hello c").Val()
+			}, 30*time.Second).Should(Equal(int64(0)))
+		})
+
+		It("delivers keyspace notifications of every master", func() {
+			sub, err := client.SubscribeKeyspace(ctx, &redis.KeyspaceOptions{
+				NotifyFlags: "K$",
+				Types:       []redis.KeyspaceEventType{redis.KeyspaceEventSet},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer sub.Close()
+
+			ch := sub.Channel()
+
+			// The keys hash to slots owned by different masters.
+			keys := []string{"b", "c", "d"}
+			Eventually(func() error {
+				for _, key := range keys {
+					if err := client.Set(ctx, key, "value", 0).Err(); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, 30*time.Second).ShouldNot(HaveOccurred())
+
+			got := make(map[string]string)
+			for len(got) < len(keys) {
+				var event *redis.KeyspaceEvent
+				Eventually(ch, 5*time.Second).Should(Receive(&event))
+				Expect(event.Type).To(Equal(redis.KeyspaceEventSet))
+				got[event.Key] = event.Addr
+			}
+			Expect(got).To(HaveLen(3))
+			Expect(got["b"]).NotTo(Equal(got["c"]))
+		})
+
 		It("supports PubSub.Ping without channels", func() {
 			pubsub := client.Subscribe(ctx)
 			defer pubsub.Close()
@@ -840,6 +901,40 @@ var _ = Describe("ClusterClient", func() {
 			Expect(nodesList).Should(HaveLen(1))
 		})
 
+		It("should CLUSTER REPLICAS", func() {
+			nodesList, err := client.ClusterReplicas(ctx, cluster.nodeIDs[0]).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodesList).Should(ContainElement(ContainSubstring("slave")))
+			Expect(nodesList).Should(HaveLen(1))
+		})
+
+		It("should CLUSTER MYID", func() {
+			id, err := cluster.masters()[0].ClusterMyID(ctx).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal(cluster.nodeIDs[0]))
+		})
+
+		It("should CLUSTER SETSLOT", func() {
+			slot := hashtag.Slot("setslot")
+			pos := slot / 5000
+			if pos > 2 {
+				pos = 2
+			}
+			master := cluster.masters()[pos]
+			targetID := cluster.nodeIDs[(pos+1)%3]
+
+			res, err := master.ClusterSetSlotMigrating(ctx, slot, targetID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal("OK"))
+			Expect(master.ClusterNodes(ctx).Val()).To(ContainSubstring(
+				fmt.Sprintf("[%d->-%s]", slot, targetID)))
+
+			res, err = master.ClusterSetSlotStable(ctx, slot).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal("OK"))
+			Expect(master.ClusterNodes(ctx).Val()).NotTo(ContainSubstring("->-"))
+		})
+
 		It("should RANDOMKEY", func() {
 			const nkeys = 100
 
@@ -1284,6 +1379,280 @@ var _ = Describe("ClusterClient", func() {
 	})
 })
 
+var _ = Describe("ClusterClient with migrating slot", func() {
+	const tag = "{migrating}"
+
+	var client *redis.ClusterClient
+	var source, target *redis.Client
+	var targetPort string
+	var slot int
+
+	BeforeEach(func() {
+		client = cluster.newClusterClient(ctx, redisClusterOptions())
+		err := client.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return master.FlushDB(ctx).Err()
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		slot = hashtag.Slot(tag)
+		sourcePos := slot / 5000
+		if sourcePos > 2 {
+			sourcePos = 2
+		}
+		targetPos := (sourcePos + 1) % 3
+
+		source = cluster.masters()[sourcePos]
+		target = cluster.masters()[targetPos]
+		targetPort = cluster.ports[targetPos]
+
+		err = target.Do(ctx, "cluster", "setslot", slot, "importing", cluster.nodeIDs[sourcePos]).Err()
+		Expect(err).NotTo(HaveOccurred())
+		err = source.Do(ctx, "cluster", "setslot", slot, "migrating", cluster.nodeIDs[targetPos]).Err()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, master := range cluster.masters() {
+			Expect(master.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+			Expect(master.Do(ctx, "cluster", "setslot", slot, "stable").Err()).NotTo(HaveOccurred())
+		}
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	targetGet := func(key string) *redis.StringCmd {
+		var get *redis.StringCmd
+		_, _ = target.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Do(ctx, "asking")
+			get = pipe.Get(ctx, key)
+			return nil
+		})
+		return get
+	}
+
+	It("sends ASKING before ASK-redirected pipeline commands", func() {
+		cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, tag+"a", "a", 0)
+			pipe.Set(ctx, tag+"b", "b", 0)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmds).To(HaveLen(2))
+
+		Expect(source.Exists(ctx, tag+"a", tag+"b").Val()).To(Equal(int64(0)))
+		Expect(targetGet(tag + "a").Val()).To(Equal("a"))
+		Expect(targetGet(tag + "b").Val()).To(Equal("b"))
+	})
+
+	It("retries multi-key commands split by the migration", func() {
+		Expect(source.Set(ctx, tag+"a", "a", 0).Err()).NotTo(HaveOccurred())
+		_, err := target.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Do(ctx, "asking")
+			pipe.Set(ctx, tag+"b", "b", 0)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = source.MGet(ctx, tag+"a", tag+"b").Err()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("TRYAGAIN"))
+
+		go func() {
+			defer GinkgoRecover()
+
+			time.Sleep(20 * time.Millisecond)
+			err := source.Migrate(ctx, "127.0.0.1", targetPort, tag+"a", 0, time.Second).Err()
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		var mget *redis.SliceCmd
+		_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			mget = pipe.MGet(ctx, tag+"a", tag+"b")
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mget.Val()).To(Equal([]interface{}{"a", "b"}))
+
+		vals, err := client.MGet(ctx, tag+"a", tag+"b").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vals).To(Equal([]interface{}{"a", "b"}))
+	})
+
+	It("runs transactions on the target when all keys are migrated", func() {
+		_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, tag+"a", "a", 0)
+			pipe.Set(ctx, tag+"b", "b", 0)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(source.Exists(ctx, tag+"a", tag+"b").Val()).To(Equal(int64(0)))
+		Expect(targetGet(tag + "a").Val()).To(Equal("a"))
+		Expect(targetGet(tag + "b").Val()).To(Equal("b"))
+	})
+
+	It("returns TxSlotMigratingError for transactions crossing the migration", func() {
+		Expect(source.Set(ctx, tag+"a", "a", 0).Err()).NotTo(HaveOccurred())
+
+		cmds, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, tag+"a")
+			pipe.Incr(ctx, tag+"b")
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+
+		var migratingErr *redis.TxSlotMigratingError
+		Expect(errors.As(err, &migratingErr)).To(BeTrue())
+		Expect(migratingErr.Slot).To(Equal(slot))
+		Expect(migratingErr.Addr).To(Equal(net.JoinHostPort("127.0.0.1", targetPort)))
+		for _, cmd := range cmds {
+			Expect(cmd.Err()).To(Equal(err))
+		}
+
+		Expect(source.Get(ctx, tag+"a").Val()).To(Equal("a"))
+	})
+})
+
+var _ = Describe("ClusterClient MigrateSlots", func() {
+	const tag = "{reshard}"
+
+	var client *redis.ClusterClient
+	var move, back redis.ClusterSlotMove
+	var target *redis.Client
+
+	BeforeEach(func() {
+		client = cluster.newClusterClient(ctx, redisClusterOptions())
+		err := client.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return master.FlushDB(ctx).Err()
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		slot := hashtag.Slot(tag)
+		sourcePos := slot / 5000
+		if sourcePos > 2 {
+			sourcePos = 2
+		}
+		targetPos := (sourcePos + 1) % 3
+		target = cluster.masters()[targetPos]
+
+		move = redis.ClusterSlotMove{
+			SourceID: cluster.nodeIDs[sourcePos],
+			TargetID: cluster.nodeIDs[targetPos],
+			Start:    slot,
+			End:      slot,
+		}
+		back = redis.ClusterSlotMove{
+			SourceID: move.TargetID,
+			TargetID: move.SourceID,
+			Start:    slot,
+			End:      slot,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(client.MigrateSlots(ctx, back, nil)).NotTo(HaveOccurred())
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("moves slots with their keys", func() {
+		for i := 0; i < 10; i++ {
+			err := client.Set(ctx, fmt.Sprintf("%skey%d", tag, i), i, 0).Err()
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var progress []redis.ClusterMigrateProgress
+		err := client.MigrateSlots(ctx, move, &redis.ClusterMigrateOptions{
+			BatchSize: 3,
+			Progress: func(p redis.ClusterMigrateProgress) {
+				progress = append(progress, p)
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(progress).To(HaveLen(5))
+		last := progress[len(progress)-1]
+		Expect(last.Keys).To(Equal(int64(10)))
+		Expect(last.DoneSlots).To(Equal(1))
+
+		n, err := target.ClusterCountKeysInSlot(ctx, move.Start).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(10)))
+
+		for i := 0; i < 10; i++ {
+			val, err := client.Get(ctx, fmt.Sprintf("%skey%d", tag, i)).Int()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(val).To(Equal(i))
+		}
+
+		// Moving the slots again only reports them as done.
+		progress = nil
+		err = client.MigrateSlots(ctx, move, &redis.ClusterMigrateOptions{
+			Progress: func(p redis.ClusterMigrateProgress) {
+				progress = append(progress, p)
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(progress).To(HaveLen(1))
+		Expect(progress[0].DoneSlots).To(Equal(1))
+	})
+
+	It("resubscribes shard channels after the slot is moved", func() {
+		channel := tag + "channel"
+
+		pubsub := client.SSubscribe(ctx, channel)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+
+		Eventually(func() int64 {
+			return client.SPublish(ctx, channel, "before").Val()
+		}, 30*time.Second).Should(Equal(int64(1)))
+
+		var msg *redis.Message
+		Eventually(ch, 5*time.Second).Should(Receive(&msg))
+		Expect(msg.Payload).To(Equal("before"))
+
+		Expect(client.MigrateSlots(ctx, move, nil)).NotTo(HaveOccurred())
+
+		Eventually(func() int64 {
+			return target.SPublish(ctx, channel, "after").Val()
+		}, 30*time.Second).Should(Equal(int64(1)))
+
+		Eventually(ch, 5*time.Second).Should(Receive(&msg))
+		Expect(msg.Payload).To(Equal("after"))
+	})
+
+	It("resumes an interrupted move", func() {
+		Expect(client.Set(ctx, tag+"a", "a", 0).Err()).NotTo(HaveOccurred())
+
+		// Simulate a move that was interrupted after marking the slot.
+		err := target.ClusterSetSlotImporting(ctx, move.Start, move.SourceID).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.MigrateSlots(ctx, move, nil)).NotTo(HaveOccurred())
+		Expect(target.ClusterCountKeysInSlot(ctx, move.Start).Val()).To(Equal(int64(1)))
+	})
+
+	It("returns ClusterMigrateError for slots owned by other nodes", func() {
+		var thirdPos int
+		for pos, id := range cluster.nodeIDs[:3] {
+			if id != move.SourceID && id != move.TargetID {
+				thirdPos = pos
+			}
+		}
+		slot := thirdPos * 5000
+
+		err := client.MigrateSlots(ctx, redis.ClusterSlotMove{
+			SourceID: move.SourceID,
+			TargetID: move.TargetID,
+			Start:    slot,
+			End:      slot,
+		}, nil)
+		var migrateErr *redis.ClusterMigrateError
+		Expect(errors.As(err, &migrateErr)).To(BeTrue())
+		Expect(migrateErr.Slot).To(Equal(slot))
+	})
+})
+
 var _ = Describe("ClusterClient without nodes", func() {
 	var client *redis.ClusterClient
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9/internal"
@@ -38,23 +39,146 @@ type PubSub struct {
 	chOnce sync.Once
 	msgCh  *channel
 	allCh  *channel
+
+	// sharded is set for cluster PubSub that spreads shard channels
+	// across the nodes that own them.
+	sharded *clusterShardedPubSub
+	// muxed is set for PubSub that shares the RESP3 connection of
+	// a client with Options.MultiplexPubSub.
+	muxed *pubSubMuxSub
+
+	stats *PubSubStats
+	hooks *pubSubHooks
+
+	// disconnectedAt is the time the last connection was discarded
+	// because of an error. It is zero while the PubSub is connected.
+	disconnectedAt time.Time
+	// callbacks are the lifecycle callbacks queued while mu is held,
+	// called by unlock.
+	callbacks []func()
 }
 
 func (c *PubSub) init() {
 	c.exit = make(chan struct{})
+	c.stats = new(PubSubStats)
+	c.hooks = new(pubSubHooks)
+}
+
+// pubSubHooks are the lifecycle callbacks of a PubSub. They are shared
+// with the node PubSubs of a cluster PubSub.
+type pubSubHooks struct {
+	mu                 sync.RWMutex
+	onDisconnect       func(ctx context.Context, reason error)
+	onReconnect        func(ctx context.Context, downtime time.Duration)
+	onResubscribeError func(ctx context.Context, err error)
+}
+
+func (hs *pubSubHooks) disconnect(ctx context.Context, reason error) {
+	hs.mu.RLock()
+	fn := hs.onDisconnect
+	hs.mu.RUnlock()
+	if fn != nil {
+		fn(ctx, reason)
+	}
+}
+
+func (hs *pubSubHooks) reconnect(ctx context.Context, downtime time.Duration) {
+	hs.mu.RLock()
+	fn := hs.onReconnect
+	hs.mu.RUnlock()
+	if fn != nil {
+		fn(ctx, downtime)
+	}
+}
+
+func (hs *pubSubHooks) resubscribeError(ctx context.Context, err error) {
+	hs.mu.RLock()
+	fn := hs.onResubscribeError
+	hs.mu.RUnlock()
+	if fn != nil {
+		fn(ctx, err)
+	}
+}
+
+// OnDisconnect sets the function called when the connection is discarded
+// because of a network error or a failed health check. Messages published
+// until OnReconnect is called are lost.
+//
+// The lifecycle callbacks are called after the PubSub is unlocked, so they
+// may call the methods of the PubSub.
+func (c *PubSub) OnDisconnect(fn func(ctx context.Context, reason error)) {
+	c.hooks.mu.Lock()
+	c.hooks.onDisconnect = fn
+	c.hooks.mu.Unlock()
+}
+
+// OnReconnect sets the function called when a new connection is subscribed
+// to the channels again after a disconnect. Downtime is the time since the
+// previous connection was discarded. Applications can use it to resync state
+// that could have changed during the gap.
+func (c *PubSub) OnReconnect(fn func(ctx context.Context, downtime time.Duration)) {
+	c.hooks.mu.Lock()
+	c.hooks.onReconnect = fn
+	c.hooks.mu.Unlock()
+}
+
+// OnResubscribeError sets the function called when subscribing to the
+// channels on a new connection fails. The PubSub tries again on the next
+// receive.
+func (c *PubSub) OnResubscribeError(fn func(ctx context.Context, err error)) {
+	c.hooks.mu.Lock()
+	c.hooks.onResubscribeError = fn
+	c.hooks.mu.Unlock()
+}
+
+// PubSubStats are the delivery counters of a PubSub.
+type PubSubStats struct {
+	// Received is the number of messages received from the server.
+	Received uint64
+	// Delivered is the number of messages sent to the Go channel.
+	Delivered uint64
+	// Dropped is the number of messages dropped because the Go channel was full,
+	// or the queue of the PubSub with Options.MultiplexPubSub.
+	Dropped uint64
+	// Reconnects is the number of times the connection was replaced.
+	Reconnects uint64
+}
+
+// Stats returns the delivery counters of the PubSub.
+func (c *PubSub) Stats() *PubSubStats {
+	return &PubSubStats{
+		Received:   atomic.LoadUint64(&c.stats.Received),
+		Delivered:  atomic.LoadUint64(&c.stats.Delivered),
+		Dropped:    atomic.LoadUint64(&c.stats.Dropped),
+		Reconnects: atomic.LoadUint64(&c.stats.Reconnects),
+	}
 }
 
 func (c *PubSub) String() string {
+	if c.sharded != nil {
+		return fmt.Sprintf("PubSub(%s)", strings.Join(c.sharded.channelNames(), ", "))
+	}
 	channels := mapKeys(c.channels)
 	channels = append(channels, mapKeys(c.patterns)...)
 	channels = append(channels, mapKeys(c.schannels)...)
 	return fmt.Sprintf("PubSub(%s)", strings.Join(channels, ", "))
 }
 
+// unlock releases c.mu and calls the callbacks queued while it was held.
+func (c *PubSub) unlock() {
+	callbacks := c.callbacks
+	c.callbacks = nil
+	c.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
 func (c *PubSub) connWithLock(ctx context.Context) (*pool.Conn, error) {
 	c.mu.Lock()
 	cn, err := c.conn(ctx, nil)
-	c.mu.Unlock()
+	c.unlock()
 	return cn, err
 }
 
@@ -76,10 +200,16 @@ func (c *PubSub) conn(ctx context.Context, newChannels []string) (*pool.Conn, er
 
 	if err := c.resubscribe(ctx, cn); err != nil {
 		_ = c.closeConn(cn)
+		c.callbacks = append(c.callbacks, func() { c.hooks.resubscribeError(ctx, err) })
 		return nil, err
 	}
 
 	c.cn = cn
+	if !c.disconnectedAt.IsZero() {
+		downtime := time.Since(c.disconnectedAt)
+		c.disconnectedAt = time.Time{}
+		c.callbacks = append(c.callbacks, func() { c.hooks.reconnect(ctx, downtime) })
+	}
 	return cn, nil
 }
 
@@ -143,7 +273,7 @@ func (c *PubSub) releaseConnWithLock(
 ) {
 	c.mu.Lock()
 	c.releaseConn(ctx, cn, err, allowTimeout)
-	c.mu.Unlock()
+	c.unlock()
 }
 
 func (c *PubSub) releaseConn(ctx context.Context, cn *pool.Conn, err error, allowTimeout bool) {
@@ -155,7 +285,28 @@ func (c *PubSub) releaseConn(ctx context.Context, cn *pool.Conn, err error, allo
 	}
 }
 
+// reconnectWithLock replaces the connection after a failed health check.
+// Sharded cluster PubSub resubscribes its own connections, which reloads
+// the cluster state, so it runs without c.mu held.
+func (c *PubSub) reconnectWithLock(ctx context.Context, reason error) {
+	if c.sharded != nil {
+		atomic.AddUint64(&c.stats.Reconnects, 1)
+		c.sharded.resubscribe(ctx)
+		return
+	}
+
+	c.mu.Lock()
+	c.reconnect(ctx, reason)
+	c.unlock()
+}
+
 func (c *PubSub) reconnect(ctx context.Context, reason error) {
+	atomic.AddUint64(&c.stats.Reconnects, 1)
+
+	if c.muxed != nil {
+		c.muxed.mux.reset()
+		return
+	}
 	_ = c.closeTheCn(reason)
 	_, _ = c.conn(ctx, nil)
 }
@@ -164,17 +315,20 @@ func (c *PubSub) closeTheCn(reason error) error {
 	if c.cn == nil {
 		return nil
 	}
-	if !c.closed {
-		internal.Logger.Printf(c.getContext(), "redis: discarding bad PubSub connection: %s", reason)
-	}
 	err := c.closeConn(c.cn)
 	c.cn = nil
+	if !c.closed {
+		ctx := c.getContext()
+		internal.Logger.Printf(ctx, "redis: discarding bad PubSub connection: %s", reason)
+		c.disconnectedAt = time.Now()
+		c.callbacks = append(c.callbacks, func() { c.hooks.disconnect(ctx, reason) })
+	}
 	return err
 }
 
 func (c *PubSub) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	if c.closed {
 		return pool.ErrClosed
@@ -182,14 +336,27 @@ func (c *PubSub) Close() error {
 	c.closed = true
 	close(c.exit)
 
+	if c.sharded != nil {
+		return c.sharded.close()
+	}
+	if c.muxed != nil {
+		return c.muxed.mux.remove(context.Background(), c.muxed)
+	}
 	return c.closeTheCn(pool.ErrClosed)
 }
 
 // Subscribe the client to the specified channels. It returns
 // empty subscription if there are no channels.
 func (c *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	if c.sharded != nil {
+		return c.sharded.subscribe(ctx, "subscribe", channels...)
+	}
+	if c.muxed != nil {
+		return c.muxed.subscribe(ctx, "subscribe", channels...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	err := c.subscribe(ctx, "subscribe", channels...)
 	if c.channels == nil {
@@ -204,8 +371,15 @@ func (c *PubSub) Subscribe(ctx context.Context, channels ...string) error {
 // PSubscribe the client to the given patterns. It returns
 // empty subscription if there are no patterns.
 func (c *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	if c.sharded != nil {
+		return c.sharded.subscribe(ctx, "psubscribe", patterns...)
+	}
+	if c.muxed != nil {
+		return c.muxed.subscribe(ctx, "psubscribe", patterns...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	err := c.subscribe(ctx, "psubscribe", patterns...)
 	if c.patterns == nil {
@@ -219,8 +393,15 @@ func (c *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
 
 // SSubscribe Subscribes the client to the specified shard channels.
 func (c *PubSub) SSubscribe(ctx context.Context, channels ...string) error {
+	if c.sharded != nil {
+		return c.sharded.ssubscribe(ctx, channels...)
+	}
+	if c.muxed != nil {
+		return c.muxed.subscribe(ctx, "ssubscribe", channels...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	err := c.subscribe(ctx, "ssubscribe", channels...)
 	if c.schannels == nil {
@@ -235,8 +416,15 @@ func (c *PubSub) SSubscribe(ctx context.Context, channels ...string) error {
 // Unsubscribe the client from the given channels, or from all of
 // them if none is given.
 func (c *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	if c.sharded != nil {
+		return c.sharded.unsubscribe(ctx, "unsubscribe", channels...)
+	}
+	if c.muxed != nil {
+		return c.muxed.unsubscribe(ctx, "unsubscribe", channels...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	if len(channels) > 0 {
 		for _, channel := range channels {
@@ -256,8 +444,15 @@ func (c *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
 // PUnsubscribe the client from the given patterns, or from all of
 // them if none is given.
 func (c *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	if c.sharded != nil {
+		return c.sharded.unsubscribe(ctx, "punsubscribe", patterns...)
+	}
+	if c.muxed != nil {
+		return c.muxed.unsubscribe(ctx, "punsubscribe", patterns...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	if len(patterns) > 0 {
 		for _, pattern := range patterns {
@@ -277,8 +472,15 @@ func (c *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
 // SUnsubscribe unsubscribes the client from the given shard channels,
 // or from all of them if none is given.
 func (c *PubSub) SUnsubscribe(ctx context.Context, channels ...string) error {
+	if c.sharded != nil {
+		return c.sharded.sunsubscribe(ctx, channels...)
+	}
+	if c.muxed != nil {
+		return c.muxed.unsubscribe(ctx, "sunsubscribe", channels...)
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	if len(channels) > 0 {
 		for _, channel := range channels {
@@ -307,6 +509,13 @@ func (c *PubSub) subscribe(ctx context.Context, redisCmd string, channels ...str
 }
 
 func (c *PubSub) Ping(ctx context.Context, payload ...string) error {
+	if c.sharded != nil {
+		return c.sharded.ping(ctx, payload...)
+	}
+	if c.muxed != nil {
+		return c.muxed.ping(ctx, payload...)
+	}
+
 	args := []interface{}{"ping"}
 	if len(payload) == 1 {
 		args = append(args, payload[0])
@@ -314,7 +523,7 @@ func (c *PubSub) Ping(ctx context.Context, payload ...string) error {
 	cmd := NewCmd(ctx, args...)
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
 	cn, err := c.conn(ctx, nil)
 	if err != nil {
@@ -421,6 +630,21 @@ func (c *PubSub) newMessage(reply interface{}) (interface{}, error) {
 // is not received in time. This is low-level API and in most cases
 // Channel should be used instead.
 func (c *PubSub) ReceiveTimeout(ctx context.Context, timeout time.Duration) (interface{}, error) {
+	msg, err := c.receiveTimeout(ctx, timeout)
+	if _, ok := msg.(*Message); ok {
+		atomic.AddUint64(&c.stats.Received, 1)
+	}
+	return msg, err
+}
+
+func (c *PubSub) receiveTimeout(ctx context.Context, timeout time.Duration) (interface{}, error) {
+	if c.sharded != nil {
+		return c.sharded.receive(ctx, timeout)
+	}
+	if c.muxed != nil {
+		return c.muxed.receive(ctx, timeout)
+	}
+
 	if c.cmd == nil {
 		c.cmd = NewCmd(ctx)
 	}
@@ -487,7 +711,8 @@ func (c *PubSub) getContext() context.Context {
 
 // Channel returns a Go channel for concurrently receiving messages.
 // The channel is closed together with the PubSub. If the Go channel
-// is blocked full for 1 minute the message is dropped.
+// is blocked full for 1 minute the message is dropped, see
+// WithChannelOverflow for other policies.
 // Receive* APIs can not be used after channel is created.
 //
 // go-redis periodically sends ping messages to test connection health
@@ -552,7 +777,7 @@ func WithChannelHealthCheckInterval(d time.Duration) ChannelOption {
 }
 
 // WithChannelSendTimeout specifies the channel send timeout after which
-// the message is dropped.
+// the message is dropped when ChannelOverflowBlock is used.
 //
 // The default is 60 seconds.
 func WithChannelSendTimeout(d time.Duration) ChannelOption {
@@ -561,6 +786,42 @@ func WithChannelSendTimeout(d time.Duration) ChannelOption {
 	}
 }
 
+// ChannelOverflowPolicy decides what happens to a message
+// when the Go channel is full.
+type ChannelOverflowPolicy int
+
+const (
+	// ChannelOverflowBlock waits for the consumer up to the send timeout
+	// and drops the message after that.
+	ChannelOverflowBlock ChannelOverflowPolicy = iota
+	// ChannelOverflowDropNewest drops the message immediately.
+	ChannelOverflowDropNewest
+	// ChannelOverflowDropOldest drops the oldest buffered message to make
+	// room for the new one.
+	ChannelOverflowDropOldest
+	// ChannelOverflowDisconnect drops the message and closes the PubSub,
+	// which also closes the Go channel.
+	ChannelOverflowDisconnect
+)
+
+// WithChannelOverflow specifies what happens to a message when the Go chan
+// is full.
+//
+// The default is ChannelOverflowBlock.
+func WithChannelOverflow(policy ChannelOverflowPolicy) ChannelOption {
+	return func(c *channel) {
+		c.overflow = policy
+	}
+}
+
+// WithChannelOnDrop specifies a function that is called with every message
+// dropped because the Go chan is full.
+func WithChannelOnDrop(fn func(msg *Message)) ChannelOption {
+	return func(c *channel) {
+		c.onDrop = fn
+	}
+}
+
 type channel struct {
 	pubSub *PubSub
 
@@ -571,6 +832,8 @@ type channel struct {
 	chanSize        int
 	chanSendTimeout time.Duration
 	checkInterval   time.Duration
+	overflow        ChannelOverflowPolicy
+	onDrop          func(msg *Message)
 }
 
 func newChannel(pubSub *PubSub, opts ...ChannelOption) *channel {
@@ -607,9 +870,7 @@ func (c *channel) initHealthCheck() {
 				}
 			case <-timer.C:
 				if pingErr := c.pubSub.Ping(ctx); pingErr != nil {
-					c.pubSub.mu.Lock()
-					c.pubSub.reconnect(ctx, pingErr)
-					c.pubSub.mu.Unlock()
+					c.pubSub.reconnectWithLock(ctx, pingErr)
 				}
 			case <-c.pubSub.exit:
 				return
@@ -656,17 +917,7 @@ func (c *channel) initMsgChan() {
 			case *Pong:
 				// Ignore.
 			case *Message:
-				timer.Reset(c.chanSendTimeout)
-				select {
-				case c.msgCh <- msg:
-					if !timer.Stop() {
-						<-timer.C
-					}
-				case <-timer.C:
-					internal.Logger.Printf(
-						ctx, "redis: %s channel is full for %s (message is dropped)",
-						c, c.chanSendTimeout)
-				}
+				c.deliver(ctx, msg, timer)
 			default:
 				internal.Logger.Printf(ctx, "redis: unknown message type: %T", msg)
 			}
@@ -710,20 +961,117 @@ func (c *channel) initAllChan() {
 			case *Pong:
 				// Ignore.
 			case *Subscription, *Message:
-				timer.Reset(c.chanSendTimeout)
-				select {
-				case c.allCh <- msg:
-					if !timer.Stop() {
-						<-timer.C
-					}
-				case <-timer.C:
-					internal.Logger.Printf(
-						ctx, "redis: %s channel is full for %s (message is dropped)",
-						c, c.chanSendTimeout)
-				}
+				c.deliver(ctx, msg, timer)
 			default:
 				internal.Logger.Printf(ctx, "redis: unknown message type: %T", msg)
 			}
 		}
 	}()
 }
+
+// deliver sends the message to the Go chan according to the overflow policy.
+func (c *channel) deliver(ctx context.Context, msg interface{}, timer *time.Timer) {
+	switch c.overflow {
+	case ChannelOverflowDropNewest:
+		if !c.trySend(msg) {
+			c.drop(msg)
+			return
+		}
+	case ChannelOverflowDropOldest:
+		for !c.trySend(msg) {
+			if old := c.tryReceive(); old != nil {
+				if _, ok := old.(*Message); ok {
+					// The message was counted as delivered.
+					atomic.AddUint64(&c.pubSub.stats.Delivered, ^uint64(0))
+				}
+				c.drop(old)
+			}
+		}
+	case ChannelOverflowDisconnect:
+		if !c.trySend(msg) {
+			c.drop(msg)
+			internal.Logger.Printf(ctx, "redis: %s channel is full (closing PubSub)", c)
+			_ = c.pubSub.Close()
+			return
+		}
+	default:
+		timer.Reset(c.chanSendTimeout)
+		if !c.sendTimeout(msg, timer) {
+			internal.Logger.Printf(
+				ctx, "redis: %s channel is full for %s (message is dropped)",
+				c, c.chanSendTimeout)
+			c.drop(msg)
+			return
+		}
+		if !timer.Stop() {
+			<-timer.C
+		}
+	}
+
+	if _, ok := msg.(*Message); ok {
+		atomic.AddUint64(&c.pubSub.stats.Delivered, 1)
+	}
+}
+
+func (c *channel) trySend(msg interface{}) bool {
+	if c.msgCh != nil {
+		select {
+		case c.msgCh <- msg.(*Message):
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case c.allCh <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *channel) sendTimeout(msg interface{}, timer *time.Timer) bool {
+	if c.msgCh != nil {
+		select {
+		case c.msgCh <- msg.(*Message):
+			return true
+		case <-timer.C:
+			return false
+		}
+	}
+	select {
+	case c.allCh <- msg:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// tryReceive removes the oldest message from the Go chan.
+func (c *channel) tryReceive() interface{} {
+	if c.msgCh != nil {
+		select {
+		case msg := <-c.msgCh:
+			return msg
+		default:
+			return nil
+		}
+	}
+	select {
+	case msg := <-c.allCh:
+		return msg
+	default:
+		return nil
+	}
+}
+
+func (c *channel) drop(msg interface{}) {
+	m, ok := msg.(*Message)
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&c.pubSub.stats.Dropped, 1)
+	if c.onDrop != nil {
+		c.onDrop(m)
+	}
+}
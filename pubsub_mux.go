@@ -0,0 +1,961 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal"
+	"github.com/redis/go-redis/v9/internal/pool"
+	"github.com/redis/go-redis/v9/internal/proto"
+)
+
+var errPubSubMuxRESP2 = errors.New("redis: MultiplexPubSub requires a server that supports RESP3")
+
+// pubSubMux multiplexes the PubSubs of a client on one RESP3 connection.
+// With RESP3 messages arrive as push frames, so the connection also runs
+// commands: push frames are dispatched to the PubSubs subscribed to their
+// channel and other replies to the waiting commands in order. While the
+// connection is open, it also runs the commands of the client that don't
+// block or change the state of the connection. It is closed when the last
+// subscription is removed.
+type pubSubMux struct {
+	client *baseClient
+
+	// wmu serializes the writes and the dials. It is locked before mu,
+	// and the listener doesn't lock it, so it can read while a write waits.
+	wmu sync.Mutex
+
+	mu        sync.Mutex
+	conn      *pubSubMuxConn
+	channels  map[string]map[*pubSubMuxSub]struct{}
+	patterns  map[string]map[*pubSubMuxSub]struct{}
+	schannels map[string]map[*pubSubMuxSub]struct{}
+	// callbacks are the lifecycle callbacks queued while wmu is held,
+	// called by unlockWrites.
+	callbacks []func()
+
+	// disconnectedAt is the time the last connection broke.
+	disconnectedAt time.Time
+	// unsupported is set when the server didn't agree to RESP3,
+	// so the PubSubs created since have their own connections.
+	unsupported bool
+}
+
+// pubSubMuxConn is a connection of a pubSubMux and the commands
+// waiting for its replies. The fields are guarded by mux.mu.
+type pubSubMuxConn struct {
+	cn *pool.Conn
+	// pending are the commands written to the connection in order,
+	// waiting for their replies.
+	pending []*pubSubMuxCall
+	// closing is set when the last subscription is removed. The listener
+	// closes the connection once the pending commands have their replies.
+	closing bool
+}
+
+// pubSubMuxCall is a command waiting for its reply. SUBSCRIBE and
+// UNSUBSCRIBE commands have no cmd: they wait for a confirmation push
+// per name, or an error reply. The calls that resubscribe a new
+// connection have no done channel, because nobody waits for them.
+type pubSubMuxCall struct {
+	cmd  Cmder
+	done chan error
+
+	kind     string
+	confirms int
+
+	// taken is set when the listener reads the reply and cancelled
+	// when the caller stops waiting before. Both are guarded by mux.mu.
+	taken     bool
+	cancelled bool
+}
+
+// pubSubMuxUnshared are the commands that block or change the state of the
+// connection, so they never run on the shared connection.
+var pubSubMuxUnshared = map[string]struct{}{
+	"auth":         {},
+	"hello":        {},
+	"select":       {},
+	"client":       {},
+	"reset":        {},
+	"quit":         {},
+	"readonly":     {},
+	"readwrite":    {},
+	"multi":        {},
+	"exec":         {},
+	"discard":      {},
+	"watch":        {},
+	"unwatch":      {},
+	"monitor":      {},
+	"sync":         {},
+	"psync":        {},
+	"subscribe":    {},
+	"psubscribe":   {},
+	"ssubscribe":   {},
+	"unsubscribe":  {},
+	"punsubscribe": {},
+	"sunsubscribe": {},
+	"blpop":        {},
+	"brpop":        {},
+	"brpoplpush":   {},
+	"blmove":       {},
+	"blmpop":       {},
+	"bzpopmin":     {},
+	"bzpopmax":     {},
+	"bzmpop":       {},
+	"xread":        {},
+	"xreadgroup":   {},
+	"wait":         {},
+	"waitaof":      {},
+}
+
+// pubSubMuxShared reports whether the command can run on the shared connection.
+func pubSubMuxShared(cmd Cmder) bool {
+	if cmd.readTimeout() != nil {
+		return false
+	}
+	_, ok := pubSubMuxUnshared[cmd.Name()]
+	return !ok
+}
+
+type pubSubMuxTimeoutError struct{}
+
+func (pubSubMuxTimeoutError) Error() string   { return "redis: multiplexed connection read timeout" }
+func (pubSubMuxTimeoutError) Timeout() bool   { return true }
+func (pubSubMuxTimeoutError) Temporary() bool { return true }
+
+func newPubSubMux(client *baseClient) *pubSubMux {
+	return &pubSubMux{
+		client:    client,
+		channels:  make(map[string]map[*pubSubMuxSub]struct{}),
+		patterns:  make(map[string]map[*pubSubMuxSub]struct{}),
+		schannels: make(map[string]map[*pubSubMuxSub]struct{}),
+	}
+}
+
+// pubSubMuxQueueSize is the number of messages queued for a PubSub.
+// The listener doesn't wait for a PubSub that doesn't receive its messages,
+// so the messages that don't fit are dropped.
+const pubSubMuxQueueSize = 1000
+
+// pubSubMuxSub backs a PubSub that receives its messages from a pubSubMux.
+type pubSubMuxSub struct {
+	mux    *pubSubMux
+	pubSub *PubSub
+
+	mu    sync.Mutex
+	queue []pubSubReply
+	// ready is signaled when a reply is queued.
+	ready chan struct{}
+}
+
+func (m *pubSubMux) pubSub() *PubSub {
+	pubsub := &PubSub{
+		opt: m.client.opt,
+	}
+	pubsub.init()
+
+	pubsub.muxed = &pubSubMuxSub{
+		mux:    m,
+		pubSub: pubsub,
+		ready:  make(chan struct{}, 1),
+	}
+	return pubsub
+}
+
+// isUnsupported reports whether the server didn't agree to RESP3.
+func (m *pubSubMux) isUnsupported() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.unsupported
+}
+
+// unlockWrites releases m.wmu and calls the callbacks queued while it was held.
+func (m *pubSubMux) unlockWrites() {
+	m.mu.Lock()
+	callbacks := m.callbacks
+	m.callbacks = nil
+	m.mu.Unlock()
+	m.wmu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// subs returns the subscribers by name for the kind of the command.
+func (m *pubSubMux) subs(redisCmd string) map[string]map[*pubSubMuxSub]struct{} {
+	switch redisCmd {
+	case "psubscribe", "punsubscribe", "pmessage":
+		return m.patterns
+	case "ssubscribe", "sunsubscribe", "smessage":
+		return m.schannels
+	default:
+		return m.channels
+	}
+}
+
+// subscribers returns every PubSub that has a subscription. m.mu must be held.
+func (m *pubSubMux) subscribers() []*pubSubMuxSub {
+	seen := make(map[*pubSubMuxSub]struct{})
+	var subs []*pubSubMuxSub
+	for _, byName := range []map[string]map[*pubSubMuxSub]struct{}{m.channels, m.patterns, m.schannels} {
+		for _, set := range byName {
+			for s := range set {
+				if _, ok := seen[s]; !ok {
+					seen[s] = struct{}{}
+					subs = append(subs, s)
+				}
+			}
+		}
+	}
+	return subs
+}
+
+// connWLocked returns the connection, dialing a new one and subscribing it
+// to all channels if needed. m.wmu must be held.
+func (m *pubSubMux) connWLocked(ctx context.Context) (*pubSubMuxConn, error) {
+	m.mu.Lock()
+	conn := m.conn
+	m.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	cn, err := m.client.newConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cn.Protocol != 3 {
+		// Under RESP2 messages can't be told apart from replies.
+		_ = m.client.connPool.CloseConn(cn)
+		m.mu.Lock()
+		m.unsupported = true
+		m.mu.Unlock()
+		return nil, errPubSubMuxRESP2
+	}
+
+	conn = &pubSubMuxConn{cn: cn}
+	if err := m.resubscribeWLocked(ctx, conn); err != nil {
+		_ = m.client.connPool.CloseConn(cn)
+		m.mu.Lock()
+		for _, s := range m.subscribers() {
+			hooks := s.pubSub.hooks
+			m.callbacks = append(m.callbacks, func() { hooks.resubscribeError(ctx, err) })
+		}
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.conn = conn
+	if !m.disconnectedAt.IsZero() {
+		downtime := time.Since(m.disconnectedAt)
+		m.disconnectedAt = time.Time{}
+		for _, s := range m.subscribers() {
+			hooks := s.pubSub.hooks
+			m.callbacks = append(m.callbacks, func() { hooks.reconnect(ctx, downtime) })
+		}
+	}
+	m.mu.Unlock()
+
+	go m.listen(conn)
+	return conn, nil
+}
+
+// resubscribeWLocked subscribes the new connection to all names before
+// the listener starts. m.wmu must be held.
+func (m *pubSubMux) resubscribeWLocked(ctx context.Context, conn *pubSubMuxConn) error {
+	for _, redisCmd := range []string{"subscribe", "psubscribe", "ssubscribe"} {
+		m.mu.Lock()
+		subs := m.subs(redisCmd)
+		names := make([]string, 0, len(subs))
+		for name := range subs {
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			call := subscribeCall(redisCmd, names)
+			call.done = nil
+			conn.pending = append(conn.pending, call)
+		}
+		m.mu.Unlock()
+
+		if len(names) == 0 {
+			continue
+		}
+		if err := m.write(conn.cn, subscribeCmd(ctx, redisCmd, names)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeCall waits for the confirmations of a SUBSCRIBE or UNSUBSCRIBE
+// command, which are consumed by the listener.
+func subscribeCall(redisCmd string, names []string) *pubSubMuxCall {
+	return &pubSubMuxCall{
+		done:     make(chan error, 1),
+		kind:     redisCmd,
+		confirms: len(names),
+	}
+}
+
+func subscribeCmd(ctx context.Context, redisCmd string, names []string) Cmder {
+	args := make([]interface{}, 0, 1+len(names))
+	args = append(args, redisCmd)
+	for _, name := range names {
+		args = append(args, name)
+	}
+	return NewSliceCmd(ctx, args...)
+}
+
+// sendWLocked adds the call to the pending commands and writes the command,
+// dialing the connection if needed. m.wmu must be held.
+func (m *pubSubMux) sendWLocked(ctx context.Context, call *pubSubMuxCall, cmd Cmder) (*pubSubMuxConn, error) {
+	for {
+		conn, err := m.connWLocked(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
+		if m.conn != conn {
+			// Broken since, so dial again.
+			m.mu.Unlock()
+			continue
+		}
+		conn.pending = append(conn.pending, call)
+		m.mu.Unlock()
+
+		return conn, m.write(conn.cn, cmd)
+	}
+}
+
+// write writes the commands. On error the connection is closed and
+// the listener fails the pending commands.
+func (m *pubSubMux) write(cn *pool.Conn, cmds ...Cmder) error {
+	err := cn.WithWriter(context.Background(), m.client.opt.WriteTimeout, func(wr *proto.Writer) error {
+		return writeCmds(wr, cmds)
+	})
+	if err != nil {
+		_ = cn.Close()
+	}
+	return err
+}
+
+// wait waits for the reply of the call. When no reply is read in the timeout,
+// the connection is closed like a pooled connection that timed out.
+func (m *pubSubMux) wait(ctx context.Context, cn *pool.Conn, call *pubSubMuxCall, timeout time.Duration) error {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	var err error
+	select {
+	case err := <-call.done:
+		return err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer:
+		err = pubSubMuxTimeoutError{}
+		_ = cn.Close()
+	}
+
+	m.mu.Lock()
+	taken := call.taken
+	if !taken {
+		call.cancelled = true
+	}
+	m.mu.Unlock()
+
+	if taken {
+		// The listener is reading the reply into the command.
+		return <-call.done
+	}
+	return err
+}
+
+// process runs the command on the shared connection while it is open,
+// and on the pool of the client otherwise. The commands that fail with
+// an error that can be retried are retried on the pool.
+func (m *pubSubMux) process(ctx context.Context, client *baseClient, cmd Cmder) error {
+	if ok, err := m.processCmds(ctx, client, []Cmder{cmd}); ok {
+		if err == nil || client.opt.MaxRetries == 0 || !shouldRetry(err, true) {
+			return err
+		}
+	}
+	return client.process(ctx, cmd)
+}
+
+// processPipeline runs the pipeline like process.
+func (m *pubSubMux) processPipeline(ctx context.Context, client *baseClient, cmds []Cmder) error {
+	if ok, err := m.processCmds(ctx, client, cmds); ok {
+		if err == nil || client.opt.MaxRetries == 0 || !shouldRetry(err, true) {
+			return err
+		}
+	}
+	return client.processPipeline(ctx, cmds)
+}
+
+// processCmds runs the commands on the shared connection and returns the
+// first error. It reports false when the connection is not open or one of
+// the commands can't share it, so the commands must run on the pool.
+func (m *pubSubMux) processCmds(ctx context.Context, client *baseClient, cmds []Cmder) (bool, error) {
+	for _, cmd := range cmds {
+		if !pubSubMuxShared(cmd) {
+			return false, nil
+		}
+	}
+
+	m.wmu.Lock()
+	m.mu.Lock()
+	conn := m.conn
+	if conn == nil {
+		m.mu.Unlock()
+		m.wmu.Unlock()
+		return false, nil
+	}
+	calls := make([]*pubSubMuxCall, len(cmds))
+	for i, cmd := range cmds {
+		calls[i] = &pubSubMuxCall{
+			cmd:  cmd,
+			done: make(chan error, 1),
+		}
+	}
+	conn.pending = append(conn.pending, calls...)
+	m.mu.Unlock()
+
+	// A write error is also reported to the calls by the listener.
+	_ = m.write(conn.cn, cmds...)
+	m.unlockWrites()
+
+	for i, call := range calls {
+		cmds[i].SetErr(m.wait(ctx, conn.cn, call, client.opt.ReadTimeout))
+	}
+	return true, cmdsFirstErr(cmds)
+}
+
+// subscribe adds the subscriber to the names and subscribes the connection
+// to the names that had no subscribers. When the server rejects them,
+// the subscriber is removed from them again.
+func (m *pubSubMux) subscribe(ctx context.Context, s *pubSubMuxSub, redisCmd string, names []string) error {
+	m.wmu.Lock()
+	// Dial first, so the new names are subscribed by their own command.
+	if _, err := m.connWLocked(ctx); err != nil {
+		m.unlockWrites()
+		return err
+	}
+
+	m.mu.Lock()
+	subs := m.subs(redisCmd)
+	var added []string
+	for _, name := range names {
+		set, ok := subs[name]
+		if !ok {
+			set = make(map[*pubSubMuxSub]struct{})
+			subs[name] = set
+			added = append(added, name)
+		}
+		set[s] = struct{}{}
+	}
+	m.mu.Unlock()
+
+	if len(added) == 0 {
+		m.unlockWrites()
+		return nil
+	}
+	call := subscribeCall(redisCmd, added)
+	conn, err := m.sendWLocked(ctx, call, subscribeCmd(ctx, redisCmd, added))
+	m.unlockWrites()
+
+	if err == nil {
+		err = m.wait(ctx, conn.cn, call, m.client.opt.ReadTimeout)
+	}
+	if isRedisError(err) {
+		m.mu.Lock()
+		for _, name := range added {
+			if set, ok := subs[name]; ok {
+				delete(set, s)
+				if len(set) == 0 {
+					delete(subs, name)
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// unsubscribe removes the subscriber from the names and unsubscribes the
+// connection from the names that have no subscribers left. It returns the
+// call that waits for the confirmations, if any. Without subscriptions
+// left, the connection is closed.
+func (m *pubSubMux) unsubscribe(
+	ctx context.Context, s *pubSubMuxSub, redisCmd string, names []string,
+) (*pubSubMuxCall, *pubSubMuxConn, error) {
+	m.wmu.Lock()
+	defer m.unlockWrites()
+
+	m.mu.Lock()
+	subs := m.subs(redisCmd)
+	var removed []string
+	for _, name := range names {
+		set, ok := subs[name]
+		if !ok {
+			continue
+		}
+		delete(set, s)
+		if len(set) == 0 {
+			delete(subs, name)
+			removed = append(removed, name)
+		}
+	}
+	conn := m.conn
+	if conn == nil || len(removed) == 0 {
+		m.mu.Unlock()
+		return nil, nil, nil
+	}
+	call := subscribeCall(redisCmd, removed)
+	conn.pending = append(conn.pending, call)
+	m.mu.Unlock()
+
+	err := m.write(conn.cn, subscribeCmd(ctx, redisCmd, removed))
+
+	m.mu.Lock()
+	if len(m.subscribers()) == 0 {
+		m.detach(conn)
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return call, conn, nil
+}
+
+// detach stops using the connection for new commands. It is closed by the
+// listener once the pending commands have their replies. m.mu must be held.
+func (m *pubSubMux) detach(conn *pubSubMuxConn) {
+	if m.conn != conn {
+		return
+	}
+	m.conn = nil
+	conn.closing = true
+	if len(conn.pending) == 0 {
+		// Wakes up the listener.
+		_ = conn.cn.Close()
+	}
+}
+
+// remove removes the subscriber from all names without waiting for
+// the confirmations.
+func (m *pubSubMux) remove(ctx context.Context, s *pubSubMuxSub) error {
+	var firstErr error
+	for _, redisCmd := range []string{"unsubscribe", "punsubscribe", "sunsubscribe"} {
+		m.mu.Lock()
+		var names []string
+		for name, set := range m.subs(redisCmd) {
+			if _, ok := set[s]; ok {
+				names = append(names, name)
+			}
+		}
+		m.mu.Unlock()
+
+		if _, _, err := m.unsubscribe(ctx, s, redisCmd, names); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// reset closes the connection so the listener replaces it.
+func (m *pubSubMux) reset() {
+	m.mu.Lock()
+	if m.conn != nil {
+		_ = m.conn.cn.Close()
+	}
+	m.mu.Unlock()
+}
+
+// listen reads the replies of the connection until it breaks or is closed.
+func (m *pubSubMux) listen(conn *pubSubMuxConn) {
+	ctx := context.Background()
+	for {
+		var push interface{}
+		err := conn.cn.WithReader(ctx, 0, func(rd *proto.Reader) error {
+			typ, err := rd.PeekReplyType()
+			if err != nil {
+				return err
+			}
+			if typ == proto.RespPush {
+				push, err = rd.ReadReply()
+				return err
+			}
+
+			call := m.nextCall(conn)
+			if call == nil || call.cmd == nil || call.cancelled {
+				// The error reply of SUBSCRIBE or the reply of a command
+				// nobody waits for anymore.
+				_, err := rd.ReadReply()
+				if isRedisError(err) {
+					if call != nil && call.done != nil {
+						call.done <- err
+					} else if call != nil {
+						internal.Logger.Printf(ctx, "redis: multiplexed PubSub %s: %s", call.kind, err)
+					}
+					return nil
+				}
+				return err
+			}
+
+			err = call.cmd.readReply(rd)
+			call.done <- err
+			if isRedisError(err) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			m.broken(ctx, conn, err)
+			return
+		}
+		if push != nil {
+			m.dispatch(conn, push)
+		}
+
+		m.mu.Lock()
+		drained := conn.closing && len(conn.pending) == 0
+		m.mu.Unlock()
+		if drained {
+			_ = m.client.connPool.CloseConn(conn.cn)
+			return
+		}
+	}
+}
+
+// nextCall removes the call at the head of the pending commands, which
+// the next reply that is not a push belongs to.
+func (m *pubSubMux) nextCall(conn *pubSubMuxConn) *pubSubMuxCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(conn.pending) == 0 {
+		return nil
+	}
+	call := conn.pending[0]
+	conn.pending[0] = nil
+	conn.pending = conn.pending[1:]
+	call.taken = true
+	return call
+}
+
+// confirm counts a subscription confirmation push for the SUBSCRIBE or
+// UNSUBSCRIBE command at the head of the pending commands.
+func (m *pubSubMux) confirm(conn *pubSubMuxConn, kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(conn.pending) == 0 {
+		return
+	}
+	call := conn.pending[0]
+	if call.cmd != nil || call.kind != kind {
+		return
+	}
+	call.confirms--
+	if call.confirms <= 0 {
+		conn.pending[0] = nil
+		conn.pending = conn.pending[1:]
+		if call.done != nil {
+			call.done <- nil
+		}
+	}
+}
+
+// dispatch delivers a message push to the subscribers of its channel
+// or pattern. Subscription confirmations are created by each PubSub,
+// so they are only counted.
+func (m *pubSubMux) dispatch(conn *pubSubMuxConn, push interface{}) {
+	reply, ok := push.([]interface{})
+	if !ok || len(reply) < 2 {
+		return
+	}
+	kind, _ := reply[0].(string)
+	switch kind {
+	case "message", "pmessage", "smessage":
+	case "subscribe", "psubscribe", "ssubscribe", "unsubscribe", "punsubscribe", "sunsubscribe":
+		m.confirm(conn, kind)
+		return
+	default:
+		return
+	}
+	name, _ := reply[1].(string)
+
+	m.mu.Lock()
+	set := m.subs(kind)[name]
+	subs := make([]*pubSubMuxSub, 0, len(set))
+	for s := range set {
+		subs = append(subs, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range subs {
+		msg, err := s.pubSub.newMessage(reply)
+		s.deliver(pubSubReply{msg: msg, err: err}, true)
+	}
+}
+
+// broken fails the pending commands of the connection after a network
+// error and replaces it, unless it was closed because it isn't used anymore.
+func (m *pubSubMux) broken(ctx context.Context, conn *pubSubMuxConn, reason error) {
+	_ = m.client.connPool.CloseConn(conn.cn)
+
+	m.mu.Lock()
+	pending := conn.pending
+	conn.pending = nil
+	current := m.conn == conn
+	var subs []*pubSubMuxSub
+	if current {
+		internal.Logger.Printf(ctx, "redis: discarding bad PubSub connection: %s", reason)
+		m.conn = nil
+		subs = m.subscribers()
+		m.disconnectedAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	for _, call := range pending {
+		if call.done != nil {
+			call.done <- reason
+		}
+	}
+	if !current {
+		return
+	}
+	for _, s := range subs {
+		s.pubSub.hooks.disconnect(ctx, reason)
+		s.deliver(pubSubReply{err: reason}, false)
+	}
+
+	for attempt := 0; ; attempt++ {
+		m.wmu.Lock()
+		m.mu.Lock()
+		done := m.conn != nil || len(m.subscribers()) == 0
+		m.mu.Unlock()
+		if done {
+			// Reconnected by a command or nothing to listen to.
+			m.wmu.Unlock()
+			return
+		}
+		_, err := m.connWLocked(ctx)
+		m.unlockWrites()
+		if err == nil || err == pool.ErrClosed {
+			return
+		}
+		if err == errPubSubMuxRESP2 {
+			for _, s := range subs {
+				s.deliver(pubSubReply{err: err}, false)
+			}
+			return
+		}
+		time.Sleep(internal.RetryBackoff(attempt, m.client.opt.MinRetryBackoff, m.client.opt.MaxRetryBackoff))
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// names returns the subscriptions of the PubSub for the kind of the command.
+// s.pubSub.mu must be held.
+func (s *pubSubMuxSub) names(redisCmd string) map[string]struct{} {
+	c := s.pubSub
+	switch redisCmd {
+	case "psubscribe", "punsubscribe":
+		if c.patterns == nil {
+			c.patterns = make(map[string]struct{})
+		}
+		return c.patterns
+	case "ssubscribe", "sunsubscribe":
+		if c.schannels == nil {
+			c.schannels = make(map[string]struct{})
+		}
+		return c.schannels
+	default:
+		if c.channels == nil {
+			c.channels = make(map[string]struct{})
+		}
+		return c.channels
+	}
+}
+
+// count returns the number of subscriptions reported by the server for
+// the kind of the command. s.pubSub.mu must be held.
+func (s *pubSubMuxSub) count(redisCmd string) int {
+	c := s.pubSub
+	switch redisCmd {
+	case "ssubscribe", "sunsubscribe":
+		return len(c.schannels)
+	default:
+		return len(c.channels) + len(c.patterns)
+	}
+}
+
+func (s *pubSubMuxSub) subscribe(ctx context.Context, redisCmd string, names ...string) error {
+	c := s.pubSub
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return pool.ErrClosed
+	}
+	set := s.names(redisCmd)
+	count := s.count(redisCmd)
+	confirms := make([]*Subscription, 0, len(names))
+	var added []string
+	for _, name := range names {
+		if _, ok := set[name]; !ok {
+			set[name] = struct{}{}
+			added = append(added, name)
+			count++
+		}
+		confirms = append(confirms, &Subscription{
+			Kind:    redisCmd,
+			Channel: name,
+			Count:   count,
+		})
+	}
+	c.mu.Unlock()
+
+	err := s.mux.subscribe(ctx, s, redisCmd, names)
+	if isRedisError(err) {
+		// Rejected by the server, so not resubscribed on reconnect.
+		c.mu.Lock()
+		for _, name := range added {
+			delete(set, name)
+		}
+		c.mu.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	for _, sub := range confirms {
+		s.deliver(pubSubReply{msg: sub}, false)
+	}
+	return nil
+}
+
+func (s *pubSubMuxSub) unsubscribe(ctx context.Context, redisCmd string, names ...string) error {
+	c := s.pubSub
+
+	c.mu.Lock()
+	set := s.names(redisCmd)
+	if len(names) == 0 {
+		names = mapKeys(set)
+	}
+	count := s.count(redisCmd)
+	confirms := make([]*Subscription, 0, len(names))
+	for _, name := range names {
+		if _, ok := set[name]; ok {
+			delete(set, name)
+			count--
+		}
+		confirms = append(confirms, &Subscription{
+			Kind:    redisCmd,
+			Channel: name,
+			Count:   count,
+		})
+	}
+	c.mu.Unlock()
+
+	call, conn, err := s.mux.unsubscribe(ctx, s, redisCmd, names)
+	if err == nil && call != nil {
+		err = s.mux.wait(ctx, conn.cn, call, s.mux.client.opt.ReadTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	for _, sub := range confirms {
+		s.deliver(pubSubReply{msg: sub}, false)
+	}
+	return nil
+}
+
+// ping runs PING on the shared connection, or on the pool without
+// subscriptions, and delivers the Pong like a dedicated connection does.
+func (s *pubSubMuxSub) ping(ctx context.Context, payload ...string) error {
+	args := []interface{}{"ping"}
+	if len(payload) == 1 {
+		args = append(args, payload[0])
+	}
+	cmd := NewStringCmd(ctx, args...)
+	if err := s.mux.process(ctx, s.mux.client, cmd); err != nil {
+		return err
+	}
+
+	pong := &Pong{}
+	if len(payload) == 1 {
+		pong.Payload = cmd.Val()
+	}
+	s.deliver(pubSubReply{msg: pong}, false)
+	return nil
+}
+
+// deliver queues the reply. The listener doesn't wait for a slow PubSub,
+// which would delay the others, so a message is dropped and counted in
+// PubSubStats.Dropped when pubSubMuxQueueSize replies are queued.
+// Confirmations, pongs and errors are always queued.
+func (s *pubSubMuxSub) deliver(reply pubSubReply, msg bool) {
+	s.mu.Lock()
+	if msg && len(s.queue) >= pubSubMuxQueueSize {
+		s.mu.Unlock()
+		atomic.AddUint64(&s.pubSub.stats.Dropped, 1)
+		return
+	}
+	s.queue = append(s.queue, reply)
+	s.mu.Unlock()
+	notifyPubSubMux(s.ready)
+}
+
+func (s *pubSubMuxSub) receive(ctx context.Context, timeout time.Duration) (interface{}, error) {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			reply := s.queue[0]
+			s.queue[0] = pubSubReply{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return reply.msg, reply.err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-s.pubSub.exit:
+			return nil, pool.ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer:
+			return nil, pubSubTimeoutError{}
+		}
+	}
+}
+
+// notifyPubSubMux wakes up the goroutine waiting on the channel,
+// which has a buffer of 1.
+func notifyPubSubMux(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,302 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPubSubRouterQueueFull is reported to PubSubRouterOptions.OnError for
+// the messages dropped because the queue of their channel is full.
+var ErrPubSubRouterQueueFull = errors.New("redis: PubSubRouter queue is full")
+
+// PubSubHandler handles a message received by a PubSubRouter.
+type PubSubHandler func(ctx context.Context, msg *Message) error
+
+// PubSubRouterOptions are used to configure a PubSubRouter.
+type PubSubRouterOptions struct {
+	// Concurrency is the number of goroutines that handle the messages of
+	// a channel. Each channel has its own goroutines, which are started
+	// when messages arrive and exit when the channel is idle.
+	// Default is 1, which handles the messages of a channel in order.
+	Concurrency int
+
+	// QueueSize is the number of messages of a channel that wait for
+	// its goroutines. When the queue is full, the messages of the channel
+	// are dropped and reported to OnError with ErrPubSubRouterQueueFull,
+	// so a slow channel doesn't delay the others.
+	// Default is 100.
+	QueueSize int
+
+	// ChannelOptions are passed to PubSub.Channel.
+	ChannelOptions []ChannelOption
+
+	// OnError is called when a handler returns an error or panics.
+	OnError func(ctx context.Context, msg *Message, err error)
+	// OnHandled is called after each handler with the time it took.
+	OnHandled func(ctx context.Context, msg *Message, latency time.Duration, err error)
+}
+
+func (opt *PubSubRouterOptions) init() {
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = 1
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = 100
+	}
+}
+
+// PubSubRouter dispatches the messages of a PubSub to the handlers
+// registered by channel or by pattern. It subscribes to a channel or
+// pattern when the first handler is added and unsubscribes when the last
+// handler is removed. Panics of the handlers are recovered.
+type PubSubRouter struct {
+	pubsub *PubSub
+	opt    *PubSubRouterOptions
+
+	mu       sync.Mutex
+	channels map[string][]*PubSubRoute
+	patterns map[string][]*PubSubRoute
+}
+
+// PubSubRoute is a handler registered in a PubSubRouter.
+type PubSubRoute struct {
+	router  *PubSubRouter
+	name    string
+	pattern bool
+	handler PubSubHandler
+}
+
+// NewPubSubRouter returns a router for the messages of the PubSub.
+// The PubSub must not be used to receive messages directly.
+func NewPubSubRouter(pubsub *PubSub, opt *PubSubRouterOptions) *PubSubRouter {
+	if opt == nil {
+		opt = &PubSubRouterOptions{}
+	}
+	opt.init()
+
+	return &PubSubRouter{
+		pubsub:   pubsub,
+		opt:      opt,
+		channels: make(map[string][]*PubSubRoute),
+		patterns: make(map[string][]*PubSubRoute),
+	}
+}
+
+// Handle registers the handler for the messages of the channel and
+// subscribes to the channel if needed.
+func (r *PubSubRouter) Handle(ctx context.Context, channel string, handler PubSubHandler) (*PubSubRoute, error) {
+	return r.add(ctx, channel, false, handler)
+}
+
+// HandlePattern registers the handler for the messages of the channels
+// that match the glob pattern and subscribes to the pattern if needed.
+func (r *PubSubRouter) HandlePattern(ctx context.Context, pattern string, handler PubSubHandler) (*PubSubRoute, error) {
+	return r.add(ctx, pattern, true, handler)
+}
+
+func (r *PubSubRouter) add(ctx context.Context, name string, pattern bool, handler PubSubHandler) (*PubSubRoute, error) {
+	route := &PubSubRoute{
+		router:  r,
+		name:    name,
+		pattern: pattern,
+		handler: handler,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := r.routes(pattern)
+	if len(routes[name]) == 0 {
+		var err error
+		if pattern {
+			err = r.pubsub.PSubscribe(ctx, name)
+		} else {
+			err = r.pubsub.Subscribe(ctx, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	routes[name] = append(routes[name], route)
+
+	return route, nil
+}
+
+// Remove removes the handler from the router and unsubscribes from
+// the channel or pattern if it was the last handler.
+func (route *PubSubRoute) Remove(ctx context.Context) error {
+	r := route.router
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := r.routes(route.pattern)
+	list := routes[route.name]
+	for i, other := range list {
+		if other == route {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) > 0 {
+		routes[route.name] = list
+		return nil
+	}
+
+	delete(routes, route.name)
+	if route.pattern {
+		return r.pubsub.PUnsubscribe(ctx, route.name)
+	}
+	return r.pubsub.Unsubscribe(ctx, route.name)
+}
+
+func (r *PubSubRouter) routes(pattern bool) map[string][]*PubSubRoute {
+	if pattern {
+		return r.patterns
+	}
+	return r.channels
+}
+
+// handlers returns the handlers of the message.
+func (r *PubSubRouter) handlers(msg *Message) []*PubSubRoute {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if msg.Pattern != "" {
+		return r.patterns[msg.Pattern]
+	}
+	return r.channels[msg.Channel]
+}
+
+type pubSubDelivery struct {
+	msg    *Message
+	routes []*PubSubRoute
+}
+
+// pubSubRouterQueue holds the messages of a channel that wait for
+// its goroutines.
+type pubSubRouterQueue struct {
+	deliveries chan pubSubDelivery
+	workers    int
+}
+
+// pubSubRouterRun is the state of a PubSubRouter.Run call.
+type pubSubRouterRun struct {
+	router *PubSubRouter
+	ctx    context.Context
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string]*pubSubRouterQueue
+}
+
+// Run receives the messages and calls the handlers until the context
+// is done or the PubSub is closed. It waits for the running handlers
+// before returning.
+func (r *PubSubRouter) Run(ctx context.Context) error {
+	ch := r.pubsub.Channel(r.opt.ChannelOptions...)
+
+	run := &pubSubRouterRun{
+		router: r,
+		ctx:    ctx,
+		queues: make(map[string]*pubSubRouterQueue),
+	}
+	defer run.wg.Wait()
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			routes := r.handlers(msg)
+			if len(routes) == 0 {
+				continue
+			}
+			run.dispatch(pubSubDelivery{msg: msg, routes: routes})
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// dispatch queues the message for the goroutines of its channel and starts
+// one if fewer than Concurrency are running. It never blocks.
+func (run *pubSubRouterRun) dispatch(d pubSubDelivery) {
+	opt := run.router.opt
+
+	run.mu.Lock()
+	queue := run.queues[d.msg.Channel]
+	if queue == nil {
+		queue = &pubSubRouterQueue{
+			deliveries: make(chan pubSubDelivery, opt.QueueSize),
+		}
+		run.queues[d.msg.Channel] = queue
+	}
+
+	select {
+	case queue.deliveries <- d:
+	default:
+		run.mu.Unlock()
+		if opt.OnError != nil {
+			opt.OnError(run.ctx, d.msg, ErrPubSubRouterQueueFull)
+		}
+		return
+	}
+
+	if queue.workers < opt.Concurrency {
+		queue.workers++
+		run.wg.Add(1)
+		go run.work(d.msg.Channel, queue)
+	}
+	run.mu.Unlock()
+}
+
+// work handles the messages of the channel until its queue is empty.
+func (run *pubSubRouterRun) work(channel string, queue *pubSubRouterQueue) {
+	defer run.wg.Done()
+
+	for {
+		run.mu.Lock()
+		select {
+		case d := <-queue.deliveries:
+			run.mu.Unlock()
+			for _, route := range d.routes {
+				run.router.handle(run.ctx, route, d.msg)
+			}
+		default:
+			queue.workers--
+			if queue.workers == 0 {
+				delete(run.queues, channel)
+			}
+			run.mu.Unlock()
+			return
+		}
+	}
+}
+
+// handle calls the handler of the route and reports the result.
+func (r *PubSubRouter) handle(ctx context.Context, route *PubSubRoute, msg *Message) {
+	start := time.Now()
+	err := route.call(ctx, msg)
+
+	if err != nil && r.opt.OnError != nil {
+		r.opt.OnError(ctx, msg, err)
+	}
+	if r.opt.OnHandled != nil {
+		r.opt.OnHandled(ctx, msg, time.Since(start), err)
+	}
+}
+
+func (route *PubSubRoute) call(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("redis: pubsub handler for %s panicked: %v", msg.Channel, v)
+		}
+	}()
+	return route.handler(ctx, msg)
+}
@@ -1,9 +1,14 @@
 package redis_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/bsm/ginkgo/v2"
@@ -445,6 +450,28 @@ var _ = Describe("PubSub", func() {
 		expectReceiveMessageOnError(pubsub)
 	})
 
+	It("calls lifecycle callbacks on reconnect", func() {
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		_, err := pubsub.ReceiveTimeout(ctx, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+
+		var reason error
+		var reconnects int
+		pubsub.OnDisconnect(func(ctx context.Context, err error) {
+			reason = err
+		})
+		pubsub.OnReconnect(func(ctx context.Context, downtime time.Duration) {
+			Expect(downtime).To(BeNumerically(">=", 0))
+			reconnects++
+		})
+
+		expectReceiveMessageOnError(pubsub)
+		Expect(reason).To(Equal(io.EOF))
+		Expect(reconnects).To(Equal(1))
+	})
+
 	It("should return on Close", func() {
 		pubsub := client.Subscribe(ctx, "mychannel")
 		defer pubsub.Close()
@@ -567,4 +594,322 @@ var _ = Describe("PubSub", func() {
 		Expect(msg.Channel).To(Equal("mychannel"))
 		Expect(msg.Payload).To(Equal(text))
 	})
+
+	It("multiplexes PubSubs on one connection", func() {
+		opt := redisOptions()
+		opt.MultiplexPubSub = true
+		muxClient := redis.NewClient(opt)
+		defer muxClient.Close()
+
+		pubsubs := make([]*redis.PubSub, 3)
+		for i := range pubsubs {
+			pubsubs[i] = muxClient.Subscribe(ctx, "mychannel")
+			defer pubsubs[i].Close()
+
+			msgi, err := pubsubs[i].ReceiveTimeout(ctx, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgi).To(Equal(&redis.Subscription{
+				Kind:    "subscribe",
+				Channel: "mychannel",
+				Count:   1,
+			}))
+		}
+
+		channels, err := client.PubSubNumSub(ctx, "mychannel").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(channels).To(Equal(map[string]int64{"mychannel": 1}))
+
+		Expect(pubsubs[0].Ping(ctx, "hi")).NotTo(HaveOccurred())
+		msgi, err := pubsubs[0].ReceiveTimeout(ctx, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msgi).To(Equal(&redis.Pong{Payload: "hi"}))
+
+		// The commands of the client share the connection.
+		Expect(muxClient.Set(ctx, "key", "value", 0).Err()).NotTo(HaveOccurred())
+		Expect(muxClient.Get(ctx, "key").Val()).To(Equal("value"))
+		cmds, err := muxClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, "counter")
+			pipe.Incr(ctx, "counter")
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmds[1].(*redis.IntCmd).Val()).To(Equal(int64(2)))
+		Expect(muxClient.PoolStats().TotalConns).To(Equal(uint32(1)))
+
+		Expect(client.Publish(ctx, "mychannel", "hello").Err()).NotTo(HaveOccurred())
+		for _, pubsub := range pubsubs {
+			msg, err := pubsub.ReceiveMessage(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Payload).To(Equal("hello"))
+		}
+
+		many := make([]string, 150)
+		for i := range many {
+			many[i] = fmt.Sprintf("channel%d", i)
+		}
+		pubsub := muxClient.Subscribe(ctx, many...)
+		defer pubsub.Close()
+		for i, channel := range many {
+			msgi, err := pubsub.ReceiveTimeout(ctx, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgi).To(Equal(&redis.Subscription{
+				Kind:    "subscribe",
+				Channel: channel,
+				Count:   i + 1,
+			}))
+		}
+
+		// The connection is closed with the last subscription.
+		Expect(pubsub.Close()).NotTo(HaveOccurred())
+		for _, pubsub := range pubsubs {
+			Expect(pubsub.Close()).NotTo(HaveOccurred())
+		}
+		Eventually(func() uint32 {
+			return muxClient.PoolStats().TotalConns
+		}).Should(BeZero())
+	})
+
+	It("counts received, delivered and dropped messages", func() {
+		pubsub := client.Subscribe(ctx, "mychannel")
+		defer pubsub.Close()
+
+		var dropped int64
+		ch := pubsub.Channel(
+			redis.WithChannelSize(1),
+			redis.WithChannelOverflow(redis.ChannelOverflowDropNewest),
+			redis.WithChannelOnDrop(func(msg *redis.Message) {
+				atomic.AddInt64(&dropped, 1)
+			}),
+		)
+
+		for i := 0; i < 3; i++ {
+			Expect(client.Publish(ctx, "mychannel", "hello").Err()).NotTo(HaveOccurred())
+		}
+
+		Eventually(func() uint64 {
+			return pubsub.Stats().Received
+		}).Should(Equal(uint64(3)))
+		Expect(ch).To(HaveLen(1))
+
+		stats := pubsub.Stats()
+		Expect(stats.Delivered).To(Equal(uint64(1)))
+		Expect(stats.Dropped).To(Equal(uint64(2)))
+		Expect(atomic.LoadInt64(&dropped)).To(Equal(int64(2)))
+	})
+
+	Describe("PubSubRouter", func() {
+		It("routes messages by channel and pattern", func() {
+			pubsub := client.Subscribe(ctx)
+			defer pubsub.Close()
+
+			router := redis.NewPubSubRouter(pubsub, nil)
+			channelMsgs := make(chan *redis.Message, 10)
+			patternMsgs := make(chan *redis.Message, 10)
+
+			_, err := router.Handle(ctx, "orders", func(ctx context.Context, msg *redis.Message) error {
+				channelMsgs <- msg
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			patternRoute, err := router.HandlePattern(ctx, "user.*", func(ctx context.Context, msg *redis.Message) error {
+				patternMsgs <- msg
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			runCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error, 1)
+			go func() {
+				done <- router.Run(runCtx)
+			}()
+
+			Expect(client.Publish(ctx, "orders", "order1").Err()).NotTo(HaveOccurred())
+			Expect(client.Publish(ctx, "user.created", "user1").Err()).NotTo(HaveOccurred())
+
+			var msg *redis.Message
+			Eventually(channelMsgs).Should(Receive(&msg))
+			Expect(msg.Payload).To(Equal("order1"))
+			Eventually(patternMsgs).Should(Receive(&msg))
+			Expect(msg.Channel).To(Equal("user.created"))
+			Expect(msg.Payload).To(Equal("user1"))
+
+			Expect(patternRoute.Remove(ctx)).NotTo(HaveOccurred())
+			Eventually(func() int64 {
+				return client.PubSubNumPat(ctx).Val()
+			}).Should(Equal(int64(0)))
+
+			cancel()
+			Eventually(done).Should(Receive(Equal(context.Canceled)))
+		})
+
+		It("reports handler errors, panics and latency", func() {
+			pubsub := client.Subscribe(ctx)
+			defer pubsub.Close()
+
+			var mu sync.Mutex
+			var errs []error
+			var latencies []time.Duration
+			router := redis.NewPubSubRouter(pubsub, &redis.PubSubRouterOptions{
+				Concurrency: 2,
+				OnError: func(ctx context.Context, msg *redis.Message, err error) {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				},
+				OnHandled: func(ctx context.Context, msg *redis.Message, latency time.Duration, err error) {
+					mu.Lock()
+					latencies = append(latencies, latency)
+					mu.Unlock()
+				},
+			})
+
+			_, err := router.Handle(ctx, "jobs", func(ctx context.Context, msg *redis.Message) error {
+				switch msg.Payload {
+				case "fail":
+					return errors.New("job failed")
+				case "panic":
+					panic("job panicked")
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				_ = router.Run(runCtx)
+			}()
+
+			for _, payload := range []string{"ok", "fail", "panic"} {
+				Expect(client.Publish(ctx, "jobs", payload).Err()).NotTo(HaveOccurred())
+			}
+
+			Eventually(func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(latencies)
+			}).Should(Equal(3))
+
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(errs).To(HaveLen(2))
+			for _, latency := range latencies {
+				Expect(latency).To(BeNumerically(">", 0))
+			}
+		})
+
+		It("handles many channels in order", func() {
+			pubsub := client.Subscribe(ctx)
+			defer pubsub.Close()
+
+			router := redis.NewPubSubRouter(pubsub, nil)
+
+			var mu sync.Mutex
+			payloads := make(map[string][]string)
+			var channels []string
+			for i := 0; i < 50; i++ {
+				channel := fmt.Sprintf("channel%d", i)
+				channels = append(channels, channel)
+				_, err := router.Handle(ctx, channel, func(ctx context.Context, msg *redis.Message) error {
+					mu.Lock()
+					payloads[msg.Channel] = append(payloads[msg.Channel], msg.Payload)
+					mu.Unlock()
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				_ = router.Run(runCtx)
+			}()
+
+			for _, channel := range channels {
+				for i := 0; i < 3; i++ {
+					Expect(client.Publish(ctx, channel, strconv.Itoa(i)).Err()).NotTo(HaveOccurred())
+				}
+			}
+
+			Eventually(func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				var n int
+				for _, list := range payloads {
+					n += len(list)
+				}
+				return n
+			}).Should(Equal(150))
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, channel := range channels {
+				Expect(payloads[channel]).To(Equal([]string{"0", "1", "2"}))
+			}
+		})
+	})
+
+	Describe("SubscribeKeyspace", func() {
+		AfterEach(func() {
+			Expect(client.ConfigSet(ctx, "notify-keyspace-events", "").Err()).NotTo(HaveOccurred())
+		})
+
+		It("fails when keyspace notifications are disabled", func() {
+			Expect(client.ConfigSet(ctx, "notify-keyspace-events", "").Err()).NotTo(HaveOccurred())
+
+			_, err := client.SubscribeKeyspace(ctx, nil)
+			Expect(err).To(MatchError(ContainSubstring("keyspace notifications are disabled")))
+		})
+
+		It("enables and delivers keyspace notifications", func() {
+			sub, err := client.SubscribeKeyspace(ctx, &redis.KeyspaceOptions{
+				Keys:        "user:*",
+				NotifyFlags: "KA",
+				Types:       []redis.KeyspaceEventType{redis.KeyspaceEventHSet, redis.KeyspaceEventDel},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer sub.Close()
+
+			flags := client.ConfigGet(ctx, "notify-keyspace-events").Val()["notify-keyspace-events"]
+			Expect(flags).To(ContainSubstring("K"))
+
+			ch := sub.Channel()
+
+			Expect(client.HSet(ctx, "user:1", "name", "alice").Err()).NotTo(HaveOccurred())
+			Expect(client.Expire(ctx, "user:1", time.Hour).Err()).NotTo(HaveOccurred())
+			Expect(client.Set(ctx, "order:1", "value", 0).Err()).NotTo(HaveOccurred())
+			Expect(client.Del(ctx, "user:1").Err()).NotTo(HaveOccurred())
+
+			var event *redis.KeyspaceEvent
+			Eventually(ch).Should(Receive(&event))
+			Expect(event.Key).To(Equal("user:1"))
+			Expect(event.Type).To(Equal(redis.KeyspaceEventHSet))
+			Expect(event.DB).To(Equal(redisOptions().DB))
+
+			Eventually(ch).Should(Receive(&event))
+			Expect(event.Key).To(Equal("user:1"))
+			Expect(event.Type).To(Equal(redis.KeyspaceEventDel))
+		})
+
+		It("subscribes to keyevent channels", func() {
+			sub, err := client.SubscribeKeyspace(ctx, &redis.KeyspaceOptions{
+				NotifyFlags: "Eg",
+				KeyEvents:   true,
+				Types:       []redis.KeyspaceEventType{redis.KeyspaceEventDel},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer sub.Close()
+
+			ch := sub.Channel()
+
+			Expect(client.Set(ctx, "key", "value", 0).Err()).NotTo(HaveOccurred())
+			Expect(client.Del(ctx, "key").Err()).NotTo(HaveOccurred())
+
+			var event *redis.KeyspaceEvent
+			Eventually(ch).Should(Receive(&event))
+			Expect(event.Key).To(Equal("key"))
+			Expect(event.Type).To(Equal(redis.KeyspaceEventDel))
+			Expect(event.DB).To(Equal(redisOptions().DB))
+		})
+	})
 })
@@ -300,8 +300,10 @@ func (c *baseClient) initConn(ctx context.Context, cn *pool.Conn) error {
 
 	// for redis-server versions that do not support the HELLO command,
 	// RESP2 will continue to be used.
+	cn.Protocol = 2
 	if err := conn.Hello(ctx, protocol, username, password, "").Err(); err == nil {
 		auth = true
+		cn.Protocol = protocol
 	} else if !isRedisError(err) {
 		// When the server responds with the RESP protocol and the result is not a normal
 		// execution result of the HELLO command, we consider it to be an indication that
@@ -626,6 +628,8 @@ type Client struct {
 	*baseClient
 	cmdable
 	hooksMixin
+
+	pubSubMux *pubSubMux
 }
 
 // NewClient returns a client to the Redis Server specified by Options.
@@ -637,6 +641,9 @@ func NewClient(opt *Options) *Client {
 			opt: opt,
 		},
 	}
+	if opt.MultiplexPubSub && opt.Protocol != 2 {
+		c.pubSubMux = newPubSubMux(c.baseClient)
+	}
 	c.init()
 	c.connPool = newConnPool(opt, c.dialHook)
 
@@ -645,10 +652,20 @@ func NewClient(opt *Options) *Client {
 
 func (c *Client) init() {
 	c.cmdable = c.Process
+	process, pipeline := c.baseClient.process, c.baseClient.processPipeline
+	if mux := c.pubSubMux; mux != nil {
+		base := c.baseClient
+		process = func(ctx context.Context, cmd Cmder) error {
+			return mux.process(ctx, base, cmd)
+		}
+		pipeline = func(ctx context.Context, cmds []Cmder) error {
+			return mux.processPipeline(ctx, base, cmds)
+		}
+	}
 	c.initHooks(hooks{
 		dial:       c.baseClient.dial,
-		process:    c.baseClient.process,
-		pipeline:   c.baseClient.processPipeline,
+		process:    process,
+		pipeline:   pipeline,
 		txPipeline: c.baseClient.processTxPipeline,
 	})
 }
@@ -719,6 +736,10 @@ func (c *Client) TxPipeline() Pipeliner {
 }
 
 func (c *Client) pubSub() *PubSub {
+	if c.pubSubMux != nil && !c.pubSubMux.isUnsupported() {
+		return c.pubSubMux.pubSub()
+	}
+
 	pubsub := &PubSub{
 		opt: c.opt,
 
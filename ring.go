@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,16 +31,71 @@ type ConsistentHash interface {
 	Get(string) string
 }
 
+// ReplicatedConsistentHash is a ConsistentHash that can return the shards
+// that follow the owner of the key in the hash order. It is used to pick
+// the replicas when RingOptions.ReplicationFactor is bigger than 1.
+type ReplicatedConsistentHash interface {
+	ConsistentHash
+	// GetN returns up to n distinct shards for the key. The first shard
+	// is the one returned by Get.
+	GetN(key string, n int) []string
+}
+
 type rendezvousWrapper struct {
 	*rendezvous.Rendezvous
+	shards []string
+	hashes []uint64
 }
 
 func (w rendezvousWrapper) Get(key string) string {
 	return w.Lookup(key)
 }
 
+// GetN ranks the shards using the same scores as Lookup.
+func (w rendezvousWrapper) GetN(key string, n int) []string {
+	if n > len(w.shards) {
+		n = len(w.shards)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	khash := xxhash.Sum64String(key)
+	scores := make([]uint64, len(w.shards))
+	idx := make([]int, len(w.shards))
+	for i, nhash := range w.hashes {
+		scores[i] = rendezvousScore(khash ^ nhash)
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return scores[idx[i]] > scores[idx[j]]
+	})
+
+	shards := make([]string, n)
+	for i := range shards {
+		shards[i] = w.shards[idx[i]]
+	}
+	return shards
+}
+
+// rendezvousScore is xorshiftMult64 from go-rendezvous.
+func rendezvousScore(x uint64) uint64 {
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	return x * 2685821657736338717
+}
+
 func newRendezvous(shards []string) ConsistentHash {
-	return rendezvousWrapper{rendezvous.New(shards, xxhash.Sum64String)}
+	hashes := make([]uint64, len(shards))
+	for i, shard := range shards {
+		hashes[i] = xxhash.Sum64String(shard)
+	}
+	return rendezvousWrapper{
+		Rendezvous: rendezvous.New(shards, xxhash.Sum64String),
+		shards:     shards,
+		hashes:     hashes,
+	}
 }
 
 //------------------------------------------------------------------------------
@@ -51,6 +109,14 @@ type RingOptions struct {
 	// NewClient creates a shard client with provided options.
 	NewClient func(opt *Options) *Client
 
+	// ShardOptions is called with the options of a shard before its client
+	// is created and can override them, for example to use a different
+	// password, TLS config or DB for the shard.
+	// SetAddrs calls it again for every shard and recreates only the shards
+	// whose options changed. Changes of function fields, the Limiter and
+	// the contents of the TLS config are not detected.
+	ShardOptions func(name string, opt *Options)
+
 	// ClientName will execute the `CLIENT SETNAME ClientName` command for each conn.
 	ClientName string
 
@@ -58,8 +124,44 @@ type RingOptions struct {
 	// Shard is considered down after 3 subsequent failed checks.
 	HeartbeatFrequency time.Duration
 
+	// HealthCheck is called every HeartbeatFrequency to check each shard.
+	// Default is NewRingPingHealthCheck.
+	HealthCheck RingHealthCheck
+
+	// Weights of the shards by shard name. A shard with a bigger weight takes
+	// proportionally more keys and a shard with zero weight takes no keys.
+	// Shards without a weight have weight 1.
+	Weights map[string]int
+
+	// OnEvent is called when a shard changes its state and when the
+	// consistent hash is rebuilt.
+	OnEvent func(ctx context.Context, event *RingEvent)
+
+	// Migration enables moving keys to their new shards after SetAddrs.
+	// By default the keys that map to another shard are left behind.
+	Migration *RingMigrationOptions
+
+	// ReplicationFactor is the number of shards that store each key.
+	// Writes go to the shard that owns the key and to the shards that follow
+	// it in the hash order. Reads try the owner first and fall back to the
+	// other shards on a nil reply or a network error.
+	// Default is 1, which disables replication.
+	ReplicationFactor int
+	// WriteConsistency is the number of shards that must acknowledge
+	// a replicated write, out of the shards the key is written to. Those are
+	// fewer than ReplicationFactor when not enough shards are up.
+	// Default is RingWriteOne.
+	WriteConsistency RingWriteConsistency
+
 	// NewConsistentHash returns a consistent hash that is used
 	// to distribute keys across the shards.
+	// A shard with weight N is passed as N entries: the shard name
+	// followed by N-1 aliases.
+	// Replicas are picked with GetN if the hash implements
+	// ReplicatedConsistentHash and in the order of the shard names otherwise.
+	//
+	// Default is rendezvous hashing. See ConsistentHashByName for the other
+	// built-in hashes.
 	//
 	// See https://medium.com/@dgryski/consistent-hashing-algorithmic-tradeoffs-ef6b8e2fcae8
 	// for consistent hashing algorithmic tradeoffs.
@@ -113,6 +215,18 @@ func (opt *RingOptions) init() {
 		opt.HeartbeatFrequency = 500 * time.Millisecond
 	}
 
+	if opt.HealthCheck == nil {
+		opt.HealthCheck = NewRingPingHealthCheck()
+	}
+
+	if opt.Migration != nil {
+		opt.Migration.init()
+	}
+
+	if opt.ReplicationFactor == 0 {
+		opt.ReplicationFactor = 1
+	}
+
 	if opt.NewConsistentHash == nil {
 		opt.NewConsistentHash = newRendezvous
 	}
@@ -171,22 +285,187 @@ func (opt *RingOptions) clientOptions() *Options {
 	}
 }
 
+// ParseRingURL parses a URL into RingOptions that can be used to connect to Redis.
+// The URL must be in the form:
+//
+//	redis://<user>:<password>@<host>:<port>/<db_number>
+//	or
+//	rediss://<user>:<password>@<host>:<port>/<db_number>
+//
+// To add additional shards, specify the query parameter, "addr" one or more times.
+// The shards are named by their addresses. e.g:
+//
+//	redis://<user>:<password>@<host>:<port>?addr=<host2>:<port2>&addr=<host3>:<port3>
+//
+// The consistent hash is selected by name with the query parameter "consistent_hash",
+// see ConsistentHashByName. Other query parameters follow the rules of ParseClusterURL.
+//
+// Example:
+//
+//	redis://localhost:6789?addr=localhost:6790&consistent_hash=ketama&heartbeat_frequency=1s
+//	is equivalent to:
+//	&RingOptions{
+//		Addrs:              map[string]string{"localhost:6789": "localhost:6789", "localhost:6790": "localhost:6790"},
+//		NewConsistentHash:  NewKetamaHash,
+//		HeartbeatFrequency: time.Second,
+//	}
+func ParseRingURL(redisURL string) (*RingOptions, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &RingOptions{}
+
+	switch u.Scheme {
+	case "rediss":
+		h, _ := getHostPortWithDefaults(u)
+		o.TLSConfig = &tls.Config{ServerName: h}
+		fallthrough
+	case "redis":
+		o.Username, o.Password = getUserPassword(u)
+	default:
+		return nil, fmt.Errorf("redis: invalid URL scheme: %s", u.Scheme)
+	}
+
+	h, p := getHostPortWithDefaults(u)
+	addr := net.JoinHostPort(h, p)
+	o.Addrs = map[string]string{addr: addr}
+
+	f := strings.FieldsFunc(u.Path, func(r rune) bool {
+		return r == '/'
+	})
+	switch len(f) {
+	case 0:
+	case 1:
+		if o.DB, err = strconv.Atoi(f[0]); err != nil {
+			return nil, fmt.Errorf("redis: invalid database number: %q", f[0])
+		}
+	default:
+		return nil, fmt.Errorf("redis: invalid URL path: %s", u.Path)
+	}
+
+	return setupRingQueryParams(u, o)
+}
+
+// setupRingQueryParams converts query parameters in u to option value in o.
+func setupRingQueryParams(u *url.URL, o *RingOptions) (*RingOptions, error) {
+	q := queryOptions{q: u.Query()}
+
+	if q.has("db") {
+		o.DB = q.int("db")
+	}
+	o.Protocol = q.int("protocol")
+	o.ClientName = q.string("client_name")
+	o.HeartbeatFrequency = q.duration("heartbeat_frequency")
+	o.ReplicationFactor = q.int("replication_factor")
+	o.MaxRetries = q.int("max_retries")
+	o.MinRetryBackoff = q.duration("min_retry_backoff")
+	o.MaxRetryBackoff = q.duration("max_retry_backoff")
+	o.DialTimeout = q.duration("dial_timeout")
+	o.ReadTimeout = q.duration("read_timeout")
+	o.WriteTimeout = q.duration("write_timeout")
+	o.PoolFIFO = q.bool("pool_fifo")
+	o.PoolSize = q.int("pool_size")
+	o.MinIdleConns = q.int("min_idle_conns")
+	o.MaxIdleConns = q.int("max_idle_conns")
+	o.MaxActiveConns = q.int("max_active_conns")
+	o.PoolTimeout = q.duration("pool_timeout")
+	o.ConnMaxLifetime = q.duration("conn_max_lifetime")
+	o.ConnMaxIdleTime = q.duration("conn_max_idle_time")
+
+	if q.has("consistent_hash") {
+		newHash, err := ConsistentHashByName(q.string("consistent_hash"))
+		if err != nil {
+			return nil, err
+		}
+		o.NewConsistentHash = newHash
+	}
+
+	if q.err != nil {
+		return nil, q.err
+	}
+
+	// addr can be specified as many times as needed
+	addrs := q.strings("addr")
+	for _, addr := range addrs {
+		h, p, err := net.SplitHostPort(addr)
+		if err != nil || h == "" || p == "" {
+			return nil, fmt.Errorf("redis: unable to parse addr param: %s", addr)
+		}
+
+		addr = net.JoinHostPort(h, p)
+		o.Addrs[addr] = addr
+	}
+
+	// any parameters left?
+	if r := q.remaining(); len(r) > 0 {
+		return nil, fmt.Errorf("redis: unexpected option: %s", strings.Join(r, ", "))
+	}
+
+	return o, nil
+}
+
 //------------------------------------------------------------------------------
 
 type ringShard struct {
 	Client *Client
 	down   int32
 	addr   string
+	// opt are the options the client was created with.
+	opt Options
 }
 
-func newRingShard(opt *RingOptions, addr string) *ringShard {
+// ringShardOptions returns the client options of the shard.
+func ringShardOptions(opt *RingOptions, name, addr string) *Options {
 	clopt := opt.clientOptions()
 	clopt.Addr = addr
+	if opt.ShardOptions != nil {
+		opt.ShardOptions(name, clopt)
+	}
+	return clopt
+}
 
-	return &ringShard{
-		Client: opt.NewClient(clopt),
-		addr:   addr,
+func newRingShard(opt *RingOptions, clopt *Options) *ringShard {
+	shard := &ringShard{
+		addr: clopt.Addr,
+		opt:  *clopt,
 	}
+	shard.Client = opt.NewClient(clopt)
+	return shard
+}
+
+// sameOptions reports whether the shard was created with the options.
+// Only the value fields are compared: function fields, the Limiter and
+// the contents of the TLS config can't be compared reliably.
+func (shard *ringShard) sameOptions(opt *Options) bool {
+	a := &shard.opt
+	return a.Network == opt.Network &&
+		a.Addr == opt.Addr &&
+		a.ClientName == opt.ClientName &&
+		a.Protocol == opt.Protocol &&
+		a.MultiplexPubSub == opt.MultiplexPubSub &&
+		a.Username == opt.Username &&
+		a.Password == opt.Password &&
+		a.DB == opt.DB &&
+		a.MaxRetries == opt.MaxRetries &&
+		a.MinRetryBackoff == opt.MinRetryBackoff &&
+		a.MaxRetryBackoff == opt.MaxRetryBackoff &&
+		a.DialTimeout == opt.DialTimeout &&
+		a.ReadTimeout == opt.ReadTimeout &&
+		a.WriteTimeout == opt.WriteTimeout &&
+		a.ContextTimeoutEnabled == opt.ContextTimeoutEnabled &&
+		a.PoolFIFO == opt.PoolFIFO &&
+		a.PoolSize == opt.PoolSize &&
+		a.PoolTimeout == opt.PoolTimeout &&
+		a.MinIdleConns == opt.MinIdleConns &&
+		a.MaxIdleConns == opt.MaxIdleConns &&
+		a.MaxActiveConns == opt.MaxActiveConns &&
+		a.ConnMaxIdleTime == opt.ConnMaxIdleTime &&
+		a.ConnMaxLifetime == opt.ConnMaxLifetime &&
+		a.TLSConfig == opt.TLSConfig &&
+		a.DisableIndentity == opt.DisableIndentity &&
+		a.IdentitySuffix == opt.IdentitySuffix
 }
 
 func (shard *ringShard) String() string {
@@ -229,12 +508,18 @@ func (shard *ringShard) Vote(up bool) bool {
 type ringSharding struct {
 	opt *RingOptions
 
-	mu        sync.RWMutex
-	shards    *ringShards
-	closed    bool
-	hash      ConsistentHash
-	numShard  int
-	onNewNode []func(rdb *Client)
+	mu       sync.RWMutex
+	shards   *ringShards
+	closed   bool
+	hash     ConsistentHash
+	numShard int
+	// hashShards are the sorted names of the shards in the hash.
+	hashShards []string
+	weights    map[string]int
+	onNewNode  []func(rdb *Client)
+
+	// transition is set while keys are migrated after SetAddrs.
+	transition *ringTransition
 
 	// ensures exclusive access to SetAddrs so there is no need
 	// to hold mu for the duration of potentially long shard creation
@@ -248,7 +533,8 @@ type ringShards struct {
 
 func newRingSharding(opt *RingOptions) *ringSharding {
 	c := &ringSharding{
-		opt: opt,
+		opt:     opt,
+		weights: copyWeights(opt.Weights),
 	}
 	c.SetAddrs(opt.Addrs)
 
@@ -263,15 +549,16 @@ func (c *ringSharding) OnNewNode(fn func(rdb *Client)) {
 
 // SetAddrs replaces the shards in use, such that you can increase and
 // decrease number of shards, that you use. It will reuse shards that
-// existed before and close the ones that will not be used anymore.
+// existed before with the same name, address and options and close the ones
+// that will not be used anymore.
 func (c *ringSharding) SetAddrs(addrs map[string]string) {
 	c.setAddrsMu.Lock()
 	defer c.setAddrsMu.Unlock()
 
 	cleanup := func(shards map[string]*ringShard) {
-		for addr, shard := range shards {
+		for name, shard := range shards {
 			if err := shard.Client.Close(); err != nil {
-				internal.Logger.Printf(context.Background(), "shard.Close %s failed: %s", addr, err)
+				internal.Logger.Printf(context.Background(), "shard.Close %s failed: %s", name, err)
 			}
 		}
 	}
@@ -292,34 +579,102 @@ func (c *ringSharding) SetAddrs(addrs map[string]string) {
 		c.mu.Unlock()
 		return
 	}
+	prev := c.newTransitionLocked(unused)
 	c.shards = shards
-	c.rebalanceLocked()
+	liveShards := c.rebalanceLocked()
+	if prev != nil {
+		unused = nil
+	}
 	c.mu.Unlock()
 
 	cleanup(unused)
+	c.notify(context.Background(), &RingEvent{Type: RingRebalance, LiveShards: liveShards})
+
+	if prev != nil {
+		go c.migrate(prev)
+	}
+}
+
+// newTransitionLocked saves the current shards so the keys can be moved
+// to their new shards. It takes over the previous migration, if any.
+// Requires c.mu locked.
+func (c *ringSharding) newTransitionLocked(unused map[string]*ringShard) *ringTransition {
+	prev := c.transition
+	if c.opt.Migration == nil || c.shards == nil || (c.numShard == 0 && prev == nil) {
+		return nil
+	}
+	if prev != nil {
+		prev.cancel()
+		prev.carried = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.transition = &ringTransition{
+		hash:     c.hash,
+		numShard: c.numShard,
+		shards:   c.shards.m,
+		unused:   unused,
+		prev:     prev,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	return c.transition
+}
+
+// SetWeights replaces the shard weights and rebuilds the consistent hash.
+func (c *ringSharding) SetWeights(weights map[string]int) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.weights = copyWeights(weights)
+	liveShards := c.rebalanceLocked()
+	c.mu.Unlock()
+
+	c.notify(context.Background(), &RingEvent{Type: RingRebalance, LiveShards: liveShards})
+}
+
+func copyWeights(weights map[string]int) map[string]int {
+	if len(weights) == 0 {
+		return nil
+	}
+	m := make(map[string]int, len(weights))
+	for name, weight := range weights {
+		m[name] = weight
+	}
+	return m
+}
+
+func (c *ringSharding) notify(ctx context.Context, event *RingEvent) {
+	if c.opt.OnEvent != nil {
+		c.opt.OnEvent(ctx, event)
+	}
 }
 
 func (c *ringSharding) newRingShards(
 	addrs map[string]string, existing *ringShards,
 ) (shards *ringShards, created, unused map[string]*ringShard) {
 	shards = &ringShards{m: make(map[string]*ringShard, len(addrs))}
-	created = make(map[string]*ringShard) // indexed by addr
-	unused = make(map[string]*ringShard)  // indexed by addr
+	created = make(map[string]*ringShard) // indexed by name
+	unused = make(map[string]*ringShard)  // indexed by name
 
 	if existing != nil {
-		for _, shard := range existing.list {
-			unused[shard.addr] = shard
+		for name, shard := range existing.m {
+			unused[name] = shard
 		}
 	}
 
 	for name, addr := range addrs {
-		if shard, ok := unused[addr]; ok {
+		clopt := ringShardOptions(c.opt, name, addr)
+		if shard, ok := unused[name]; ok && shard.sameOptions(clopt) {
 			shards.m[name] = shard
-			delete(unused, addr)
+			delete(unused, name)
 		} else {
-			shard := newRingShard(c.opt, addr)
+			shard := newRingShard(c.opt, clopt)
 			shards.m[name] = shard
-			created[addr] = shard
+			created[name] = shard
 
 			for _, fn := range c.onNewNode {
 				fn(shard.Client)
@@ -346,6 +701,21 @@ func (c *ringSharding) List() []*ringShard {
 	return list
 }
 
+// namedShards returns the shards by name.
+func (c *ringSharding) namedShards() map[string]*ringShard {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil
+	}
+	shards := make(map[string]*ringShard, len(c.shards.m))
+	for name, shard := range c.shards.m {
+		shards[name] = shard
+	}
+	return shards
+}
+
 func (c *ringSharding) Hash(key string) string {
 	key = hashtag.Key(key)
 
@@ -382,6 +752,71 @@ func (c *ringSharding) GetByKey(key string) (*ringShard, error) {
 	return c.shards.m[shardName], nil
 }
 
+// ringReplica is a shard that stores a copy of a key.
+type ringReplica struct {
+	name  string
+	shard *ringShard
+}
+
+// GetReplicasByKey returns the shard that owns the key followed by
+// the shards that store its replicas.
+func (c *ringSharding) GetReplicasByKey(key string) ([]ringReplica, error) {
+	key = hashtag.Key(key)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, pool.ErrClosed
+	}
+
+	if c.numShard == 0 {
+		return nil, errRingShardsDown
+	}
+
+	n := c.opt.ReplicationFactor
+	if n > c.numShard {
+		n = c.numShard
+	}
+
+	var names []string
+	if hash, ok := c.hash.(ReplicatedConsistentHash); ok {
+		names = hash.GetN(key, n)
+	}
+	if len(names) == 0 {
+		names = c.followingShardsLocked(c.hash.Get(key), n)
+	}
+	if len(names) == 0 {
+		return nil, errRingShardsDown
+	}
+
+	replicas := make([]ringReplica, len(names))
+	for i, name := range names {
+		replicas[i] = ringReplica{name: name, shard: c.shards.m[name]}
+	}
+	return replicas, nil
+}
+
+// followingShardsLocked returns the owner followed by the next n-1 shards
+// in the order of the shard names.
+// Requires c.mu locked.
+func (c *ringSharding) followingShardsLocked(owner string, n int) []string {
+	if owner == "" {
+		return nil
+	}
+
+	start := sort.SearchStrings(c.hashShards, owner)
+	names := make([]string, 0, n)
+	names = append(names, owner)
+	for i := 1; i < len(c.hashShards) && len(names) < n; i++ {
+		name := c.hashShards[(start+i)%len(c.hashShards)]
+		if name != owner {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func (c *ringSharding) GetByName(shardName string) (*ringShard, error) {
 	if shardName == "" {
 		return c.Random()
@@ -405,21 +840,31 @@ func (c *ringSharding) Heartbeat(ctx context.Context, frequency time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			var rebalance bool
+			var events []*RingEvent
 
-			for _, shard := range c.List() {
-				err := shard.Client.Ping(ctx).Err()
+			for name, shard := range c.namedShards() {
+				err := c.opt.HealthCheck(ctx, name, shard.Client)
 				isUp := err == nil || err == pool.ErrPoolTimeout
 				if shard.Vote(isUp) {
 					internal.Logger.Printf(ctx, "ring shard state changed: %s", shard)
-					rebalance = true
+					event := &RingEvent{Type: RingShardUp, Shard: name, Addr: shard.addr}
+					if !isUp {
+						event.Type = RingShardDown
+						event.Err = err
+					}
+					events = append(events, event)
 				}
 			}
 
-			if rebalance {
+			if len(events) > 0 {
 				c.mu.Lock()
-				c.rebalanceLocked()
+				liveShards := c.rebalanceLocked()
 				c.mu.Unlock()
+
+				for _, event := range events {
+					c.notify(ctx, event)
+				}
+				c.notify(ctx, &RingEvent{Type: RingRebalance, LiveShards: liveShards})
 			}
 		case <-ctx.Done():
 			return
@@ -427,14 +872,15 @@ func (c *ringSharding) Heartbeat(ctx context.Context, frequency time.Duration) {
 	}
 }
 
-// rebalanceLocked removes dead shards from the Ring.
+// rebalanceLocked removes dead shards from the Ring and returns
+// the names of the live shards.
 // Requires c.mu locked.
-func (c *ringSharding) rebalanceLocked() {
+func (c *ringSharding) rebalanceLocked() []string {
 	if c.closed {
-		return
+		return nil
 	}
 	if c.shards == nil {
-		return
+		return nil
 	}
 
 	liveShards := make([]string, 0, len(c.shards.m))
@@ -445,8 +891,97 @@ func (c *ringSharding) rebalanceLocked() {
 		}
 	}
 
-	c.hash = c.opt.NewConsistentHash(liveShards)
-	c.numShard = len(liveShards)
+	c.hash, c.numShard = c.newConsistentHashLocked(liveShards)
+
+	c.hashShards = c.hashShards[:0]
+	for _, name := range liveShards {
+		if weight, ok := c.weights[name]; !ok || weight > 0 {
+			c.hashShards = append(c.hashShards, name)
+		}
+	}
+	sort.Strings(c.hashShards)
+
+	return liveShards
+}
+
+// newConsistentHashLocked builds the consistent hash for the weighted
+// shards and returns it together with the number of shards that take keys.
+// Requires c.mu locked.
+func (c *ringSharding) newConsistentHashLocked(shards []string) (ConsistentHash, int) {
+	if len(c.weights) == 0 {
+		return c.opt.NewConsistentHash(shards), len(shards)
+	}
+
+	var numShard int
+	entries := make([]string, 0, len(shards))
+	names := make(map[string]string, len(shards))
+	for _, name := range shards {
+		weight, ok := c.weights[name]
+		if !ok {
+			weight = 1
+		}
+		if weight > 0 {
+			numShard++
+		}
+		for i := 0; i < weight; i++ {
+			entry := name
+			if i > 0 {
+				entry = name + "#" + strconv.Itoa(i)
+			}
+			entries = append(entries, entry)
+			names[entry] = name
+		}
+	}
+
+	return weightedHash{
+		hash:  c.opt.NewConsistentHash(entries),
+		names: names,
+	}, numShard
+}
+
+// weightedHash maps the aliases of weighted shards back to the shard names.
+type weightedHash struct {
+	hash  ConsistentHash
+	names map[string]string
+}
+
+func (h weightedHash) Get(key string) string {
+	return h.names[h.hash.Get(key)]
+}
+
+func (h weightedHash) GetN(key string, n int) []string {
+	hash, ok := h.hash.(ReplicatedConsistentHash)
+	if !ok {
+		return nil
+	}
+
+	// Ask for more entries until there are n distinct shards,
+	// because the aliases of a shard take several entries.
+	for k := n; ; k *= 2 {
+		entries := hash.GetN(key, k)
+
+		shards := make([]string, 0, n)
+		for _, entry := range entries {
+			if name := h.names[entry]; name != "" && !containsString(shards, name) {
+				shards = append(shards, name)
+				if len(shards) == n {
+					return shards
+				}
+			}
+		}
+		if len(entries) < k {
+			return shards
+		}
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *ringSharding) Len() int {
@@ -465,6 +1000,11 @@ func (c *ringSharding) Close() error {
 	}
 	c.closed = true
 
+	if c.transition != nil {
+		c.transition.cancel()
+		c.transition = nil
+	}
+
 	var firstErr error
 
 	for _, shard := range c.shards.list {
@@ -476,6 +1016,7 @@ func (c *ringSharding) Close() error {
 	c.hash = nil
 	c.shards = nil
 	c.numShard = 0
+	c.hashShards = nil
 
 	return firstErr
 }
@@ -539,6 +1080,12 @@ func (c *Ring) SetAddrs(addrs map[string]string) {
 	c.sharding.SetAddrs(addrs)
 }
 
+// SetWeights replaces the shard weights by shard name and rebalances
+// the keys across the shards. Shards without a weight have weight 1.
+func (c *Ring) SetWeights(weights map[string]int) {
+	c.sharding.SetWeights(weights)
+}
+
 // Do create a Cmd from the args and processes the cmd.
 func (c *Ring) Do(ctx context.Context, args ...interface{}) *Cmd {
 	cmd := NewCmd(ctx, args...)
@@ -689,7 +1236,26 @@ func (c *Ring) cmdShard(ctx context.Context, cmd Cmder) (*ringShard, error) {
 	return c.sharding.GetByKey(firstKey)
 }
 
+func (c *Ring) cmdReadOnly(ctx context.Context, cmd Cmder) bool {
+	cmdsInfo, err := c.cmdsInfoCache.Get(ctx)
+	if err != nil {
+		return false
+	}
+	info := cmdsInfo[cmd.Name()]
+	return info != nil && info.ReadOnly
+}
+
 func (c *Ring) process(ctx context.Context, cmd Cmder) error {
+	if split := c.splitMultiKeyCmd(ctx, cmd); split != nil {
+		return c.processMultiKey(ctx, split)
+	}
+
+	if c.opt.ReplicationFactor > 1 {
+		if pos := cmdFirstKeyPos(cmd); pos != 0 {
+			return c.processReplicated(ctx, cmd, cmd.stringArg(pos))
+		}
+	}
+
 	var lastErr error
 	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
 		if attempt > 0 {
@@ -703,6 +1269,19 @@ func (c *Ring) process(ctx context.Context, cmd Cmder) error {
 			return err
 		}
 
+		if pos := cmdFirstKeyPos(cmd); pos != 0 {
+			if t := c.sharding.currentTransition(); t != nil {
+				key := cmd.stringArg(pos)
+				if prevs := t.prevShards(key, []*ringShard{shard}); len(prevs) > 0 {
+					lastErr = c.processMigrating(ctx, cmd, key, shard, t, prevs)
+					if lastErr == nil || !shouldRetry(lastErr, cmd.readTimeout() == nil) {
+						return lastErr
+					}
+					continue
+				}
+			}
+		}
+
 		lastErr = shard.Client.Process(ctx, cmd)
 		if lastErr == nil || !shouldRetry(lastErr, cmd.readTimeout() == nil) {
 			return lastErr
@@ -746,6 +1325,28 @@ func (c *Ring) generalProcessPipeline(
 		cmds = cmds[1 : len(cmds)-1]
 	}
 
+	if !tx {
+		// Multi-key commands are split by shard outside of transactions.
+		if expanded, splits := c.splitPipelineCmds(ctx, cmds); splits != nil {
+			_ = c.processShardCmds(ctx, expanded, tx)
+			for _, split := range splits {
+				_ = split.merge()
+			}
+			return cmdsFirstErr(cmds)
+		}
+	}
+
+	return c.processShardCmds(ctx, cmds, tx)
+}
+
+// processShardCmds sends the commands to the shards that own their keys.
+func (c *Ring) processShardCmds(ctx context.Context, cmds []Cmder, tx bool) error {
+	c.moveCmdsKeys(ctx, cmds)
+
+	if c.opt.ReplicationFactor > 1 {
+		return c.processReplicatedPipeline(ctx, cmds, tx)
+	}
+
 	cmdsMap := make(map[string][]Cmder)
 
 	for _, cmd := range cmds {
@@ -756,6 +1357,13 @@ func (c *Ring) generalProcessPipeline(
 		cmdsMap[hash] = append(cmdsMap[hash], cmd)
 	}
 
+	c.processShardPipelines(ctx, cmdsMap, tx)
+	return cmdsFirstErr(cmds)
+}
+
+// processShardPipelines concurrently sends the commands to the shards
+// by shard name.
+func (c *Ring) processShardPipelines(ctx context.Context, cmdsMap map[string][]Cmder, tx bool) {
 	var wg sync.WaitGroup
 	for hash, cmds := range cmdsMap {
 		wg.Add(1)
@@ -779,7 +1387,6 @@ func (c *Ring) generalProcessPipeline(
 	}
 
 	wg.Wait()
-	return cmdsFirstErr(cmds)
 }
 
 func (c *Ring) Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error {
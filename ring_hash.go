@@ -0,0 +1,245 @@
+package redis
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ConsistentHashByName returns the constructor of the built-in consistent
+// hash with the given name: "rendezvous" (the default), "ketama",
+// "jump" or "maglev". The result can be used as RingOptions.NewConsistentHash.
+func ConsistentHashByName(name string) (func(shards []string) ConsistentHash, error) {
+	switch strings.ToLower(name) {
+	case "", "rendezvous":
+		return newRendezvous, nil
+	case "ketama":
+		return NewKetamaHash, nil
+	case "jump":
+		return NewJumpHash, nil
+	case "maglev":
+		return NewMaglevHash, nil
+	}
+	return nil, fmt.Errorf("redis: unknown consistent hash: %q", name)
+}
+
+//------------------------------------------------------------------------------
+
+const (
+	ketamaPointsPerShard = 160
+	ketamaPointsPerHash  = 4
+)
+
+type ketamaPoint struct {
+	value uint32
+	shard string
+}
+
+// ketamaHash is the continuum of libketama.
+type ketamaHash struct {
+	points []ketamaPoint
+}
+
+var _ ReplicatedConsistentHash = (*ketamaHash)(nil)
+
+// NewKetamaHash returns a ketama consistent hash with the point layout of
+// libketama, which libmemcached and twemproxy use for servers of equal
+// weight: each shard takes 160 points computed as MD5 of
+// "<shard name>-<index>", and keys are hashed with MD5. To map the keys
+// like these clients, name the shards as their servers, for example
+// "10.0.0.1:6379", and don't set RingOptions.Weights: the aliases of
+// weighted shards take points of their own, unlike the weighted
+// continuums of these clients.
+func NewKetamaHash(shards []string) ConsistentHash {
+	h := &ketamaHash{
+		points: make([]ketamaPoint, 0, len(shards)*ketamaPointsPerShard),
+	}
+
+	for _, shard := range shards {
+		for i := 0; i < ketamaPointsPerShard/ketamaPointsPerHash; i++ {
+			digest := md5.Sum([]byte(shard + "-" + strconv.Itoa(i)))
+			for j := 0; j < ketamaPointsPerHash; j++ {
+				h.points = append(h.points, ketamaPoint{
+					value: binary.LittleEndian.Uint32(digest[j*4:]),
+					shard: shard,
+				})
+			}
+		}
+	}
+
+	sort.Slice(h.points, func(i, j int) bool {
+		if h.points[i].value != h.points[j].value {
+			return h.points[i].value < h.points[j].value
+		}
+		return h.points[i].shard < h.points[j].shard
+	})
+
+	return h
+}
+
+// search returns the index of the first point at or after the key.
+func (h *ketamaHash) search(key string) int {
+	digest := md5.Sum([]byte(key))
+	value := binary.LittleEndian.Uint32(digest[:4])
+
+	i := sort.Search(len(h.points), func(i int) bool {
+		return h.points[i].value >= value
+	})
+	if i == len(h.points) {
+		i = 0
+	}
+	return i
+}
+
+func (h *ketamaHash) Get(key string) string {
+	if len(h.points) == 0 {
+		return ""
+	}
+	return h.points[h.search(key)].shard
+}
+
+// GetN returns the shards of the points that follow the key on the continuum.
+func (h *ketamaHash) GetN(key string, n int) []string {
+	if len(h.points) == 0 || n <= 0 {
+		return nil
+	}
+
+	var shards []string
+	start := h.search(key)
+	for i := 0; i < len(h.points) && len(shards) < n; i++ {
+		shard := h.points[(start+i)%len(h.points)].shard
+		if !containsString(shards, shard) {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+//------------------------------------------------------------------------------
+
+// jumpHash maps the keys to the sorted shards with jump consistent hash.
+type jumpHash struct {
+	shards []string
+}
+
+// NewJumpHash returns a jump consistent hash (Lamping and Veach) of the keys
+// hashed with xxhash. The shards are sorted by name, so only adding or
+// removing the shard with the last name moves the minimal number of keys.
+func NewJumpHash(shards []string) ConsistentHash {
+	sorted := make([]string, len(shards))
+	copy(sorted, shards)
+	sort.Strings(sorted)
+	return jumpHash{shards: sorted}
+}
+
+func (h jumpHash) Get(key string) string {
+	if len(h.shards) == 0 {
+		return ""
+	}
+	return h.shards[jump(xxhash.Sum64String(key), len(h.shards))]
+}
+
+// jump is the jump consistent hash from https://arxiv.org/abs/1406.2294.
+func jump(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+//------------------------------------------------------------------------------
+
+// maglevTableSize is the size of the lookup table. It is a prime
+// much bigger than the number of shards.
+const maglevTableSize = 65537
+
+// maglevHash is the lookup table of Maglev hashing.
+type maglevHash struct {
+	shards []string
+	table  []int32
+}
+
+var _ ReplicatedConsistentHash = (*maglevHash)(nil)
+
+// NewMaglevHash returns a Maglev consistent hash (Eisenbud et al.) with
+// a lookup table of 65537 entries. Shard permutations use xxhash for
+// the offset and FNV-1a for the skip, and keys are hashed with xxhash.
+func NewMaglevHash(shards []string) ConsistentHash {
+	sorted := make([]string, len(shards))
+	copy(sorted, shards)
+	sort.Strings(sorted)
+
+	h := &maglevHash{shards: sorted}
+	if len(sorted) == 0 {
+		return h
+	}
+
+	offsets := make([]uint64, len(sorted))
+	skips := make([]uint64, len(sorted))
+	for i, shard := range sorted {
+		offsets[i] = xxhash.Sum64String(shard) % maglevTableSize
+
+		fh := fnv.New64a()
+		_, _ = fh.Write([]byte(shard))
+		skips[i] = fh.Sum64()%(maglevTableSize-1) + 1
+	}
+
+	h.table = make([]int32, maglevTableSize)
+	for i := range h.table {
+		h.table[i] = -1
+	}
+
+	next := make([]uint64, len(sorted))
+	for filled := 0; ; {
+		for i := range sorted {
+			c := (offsets[i] + next[i]*skips[i]) % maglevTableSize
+			for h.table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % maglevTableSize
+			}
+			h.table[c] = int32(i)
+			next[i]++
+
+			filled++
+			if filled == maglevTableSize {
+				return h
+			}
+		}
+	}
+}
+
+func (h *maglevHash) Get(key string) string {
+	if len(h.shards) == 0 {
+		return ""
+	}
+	return h.shards[h.table[xxhash.Sum64String(key)%maglevTableSize]]
+}
+
+// GetN returns the shards of the table entries that follow the key.
+func (h *maglevHash) GetN(key string, n int) []string {
+	if len(h.shards) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(h.shards) {
+		n = len(h.shards)
+	}
+
+	shards := make([]string, 0, n)
+	start := xxhash.Sum64String(key) % maglevTableSize
+	for i := uint64(0); i < maglevTableSize && len(shards) < n; i++ {
+		shard := h.shards[h.table[(start+i)%maglevTableSize]]
+		if !containsString(shards, shard) {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RingHealthCheck checks whether a ring shard can serve commands.
+// The shard is marked down after 3 subsequent failed checks and
+// is marked up again after the first successful check.
+type RingHealthCheck func(ctx context.Context, name string, client *Client) error
+
+// NewRingPingHealthCheck returns a RingHealthCheck that sends PING to the shard.
+// It is the default health check.
+func NewRingPingHealthCheck() RingHealthCheck {
+	return func(ctx context.Context, _ string, client *Client) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// NewRingMemoryHealthCheck returns a RingHealthCheck that fails when the shard
+// uses more than the given fraction of its maxmemory, for example 0.9.
+// Shards without maxmemory are always healthy.
+func NewRingMemoryHealthCheck(maxUsedRatio float64) RingHealthCheck {
+	return func(ctx context.Context, _ string, client *Client) error {
+		info, err := client.Info(ctx, "memory").Result()
+		if err != nil {
+			return err
+		}
+
+		used, maxMemory, err := parseInfoMemory(info)
+		if err != nil {
+			return err
+		}
+		if maxMemory == 0 {
+			return nil
+		}
+		if ratio := float64(used) / float64(maxMemory); ratio > maxUsedRatio {
+			return fmt.Errorf("redis: shard uses %.0f%% of maxmemory", ratio*100)
+		}
+		return nil
+	}
+}
+
+func parseInfoMemory(info string) (used, maxMemory int64, err error) {
+	var found bool
+	for _, line := range strings.Split(info, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "used_memory":
+			found = true
+			used, err = strconv.ParseInt(value, 10, 64)
+		case "maxmemory":
+			maxMemory, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("redis: can't parse INFO memory %s: %w", key, err)
+		}
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("redis: INFO memory has no used_memory")
+	}
+	return used, maxMemory, nil
+}
+
+//------------------------------------------------------------------------------
+
+// RingEventType is the type of a RingEvent.
+type RingEventType int
+
+const (
+	// RingShardDown is reported when a shard fails its health checks.
+	RingShardDown RingEventType = iota + 1
+	// RingShardUp is reported when a shard that was down passes a health check.
+	RingShardUp
+	// RingRebalance is reported when the consistent hash is rebuilt, for
+	// example after a shard changes its state or after SetAddrs.
+	RingRebalance
+)
+
+func (t RingEventType) String() string {
+	switch t {
+	case RingShardDown:
+		return "shard down"
+	case RingShardUp:
+		return "shard up"
+	case RingRebalance:
+		return "rebalance"
+	}
+	return "unknown"
+}
+
+// RingEvent describes a change of the ring state.
+type RingEvent struct {
+	Type RingEventType
+
+	// Shard and Addr are set for RingShardDown and RingShardUp.
+	Shard string
+	Addr  string
+	// Err is the health check error for RingShardDown.
+	Err error
+
+	// LiveShards are the names of the shards in the rebuilt consistent
+	// hash. It is set for RingRebalance.
+	LiveShards []string
+}
+
+func (e *RingEvent) String() string {
+	if e.Type == RingRebalance {
+		return fmt.Sprintf("ring %s: %s", e.Type, strings.Join(e.LiveShards, ", "))
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("ring %s: %s (%s): %s", e.Type, e.Shard, e.Addr, e.Err)
+	}
+	return fmt.Sprintf("ring %s: %s (%s)", e.Type, e.Shard, e.Addr)
+}
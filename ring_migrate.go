@@ -0,0 +1,482 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal"
+	"github.com/redis/go-redis/v9/internal/hashtag"
+)
+
+// RingMigrationOptions enable moving keys to their new shards after
+// Ring.SetAddrs. While the keys are being moved, read-only commands on keys
+// that don't exist on their new shard are sent to the shard that owned the
+// key before, and write commands, pipelines and replicated commands move
+// their keys to the new shards first. The keys that were checked are
+// remembered until the migration is done, so each key is moved at most
+// once by the commands. Calling SetAddrs again during a migration continues
+// it with the new shards.
+type RingMigrationOptions struct {
+	// BatchSize is the COUNT hint of SCAN used to find the keys to move.
+	// Default is 100.
+	BatchSize int64
+	// Throttle is the pause between batches.
+	Throttle time.Duration
+
+	// UseMigrate moves the keys with MIGRATE instead of DUMP and RESTORE.
+	// It requires the shards to be able to connect to each other using
+	// the shard addresses.
+	UseMigrate bool
+	// Timeout of MIGRATE. Default is 5 seconds.
+	Timeout time.Duration
+
+	// Progress is called after each batch and when the migration is done.
+	Progress func(RingMigrationProgress)
+}
+
+func (opt *RingMigrationOptions) init() {
+	if opt.BatchSize == 0 {
+		opt.BatchSize = 100
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 5 * time.Second
+	}
+}
+
+// RingMigrationProgress reports the progress of a key migration.
+type RingMigrationProgress struct {
+	// Shard is the name of the shard the keys are moved from.
+	Shard string
+	// Scanned is the number of keys scanned on the shard.
+	Scanned int64
+	// Moved is the number of keys moved from the shard.
+	Moved int64
+	// Err is the last error of the batch.
+	Err error
+	// Done reports that the migration finished.
+	Done bool
+}
+
+// ringTransition keeps the shards that owned the keys before SetAddrs
+// until the keys are moved to their new shards.
+type ringTransition struct {
+	hash     ConsistentHash
+	numShard int
+	shards   map[string]*ringShard
+	// unused are the shards removed by SetAddrs. They are closed when
+	// the migration stops.
+	unused map[string]*ringShard
+	// prev is the migration that was still running when SetAddrs was
+	// called again. Its keys are moved by this migration.
+	prev *ringTransition
+	// carried is set when a newer migration took over this one.
+	// Requires ringSharding.mu.
+	carried bool
+	// moved are the keys that are known to be on their new shards.
+	moved sync.Map
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (t *ringTransition) shardByKey(key string) *ringShard {
+	if t.numShard == 0 {
+		return nil
+	}
+	return t.shards[t.hash.Get(hashtag.Key(key))]
+}
+
+// prevShards returns the shards that may still store the key, newest
+// first. The owners of the key and the keys that were moved are skipped.
+func (t *ringTransition) prevShards(key string, owners []*ringShard) []*ringShard {
+	if _, ok := t.moved.Load(key); ok {
+		return nil
+	}
+
+	var prevs []*ringShard
+	for p := t; p != nil; p = p.prev {
+		shard := p.shardByKey(key)
+		if shard == nil || containsRingShard(owners, shard) || containsRingShard(prevs, shard) {
+			continue
+		}
+		prevs = append(prevs, shard)
+	}
+	return prevs
+}
+
+// allShards returns the names of the shards of the migration and of the
+// migrations it took over.
+func (t *ringTransition) allShards() map[*ringShard]string {
+	shards := make(map[*ringShard]string)
+	for p := t; p != nil; p = p.prev {
+		for name, shard := range p.shards {
+			if _, ok := shards[shard]; !ok {
+				shards[shard] = name
+			}
+		}
+	}
+	return shards
+}
+
+func containsRingShard(shards []*ringShard, shard *ringShard) bool {
+	for _, s := range shards {
+		if s == shard {
+			return true
+		}
+	}
+	return false
+}
+
+// currentTransition returns the running migration, or nil.
+func (c *ringSharding) currentTransition() *ringTransition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.transition
+}
+
+// migrate moves the keys of the transition to their new shards.
+func (c *ringSharding) migrate(t *ringTransition) {
+	opt := c.opt.Migration
+	ctx := t.ctx
+
+	defer func() {
+		c.mu.Lock()
+		if c.transition == t {
+			c.transition = nil
+		}
+		carried := t.carried
+		c.mu.Unlock()
+
+		t.cancel()
+		if carried {
+			// The newer migration closes the shards.
+			return
+		}
+		for p := t; p != nil; p = p.prev {
+			for name, shard := range p.unused {
+				if err := shard.Client.Close(); err != nil {
+					internal.Logger.Printf(context.Background(), "shard.Close %s failed: %s", name, err)
+				}
+			}
+		}
+	}()
+
+	for shard, name := range t.allShards() {
+		if !c.migrateShard(ctx, name, shard) {
+			return
+		}
+	}
+
+	if opt.Progress != nil {
+		opt.Progress(RingMigrationProgress{Done: true})
+	}
+}
+
+// migrateShard moves the keys that no longer belong to the shard.
+// It returns false when the migration was stopped.
+func (c *ringSharding) migrateShard(ctx context.Context, name string, shard *ringShard) bool {
+	opt := c.opt.Migration
+	progress := RingMigrationProgress{Shard: name}
+
+	var cursor uint64
+	for {
+		keys, next, err := shard.Client.Scan(ctx, cursor, "", opt.BatchSize).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			internal.Logger.Printf(ctx, "ring: migrating keys from shard %s failed: %s", name, err)
+			progress.Err = err
+			if opt.Progress != nil {
+				opt.Progress(progress)
+			}
+			return true
+		}
+		progress.Scanned += int64(len(keys))
+		progress.Err = nil
+
+		keysByShard := make(map[*ringShard][]string)
+		for _, key := range keys {
+			owner, err := c.keyOwner(key, shard)
+			if err != nil {
+				progress.Err = err
+				continue
+			}
+			if owner != shard {
+				keysByShard[owner] = append(keysByShard[owner], key)
+			}
+		}
+		for owner, keys := range keysByShard {
+			moved, err := c.moveKeys(ctx, shard, owner, keys)
+			progress.Moved += moved
+			if err != nil {
+				progress.Err = err
+			}
+		}
+
+		if opt.Progress != nil {
+			opt.Progress(progress)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return true
+		}
+		if err := internal.Sleep(ctx, opt.Throttle); err != nil {
+			return false
+		}
+	}
+}
+
+// keyOwner returns the shard the key should be moved to from the shard.
+// With replication, the key stays on the shard if it is one of its replicas.
+func (c *ringSharding) keyOwner(key string, shard *ringShard) (*ringShard, error) {
+	owners, err := c.keyOwners(key)
+	if err != nil {
+		return nil, err
+	}
+	if containsRingShard(owners, shard) {
+		return shard, nil
+	}
+	return owners[0], nil
+}
+
+// keyOwners returns the shard that owns the key followed by its replicas.
+func (c *ringSharding) keyOwners(key string) ([]*ringShard, error) {
+	if c.opt.ReplicationFactor <= 1 {
+		shard, err := c.GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return []*ringShard{shard}, nil
+	}
+
+	replicas, err := c.GetReplicasByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]*ringShard, len(replicas))
+	for i, replica := range replicas {
+		owners[i] = replica.shard
+	}
+	return owners, nil
+}
+
+// ringMove is a key to move from its previous shards to its owner.
+type ringMove struct {
+	key  string
+	from []*ringShard
+	to   *ringShard
+}
+
+// moveToOwners moves the keys from their previous shards, newest first,
+// so the newest value wins, and remembers the keys that were moved.
+// Failures are logged and the keys are tried again by the next command.
+func (c *ringSharding) moveToOwners(ctx context.Context, t *ringTransition, moves []ringMove) {
+	failed := make(map[string]bool)
+	for i := 0; ; i++ {
+		batches := make(map[[2]*ringShard][]string)
+		for _, m := range moves {
+			if i < len(m.from) {
+				route := [2]*ringShard{m.from[i], m.to}
+				batches[route] = append(batches[route], m.key)
+			}
+		}
+		if len(batches) == 0 {
+			break
+		}
+
+		for route, keys := range batches {
+			if _, err := c.moveKeys(ctx, route[0], route[1], keys); err != nil {
+				internal.Logger.Printf(ctx, "ring: moving keys to their new shard failed: %s", err)
+				for _, key := range keys {
+					failed[key] = true
+				}
+			}
+		}
+	}
+
+	for _, m := range moves {
+		if !failed[m.key] {
+			t.moved.Store(m.key, struct{}{})
+		}
+	}
+}
+
+// moveKeys moves the keys between the shards and returns the number of
+// moved keys. Keys that already exist on the target shard are newer and
+// are only deleted from the source shard.
+func (c *ringSharding) moveKeys(ctx context.Context, from, to *ringShard, keys []string) (int64, error) {
+	if c.opt.Migration.UseMigrate {
+		moved, err := c.migrateKeys(ctx, from, to, keys)
+		if err == nil {
+			return moved, nil
+		}
+		internal.Logger.Printf(ctx, "ring: MIGRATE failed, falling back to DUMP and RESTORE: %s", err)
+	}
+
+	dumps := make([]*StringCmd, len(keys))
+	ttls := make([]*DurationCmd, len(keys))
+	_, err := from.Client.Pipelined(ctx, func(pipe Pipeliner) error {
+		for i, key := range keys {
+			dumps[i] = pipe.Dump(ctx, key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != Nil {
+		return 0, err
+	}
+
+	restores := make([]*StatusCmd, len(keys))
+	_, _ = to.Client.Pipelined(ctx, func(pipe Pipeliner) error {
+		for i, key := range keys {
+			if dumps[i].Err() != nil || ttls[i].Err() != nil {
+				continue
+			}
+			ttl := ttls[i].Val()
+			if ttl < 0 {
+				ttl = 0
+			}
+			restores[i] = pipe.Restore(ctx, key, ttl, dumps[i].Val())
+		}
+		return nil
+	})
+
+	var moved int64
+	var firstErr error
+	done := make([]string, 0, len(keys))
+	for i, key := range keys {
+		if restores[i] == nil {
+			continue
+		}
+		switch err := restores[i].Err(); {
+		case err == nil:
+			moved++
+			done = append(done, key)
+		case isBusyKeyError(err):
+			done = append(done, key)
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+
+	if len(done) > 0 {
+		if err := from.Client.Del(ctx, done...).Err(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return moved, firstErr
+}
+
+func (c *ringSharding) migrateKeys(ctx context.Context, from, to *ringShard, keys []string) (int64, error) {
+	host, port, err := net.SplitHostPort(to.addr)
+	if err != nil {
+		return 0, err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	status, err := from.Client.MigrateKeys(ctx, &MigrateArgs{
+		Host:     host,
+		Port:     port,
+		DB:       to.opt.DB,
+		Timeout:  c.opt.Migration.Timeout,
+		Username: to.opt.Username,
+		Password: to.opt.Password,
+		Keys:     keys,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if status == "NOKEY" {
+		return 0, nil
+	}
+	return int64(len(keys)), nil
+}
+
+func isBusyKeyError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "BUSYKEY ")
+}
+
+//------------------------------------------------------------------------------
+
+// processMigrating processes the command while its key may still be on
+// one of the prev shards.
+func (c *Ring) processMigrating(
+	ctx context.Context, cmd Cmder, key string, shard *ringShard, t *ringTransition, prevs []*ringShard,
+) error {
+	if c.cmdReadOnly(ctx, cmd) {
+		return c.readShard(ctx, t, key, shard, prevs).Client.Process(ctx, cmd)
+	}
+
+	c.sharding.moveToOwners(ctx, t, []ringMove{{key: key, from: prevs, to: shard}})
+	return shard.Client.Process(ctx, cmd)
+}
+
+// readShard returns the shard to read the key from: the shard, unless
+// the key doesn't exist there and exists on one of the prev shards.
+func (c *Ring) readShard(
+	ctx context.Context, t *ringTransition, key string, shard *ringShard, prevs []*ringShard,
+) *ringShard {
+	n, err := shard.Client.Exists(ctx, key).Result()
+	if err != nil {
+		return shard
+	}
+	if n > 0 {
+		t.moved.Store(key, struct{}{})
+		return shard
+	}
+
+	for i, prev := range prevs {
+		if prev.IsDown() {
+			continue
+		}
+		if i == len(prevs)-1 {
+			return prev
+		}
+		if n, err := prev.Client.Exists(ctx, key).Result(); err == nil && n > 0 {
+			return prev
+		}
+	}
+	return shard
+}
+
+// moveCmdsKeys moves the keys of the commands that may still be on their
+// previous shards, so the commands can be sent to the new shards.
+func (c *Ring) moveCmdsKeys(ctx context.Context, cmds []Cmder) {
+	t := c.sharding.currentTransition()
+	if t == nil {
+		return
+	}
+
+	var moves []ringMove
+	seen := make(map[string]bool)
+	for _, cmd := range cmds {
+		pos := cmdFirstKeyPos(cmd)
+		if pos == 0 {
+			continue
+		}
+		key := cmd.stringArg(pos)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		owners, err := c.sharding.keyOwners(key)
+		if err != nil {
+			continue
+		}
+		if prevs := t.prevShards(key, owners); len(prevs) > 0 {
+			moves = append(moves, ringMove{key: key, from: prevs, to: owners[0]})
+		}
+	}
+
+	if len(moves) > 0 {
+		c.sharding.moveToOwners(ctx, t, moves)
+	}
+}
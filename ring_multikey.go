@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// ringMultiKeyCmd is a multi-key command split into commands
+// for the shards that own its keys.
+type ringMultiKeyCmd struct {
+	cmd  Cmder
+	subs []Cmder
+	// pos are the positions of the keys of each sub-command in the
+	// original command. They are used to merge MGET replies.
+	pos [][]int
+}
+
+// splitMultiKeyCmd splits MGET, MSET, DEL, UNLINK, EXISTS and TOUCH by the
+// shards that own the keys. It returns nil if the keys belong to one shard
+// or the command can't be split.
+func (c *Ring) splitMultiKeyCmd(ctx context.Context, cmd Cmder) *ringMultiKeyCmd {
+	name := cmd.Name()
+	step := 1
+	switch name {
+	case "mget", "del", "unlink", "exists", "touch":
+	case "mset":
+		step = 2
+	default:
+		return nil
+	}
+
+	switch cmd.(type) {
+	case *Cmd, *SliceCmd, *IntCmd, *StatusCmd:
+	default:
+		return nil
+	}
+
+	args := cmd.Args()
+	if len(args) < 1+2*step || (len(args)-1)%step != 0 {
+		return nil
+	}
+
+	var hashes []string
+	argsByHash := make(map[string][]interface{})
+	posByHash := make(map[string][]int)
+	for i := 1; i < len(args); i += step {
+		hash := c.sharding.Hash(cmd.stringArg(i))
+		if _, ok := argsByHash[hash]; !ok {
+			hashes = append(hashes, hash)
+			argsByHash[hash] = []interface{}{args[0]}
+		}
+		argsByHash[hash] = append(argsByHash[hash], args[i:i+step]...)
+		posByHash[hash] = append(posByHash[hash], (i-1)/step)
+	}
+	if len(hashes) < 2 {
+		return nil
+	}
+
+	split := &ringMultiKeyCmd{cmd: cmd}
+	for _, hash := range hashes {
+		var sub Cmder
+		switch name {
+		case "mget":
+			sub = NewSliceCmd(ctx, argsByHash[hash]...)
+		case "mset":
+			sub = NewStatusCmd(ctx, argsByHash[hash]...)
+		default:
+			sub = NewIntCmd(ctx, argsByHash[hash]...)
+		}
+		split.subs = append(split.subs, sub)
+		split.pos = append(split.pos, posByHash[hash])
+	}
+	return split
+}
+
+// merge sets the reply of the original command from the replies of
+// the sub-commands. The first error of the sub-commands is returned.
+func (s *ringMultiKeyCmd) merge() error {
+	firstErr := cmdsFirstErr(s.subs)
+
+	switch s.cmd.Name() {
+	case "mget":
+		vals := make([]interface{}, len(s.cmd.Args())-1)
+		for i, sub := range s.subs {
+			for j, val := range sub.(*SliceCmd).Val() {
+				vals[s.pos[i][j]] = val
+			}
+		}
+		switch cmd := s.cmd.(type) {
+		case *SliceCmd:
+			cmd.SetVal(vals)
+		case *Cmd:
+			cmd.SetVal(vals)
+		}
+	case "mset":
+		if firstErr == nil {
+			switch cmd := s.cmd.(type) {
+			case *StatusCmd:
+				cmd.SetVal("OK")
+			case *Cmd:
+				cmd.SetVal("OK")
+			}
+		}
+	default:
+		var n int64
+		for _, sub := range s.subs {
+			n += sub.(*IntCmd).Val()
+		}
+		switch cmd := s.cmd.(type) {
+		case *IntCmd:
+			cmd.SetVal(n)
+		case *Cmd:
+			cmd.SetVal(n)
+		}
+	}
+
+	s.cmd.SetErr(firstErr)
+	return firstErr
+}
+
+// processMultiKey concurrently processes the sub-commands
+// and merges their replies.
+func (c *Ring) processMultiKey(ctx context.Context, split *ringMultiKeyCmd) error {
+	var wg sync.WaitGroup
+	for _, sub := range split.subs {
+		wg.Add(1)
+		go func(sub Cmder) {
+			defer wg.Done()
+			_ = c.process(ctx, sub)
+		}(sub)
+	}
+	wg.Wait()
+
+	return split.merge()
+}
+
+// splitPipelineCmds replaces the multi-key commands of the pipeline with
+// their sub-commands. The returned splits must be merged after the
+// pipeline is processed.
+func (c *Ring) splitPipelineCmds(ctx context.Context, cmds []Cmder) ([]Cmder, []*ringMultiKeyCmd) {
+	var splits []*ringMultiKeyCmd
+	var expanded []Cmder
+	for i, cmd := range cmds {
+		split := c.splitMultiKeyCmd(ctx, cmd)
+		if split == nil {
+			if expanded != nil {
+				expanded = append(expanded, cmd)
+			}
+			continue
+		}
+
+		if expanded == nil {
+			expanded = append(make([]Cmder, 0, len(cmds)), cmds[:i]...)
+		}
+		expanded = append(expanded, split.subs...)
+		splits = append(splits, split)
+	}
+	if expanded == nil {
+		return cmds, nil
+	}
+	return expanded, splits
+}
+
+//------------------------------------------------------------------------------
+
+// ScanAll returns an iterator over the keys of all live shards. With
+// replication, each key is returned only by the shard that owns it.
+func (c *Ring) ScanAll(ctx context.Context, match string, count int64) *ScanAllIterator {
+	var shards []*ringShard
+	for _, shard := range c.sharding.List() {
+		if shard.IsUp() {
+			shards = append(shards, shard)
+		}
+	}
+
+	clients := make([]*Client, len(shards))
+	for i, shard := range shards {
+		clients[i] = shard.Client
+	}
+
+	it := &ScanAllIterator{
+		clients: clients,
+		scan: func(ctx context.Context, client *Client) *ScanCmd {
+			return client.Scan(ctx, 0, match, count)
+		},
+	}
+	if c.opt.ReplicationFactor > 1 {
+		it.keep = func(i int, key string) bool {
+			owner, err := c.sharding.GetByKey(key)
+			return err == nil && owner == shards[i]
+		}
+	}
+	return it
+}
@@ -0,0 +1,268 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9/internal"
+)
+
+// RingWriteConsistency is the number of shards that must acknowledge
+// a write when RingOptions.ReplicationFactor is bigger than 1.
+// The number is relative to the shards the key is replicated to, which
+// are fewer than ReplicationFactor when not enough shards are up.
+type RingWriteConsistency int
+
+const (
+	// RingWriteOne requires the shard that owns the key. Writes to the
+	// replicas are sent too, but their failures are ignored.
+	RingWriteOne RingWriteConsistency = iota
+	// RingWriteQuorum requires the majority of the replica shards,
+	// including the shard that owns the key.
+	RingWriteQuorum
+	// RingWriteAll requires all replica shards.
+	RingWriteAll
+)
+
+func (wc RingWriteConsistency) String() string {
+	switch wc {
+	case RingWriteOne:
+		return "one"
+	case RingWriteQuorum:
+		return "quorum"
+	case RingWriteAll:
+		return "all"
+	}
+	return "unknown"
+}
+
+// required returns the number of acknowledgements for the number of replicas.
+func (wc RingWriteConsistency) required(replicas int) int {
+	switch wc {
+	case RingWriteQuorum:
+		return replicas/2 + 1
+	case RingWriteAll:
+		return replicas
+	}
+	return 1
+}
+
+// RingReplicationError is set on a replicated write that was not
+// acknowledged by enough shards. The write may still have been applied
+// by some of the shards.
+type RingReplicationError struct {
+	// Acked is the number of shards that acknowledged the write.
+	Acked int
+	// Required is the number of acknowledgements required by
+	// RingOptions.WriteConsistency.
+	Required int
+	// Errs are the errors of the shards that did not acknowledge the write
+	// by shard name.
+	Errs map[string]error
+}
+
+func (e *RingReplicationError) Error() string {
+	names := make([]string, 0, len(e.Errs))
+	for name := range e.Errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "redis: write acknowledged by %d of %d required shards", e.Acked, e.Required)
+	for _, name := range names {
+		fmt.Fprintf(&b, "; %s: %s", name, e.Errs[name])
+	}
+	return b.String()
+}
+
+// ringWriteAcked reports whether the shard processed the write.
+// Redis errors, like WRONGTYPE, are replies of the shard.
+func ringWriteAcked(err error) bool {
+	return err == nil || err == Nil || isRedisError(err)
+}
+
+// ringReadFallback reports whether a read that failed with the error
+// should be retried on the next replica.
+func ringReadFallback(err error) bool {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	case Nil:
+		return true
+	}
+	return !isRedisError(err)
+}
+
+// replicationErr returns the error of the write given the errors of
+// the replicas. The reply of the command is the reply of the first replica,
+// so the write always requires it.
+func (c *Ring) replicationErr(replicas []ringReplica, errs []error) error {
+	var acked int
+	for _, err := range errs {
+		if ringWriteAcked(err) {
+			acked++
+		}
+	}
+
+	required := c.opt.WriteConsistency.required(len(replicas))
+	if acked >= required && ringWriteAcked(errs[0]) {
+		return nil
+	}
+
+	replErr := &RingReplicationError{
+		Acked:    acked,
+		Required: required,
+		Errs:     make(map[string]error),
+	}
+	for i, err := range errs {
+		if !ringWriteAcked(err) {
+			replErr.Errs[replicas[i].name] = err
+		}
+	}
+	return replErr
+}
+
+func (c *Ring) processReplicated(ctx context.Context, cmd Cmder, key string) error {
+	c.moveCmdsKeys(ctx, []Cmder{cmd})
+
+	replicas, err := c.sharding.GetReplicasByKey(key)
+	if err != nil {
+		return err
+	}
+
+	if c.cmdReadOnly(ctx, cmd) {
+		for _, replica := range replicas {
+			err = c.processShard(ctx, replica.shard, cmd)
+			if !ringReadFallback(err) {
+				return err
+			}
+		}
+		return err
+	}
+
+	errs := make([]error, len(replicas))
+	var wg sync.WaitGroup
+	for i, replica := range replicas {
+		replicaCmd := cmd
+		if i > 0 {
+			replicaCmd = NewCmd(ctx, cmd.Args()...)
+		}
+
+		wg.Add(1)
+		go func(i int, shard *ringShard, cmd Cmder) {
+			defer wg.Done()
+			errs[i] = c.processShard(ctx, shard, cmd)
+		}(i, replica.shard, replicaCmd)
+	}
+	wg.Wait()
+
+	if err := c.replicationErr(replicas, errs); err != nil {
+		return err
+	}
+	return errs[0]
+}
+
+// processShard processes the command on the shard and retries it like
+// Ring.process.
+func (c *Ring) processShard(ctx context.Context, shard *ringShard, cmd Cmder) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.opt.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := internal.Sleep(ctx, c.retryBackoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		lastErr = shard.Client.Process(ctx, cmd)
+		if lastErr == nil || !shouldRetry(lastErr, cmd.readTimeout() == nil) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// ringReplicatedCmd is a command of a pipeline and the shards that store
+// its key. Writes have a copy of the command for each replica.
+type ringReplicatedCmd struct {
+	cmd      Cmder
+	replicas []ringReplica
+	copies   []Cmder
+	// next is the index of the next replica to read from.
+	next int
+}
+
+// processReplicatedPipeline sends the writes to all replicas and the reads
+// to the shard that owns the key. Reads that fail are retried on the next
+// replica, except in transactions. Each command reports its own error.
+func (c *Ring) processReplicatedPipeline(ctx context.Context, cmds []Cmder, tx bool) error {
+	cmdsMap := make(map[string][]Cmder)
+	var reads, writes []*ringReplicatedCmd
+
+	for _, cmd := range cmds {
+		pos := cmdFirstKeyPos(cmd)
+		if pos == 0 {
+			cmdsMap[""] = append(cmdsMap[""], cmd)
+			continue
+		}
+
+		replicas, err := c.sharding.GetReplicasByKey(cmd.stringArg(pos))
+		if err != nil {
+			cmd.SetErr(err)
+			continue
+		}
+
+		rcmd := &ringReplicatedCmd{cmd: cmd, replicas: replicas, next: 1}
+		primary := replicas[0].name
+		cmdsMap[primary] = append(cmdsMap[primary], cmd)
+
+		if c.cmdReadOnly(ctx, cmd) {
+			reads = append(reads, rcmd)
+			continue
+		}
+
+		for _, replica := range replicas[1:] {
+			copyCmd := NewCmd(ctx, cmd.Args()...)
+			rcmd.copies = append(rcmd.copies, copyCmd)
+			cmdsMap[replica.name] = append(cmdsMap[replica.name], copyCmd)
+		}
+		writes = append(writes, rcmd)
+	}
+
+	c.processShardPipelines(ctx, cmdsMap, tx)
+
+	for _, w := range writes {
+		errs := make([]error, 0, len(w.replicas))
+		errs = append(errs, w.cmd.Err())
+		for _, copyCmd := range w.copies {
+			errs = append(errs, copyCmd.Err())
+		}
+		if err := c.replicationErr(w.replicas, errs); err != nil {
+			w.cmd.SetErr(err)
+		}
+	}
+
+	for !tx && len(reads) > 0 {
+		cmdsMap := make(map[string][]Cmder)
+		retries := reads[:0]
+		for _, r := range reads {
+			if r.next >= len(r.replicas) || !ringReadFallback(r.cmd.Err()) {
+				continue
+			}
+			name := r.replicas[r.next].name
+			r.next++
+			cmdsMap[name] = append(cmdsMap[name], r.cmd)
+			retries = append(retries, r)
+		}
+		reads = retries
+
+		if len(cmdsMap) > 0 {
+			c.processShardPipelines(ctx, cmdsMap, false)
+		}
+	}
+
+	return cmdsFirstErr(cmds)
+}
@@ -3,6 +3,7 @@ package redis_test
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
@@ -227,6 +228,333 @@ var _ = Describe("Redis Ring", func() {
 			Expect(gotShard3).To(BeNil())
 		})
 	})
+
+	Describe("key migration", func() {
+		var migrating *redis.Ring
+		var done chan redis.RingMigrationProgress
+
+		BeforeEach(func() {
+			done = make(chan redis.RingMigrationProgress, 1)
+
+			opt := redisRingOptions()
+			opt.HeartbeatFrequency = heartbeat
+			opt.Migration = &redis.RingMigrationOptions{
+				BatchSize: 10,
+				Progress: func(p redis.RingMigrationProgress) {
+					if p.Done {
+						select {
+						case done <- p:
+						default:
+						}
+					}
+				},
+			}
+			migrating = redis.NewRing(opt)
+
+			for i := 0; i < 100; i++ {
+				err := migrating.Set(ctx, fmt.Sprintf("key%d", i), "value", 0).Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			Expect(migrating.Close()).NotTo(HaveOccurred())
+		})
+
+		It("moves keys to the remaining shard", func() {
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+			})
+
+			// Reads fall back to the previous shard during the migration.
+			for i := 0; i < 100; i++ {
+				val, err := migrating.Get(ctx, fmt.Sprintf("key%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value"))
+			}
+
+			Eventually(done).Should(Receive())
+
+			Expect(ringShard1.DBSize(ctx).Val()).To(Equal(int64(100)))
+			Expect(ringShard2.DBSize(ctx).Val()).To(Equal(int64(0)))
+		})
+
+		It("moves the key before writing it", func() {
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+			})
+
+			for i := 0; i < 100; i++ {
+				err := migrating.Append(ctx, fmt.Sprintf("key%d", i), "!").Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Eventually(done).Should(Receive())
+
+			for i := 0; i < 100; i++ {
+				val, err := migrating.Get(ctx, fmt.Sprintf("key%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value!"))
+			}
+		})
+
+		It("reads keys that don't exist on the new shard", func() {
+			for i := 0; i < 20; i++ {
+				err := migrating.SAdd(ctx, fmt.Sprintf("set%d", i), "a", "b").Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+			})
+
+			for i := 0; i < 20; i++ {
+				members, err := migrating.SMembers(ctx, fmt.Sprintf("set%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(members).To(ConsistOf("a", "b"))
+			}
+			Eventually(done).Should(Receive())
+		})
+
+		It("moves the keys of pipelines", func() {
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+			})
+
+			_, err := migrating.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := 0; i < 100; i++ {
+					pipe.Append(ctx, fmt.Sprintf("key%d", i), "!")
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			cmds, err := migrating.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := 0; i < 100; i++ {
+					pipe.Get(ctx, fmt.Sprintf("key%d", i))
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			for _, cmd := range cmds {
+				Expect(cmd.(*redis.StringCmd).Val()).To(Equal("value!"))
+			}
+			Eventually(done).Should(Receive())
+		})
+
+		It("continues the migration after another SetAddrs", func() {
+			Expect(ringShard3.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+			})
+			migrating.SetAddrs(map[string]string{
+				"ringShardOne":   ":" + ringShard1Port,
+				"ringShardThree": ":" + ringShard3Port,
+			})
+
+			for i := 0; i < 100; i++ {
+				val, err := migrating.Get(ctx, fmt.Sprintf("key%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value"))
+			}
+
+			Eventually(func() int64 {
+				return ringShard2.DBSize(ctx).Val()
+			}).Should(Equal(int64(0)))
+			Expect(ringShard1.DBSize(ctx).Val() + ringShard3.DBSize(ctx).Val()).To(Equal(int64(100)))
+		})
+
+		It("moves the keys of replicated commands", func() {
+			Expect(ringShard3.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+			opt := redisRingOptions()
+			opt.HeartbeatFrequency = heartbeat
+			opt.Addrs["ringShardThree"] = ":" + ringShard3Port
+			opt.ReplicationFactor = 2
+			opt.Migration = &redis.RingMigrationOptions{BatchSize: 10}
+			replicated := redis.NewRing(opt)
+			defer replicated.Close()
+
+			for i := 0; i < 100; i++ {
+				err := replicated.Set(ctx, fmt.Sprintf("rkey%d", i), "value", 0).Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			replicated.SetAddrs(map[string]string{
+				"ringShardOne": ":" + ringShard1Port,
+				"ringShardTwo": ":" + ringShard2Port,
+			})
+
+			for i := 0; i < 100; i++ {
+				err := replicated.Append(ctx, fmt.Sprintf("rkey%d", i), "!").Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+			for i := 0; i < 100; i++ {
+				val, err := replicated.Get(ctx, fmt.Sprintf("rkey%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value!"))
+			}
+		})
+	})
+
+	Describe("multi-key commands", func() {
+		It("splits MGET, MSET and DEL by shard", func() {
+			var keys []string
+			var pairs []interface{}
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprintf("key%d", i)
+				keys = append(keys, key)
+				pairs = append(pairs, key, "value"+strconv.Itoa(i))
+			}
+
+			err := ring.MSet(ctx, pairs...).Err()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ringShard1.DBSize(ctx).Val()).To(BeNumerically(">", 0))
+			Expect(ringShard2.DBSize(ctx).Val()).To(BeNumerically(">", 0))
+
+			vals, err := ring.MGet(ctx, append(keys, "missing")...).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vals).To(HaveLen(21))
+			for i := 0; i < 20; i++ {
+				Expect(vals[i]).To(Equal("value" + strconv.Itoa(i)))
+			}
+			Expect(vals[20]).To(BeNil())
+
+			n, err := ring.Exists(ctx, keys...).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(int64(20)))
+
+			n, err = ring.Del(ctx, keys...).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(int64(20)))
+		})
+
+		It("splits multi-key commands in pipelines", func() {
+			var keys []string
+			for i := 0; i < 20; i++ {
+				keys = append(keys, fmt.Sprintf("key%d", i))
+			}
+			setRingKeys()
+
+			var mget *redis.SliceCmd
+			var del *redis.IntCmd
+			_, err := ring.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				mget = pipe.MGet(ctx, keys...)
+				del = pipe.Del(ctx, keys...)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mget.Val()).To(HaveLen(20))
+			for _, val := range mget.Val() {
+				Expect(val).To(Equal("value"))
+			}
+			Expect(del.Val()).To(Equal(int64(20)))
+		})
+
+		It("scans keys of all shards", func() {
+			setRingKeys()
+
+			var keys []string
+			iter := ring.ScanAll(ctx, "key*", 10)
+			for iter.Next(ctx) {
+				keys = append(keys, iter.Val())
+			}
+			Expect(iter.Err()).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(100))
+		})
+	})
+
+	Describe("replication", func() {
+		var replicated *redis.Ring
+
+		BeforeEach(func() {
+			opt := redisRingOptions()
+			opt.HeartbeatFrequency = heartbeat
+			opt.ReplicationFactor = 2
+			opt.WriteConsistency = redis.RingWriteAll
+			replicated = redis.NewRing(opt)
+		})
+
+		AfterEach(func() {
+			Expect(replicated.Close()).NotTo(HaveOccurred())
+		})
+
+		It("writes keys to all replicas", func() {
+			for i := 0; i < 100; i++ {
+				err := replicated.Set(ctx, fmt.Sprintf("key%d", i), "value", 0).Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(ringShard1.DBSize(ctx).Val()).To(Equal(int64(100)))
+			Expect(ringShard2.DBSize(ctx).Val()).To(Equal(int64(100)))
+		})
+
+		It("reads from a replica when the owner has no key", func() {
+			for i := 0; i < 100; i++ {
+				err := replicated.Set(ctx, fmt.Sprintf("key%d", i), "value", 0).Err()
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(ringShard1.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+			for i := 0; i < 100; i++ {
+				val, err := replicated.Get(ctx, fmt.Sprintf("key%d", i)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal("value"))
+			}
+		})
+
+		It("replicates pipelined writes and reads from replicas", func() {
+			cmds, err := replicated.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := 0; i < 100; i++ {
+					pipe.Set(ctx, fmt.Sprintf("key%d", i), "value", 0)
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmds).To(HaveLen(100))
+
+			Expect(ringShard1.DBSize(ctx).Val()).To(Equal(int64(100)))
+			Expect(ringShard2.DBSize(ctx).Val()).To(Equal(int64(100)))
+			Expect(ringShard2.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+			var gets []*redis.StringCmd
+			_, err = replicated.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := 0; i < 100; i++ {
+					gets = append(gets, pipe.Get(ctx, fmt.Sprintf("key%d", i)))
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			for _, get := range gets {
+				Expect(get.Val()).To(Equal("value"))
+			}
+		})
+
+		It("reports writes that miss the write consistency", func() {
+			opt := redisRingOptions()
+			opt.HeartbeatFrequency = heartbeat
+			opt.ReplicationFactor = 3
+			opt.WriteConsistency = redis.RingWriteAll
+			replicated := redis.NewRing(opt)
+			defer replicated.Close()
+
+			err := replicated.Set(ctx, "key", "value", 0).Err()
+			var replErr *redis.RingReplicationError
+			Expect(errors.As(err, &replErr)).To(BeTrue())
+			Expect(replErr.Acked).To(Equal(2))
+			Expect(replErr.Required).To(Equal(3))
+
+			cmds, err := replicated.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, "key1", "value", 0)
+				pipe.Get(ctx, "key1")
+				return nil
+			})
+			Expect(errors.As(err, &replErr)).To(BeTrue())
+			Expect(errors.As(cmds[0].Err(), &replErr)).To(BeTrue())
+			Expect(cmds[1].Err()).NotTo(HaveOccurred())
+		})
+	})
+
 	Describe("pipeline", func() {
 		It("doesn't panic closed ring, returns error", func() {
 			pipe := ring.Pipeline()
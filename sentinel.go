@@ -41,10 +41,38 @@ type FailoverOptions struct {
 	// Allows routing read-only commands to the random master or replica node.
 	// This option only works with NewFailoverClusterClient.
 	RouteRandomly bool
+	// Picks the node that serves read-only commands among the master and
+	// replica nodes.
+	// This option only works with NewFailoverClusterClient.
+	ReadRouter ReadRouter
+	// Optional function that returns the zone of the node with the given
+	// address. The zone is passed to ReadRouter.
+	NodeZone func(addr string) string
 
 	// Route all commands to replica read-only nodes.
 	ReplicaOnly bool
 
+	// Optional function that translates master, replica and sentinel
+	// addresses reported by sentinels into the addresses used to dial them.
+	// It should return unknown addresses unchanged. Errors, logs and events
+	// keep reporting the original addresses.
+	AddressMapper func(addr string) string
+
+	// Optional hook that is called for the Sentinel events of the master and
+	// its replicas, for example +sdown, +odown or +switch-master. Events are
+	// delivered once the client connects to a sentinel.
+	OnSentinelEvent func(ctx context.Context, event *SentinelEvent)
+
+	// Maximum replication lag of replicas that serve read-only commands.
+	// The lag is read from the INFO replication output of the master.
+	// Zero disables the check.
+	// This option only works with NewFailoverRWClient.
+	MaxReplicaLag time.Duration
+	// Frequency of refreshing the replica set and the replica lags.
+	// Default is 10 seconds.
+	// This option only works with NewFailoverRWClient.
+	ReplicaCheckFrequency time.Duration
+
 	// Use replicas disconnected with master when cannot get connected replicas
 	// Now, this option only works in RandomReplicaAddr function.
 	UseDisconnectedReplicas bool
@@ -123,7 +151,7 @@ func (opt *FailoverOptions) clientOptions() *Options {
 }
 
 func (opt *FailoverOptions) sentinelOptions(addr string) *Options {
-	return &Options{
+	sentinelOpt := &Options{
 		Addr:       addr,
 		ClientName: opt.ClientName,
 
@@ -157,6 +185,17 @@ func (opt *FailoverOptions) sentinelOptions(addr string) *Options {
 		DisableIndentity: opt.DisableIndentity,
 		IdentitySuffix:   opt.IdentitySuffix,
 	}
+	if opt.AddressMapper != nil {
+		sentinelOpt.Dialer = addrMapperDialer(sentinelOpt, opt.AddressMapper)
+	}
+	return sentinelOpt
+}
+
+func (opt *FailoverOptions) mapAddr(addr string) string {
+	if opt.AddressMapper == nil {
+		return addr
+	}
+	return opt.AddressMapper(addr)
 }
 
 func (opt *FailoverOptions) clusterOptions() *ClusterOptions {
@@ -174,6 +213,9 @@ func (opt *FailoverOptions) clusterOptions() *ClusterOptions {
 
 		RouteByLatency: opt.RouteByLatency,
 		RouteRandomly:  opt.RouteRandomly,
+		ReadRouter:     opt.ReadRouter,
+		NodeZone:       opt.NodeZone,
+		AddressMapper:  opt.AddressMapper,
 
 		MinRetryBackoff: opt.MinRetryBackoff,
 		MaxRetryBackoff: opt.MaxRetryBackoff,
@@ -209,6 +251,9 @@ func NewFailoverClient(failoverOpt *FailoverOptions) *Client {
 	if failoverOpt.RouteRandomly {
 		panic("to route commands randomly, use NewFailoverClusterClient")
 	}
+	if failoverOpt.ReadRouter != nil {
+		panic("to route commands with ReadRouter, use NewFailoverClusterClient")
+	}
 
 	sentinelAddrs := make([]string, len(failoverOpt.SentinelAddrs))
 	copy(sentinelAddrs, failoverOpt.SentinelAddrs)
@@ -222,6 +267,12 @@ func NewFailoverClient(failoverOpt *FailoverOptions) *Client {
 		sentinelAddrs: sentinelAddrs,
 	}
 
+	return newFailoverClient(failover)
+}
+
+func newFailoverClient(failover *sentinelFailover) *Client {
+	failoverOpt := failover.opt
+
 	opt := failoverOpt.clientOptions()
 	opt.Dialer = masterReplicaDialer(failover)
 	opt.init()
@@ -241,6 +292,7 @@ func NewFailoverClient(failoverOpt *FailoverOptions) *Client {
 
 	failover.mu.Lock()
 	failover.onFailover = func(ctx context.Context, addr string) {
+		addr = failoverOpt.mapAddr(addr)
 		_ = connPool.Filter(func(cn *pool.Conn) bool {
 			return cn.RemoteAddr().String() != addr
 		})
@@ -268,6 +320,7 @@ func masterReplicaDialer(
 		if err != nil {
 			return nil, err
 		}
+		addr = failover.opt.mapAddr(addr)
 		if failover.opt.Dialer != nil {
 			return failover.opt.Dialer(ctx, network, addr)
 		}
@@ -457,6 +510,7 @@ type sentinelFailover struct {
 
 	onFailover func(ctx context.Context, addr string)
 	onUpdate   func(ctx context.Context)
+	onEvent    func(ctx context.Context, event *SentinelEvent)
 
 	mu          sync.RWMutex
 	_masterAddr string
@@ -717,7 +771,15 @@ func (c *sentinelFailover) setSentinel(ctx context.Context, sentinel *SentinelCl
 	c.sentinel = sentinel
 	c.discoverSentinels(ctx)
 
-	c.pubsub = sentinel.Subscribe(ctx, "+switch-master", "+replica-reconf-done")
+	channels := []string{"+switch-master", "+replica-reconf-done"}
+	if c.opt.OnSentinelEvent != nil || c.onEvent != nil {
+		for _, channel := range sentinelEventChannels {
+			if !contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	c.pubsub = sentinel.Subscribe(ctx, channels...)
 	go c.listen(c.pubsub)
 }
 
@@ -766,12 +828,34 @@ func (c *sentinelFailover) listen(pubsub *PubSub) {
 			c.trySwitchMaster(pubsub.getContext(), addr)
 		}
 
+		if (c.opt.OnSentinelEvent != nil || c.onEvent != nil) &&
+			contains(sentinelEventChannels, msg.Channel) {
+			c.notifyEvent(ctx, msg)
+		}
+
 		if c.onUpdate != nil {
 			c.onUpdate(ctx)
 		}
 	}
 }
 
+func (c *sentinelFailover) notifyEvent(ctx context.Context, msg *Message) {
+	event, err := ParseSentinelEvent(msg.Channel, msg.Payload)
+	if err != nil {
+		internal.Logger.Printf(ctx, "sentinel: %s", err)
+		return
+	}
+	if !event.forMaster(c.opt.MasterName) {
+		return
+	}
+	if c.onEvent != nil {
+		c.onEvent(ctx, event)
+	}
+	if c.opt.OnSentinelEvent != nil {
+		c.opt.OnSentinelEvent(ctx, event)
+	}
+}
+
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
 		if s == str {
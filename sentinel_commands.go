@@ -0,0 +1,711 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal/proto"
+)
+
+// MasterInfo shows the state and info of the specified master.
+// It is like Master, but parses the reply.
+func (c *SentinelClient) MasterInfo(ctx context.Context, name string) *SentinelMasterCmd {
+	cmd := NewSentinelMasterCmd(ctx, "sentinel", "master", name)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// MastersInfo shows a list of monitored masters and their state.
+// It is like Masters, but parses the reply.
+func (c *SentinelClient) MastersInfo(ctx context.Context) *SentinelMastersCmd {
+	cmd := NewSentinelMastersCmd(ctx, "sentinel", "masters")
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// ReplicasInfo shows a list of replicas for the specified master and their state.
+// It is like Replicas, but parses the reply.
+func (c *SentinelClient) ReplicasInfo(ctx context.Context, name string) *SentinelReplicasCmd {
+	cmd := NewSentinelReplicasCmd(ctx, "sentinel", "replicas", name)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// InfoCache returns the cached INFO output of the specified masters and
+// their replicas, or of all masters if none are given.
+func (c *SentinelClient) InfoCache(ctx context.Context, masters ...string) *SentinelInfoCacheCmd {
+	args := make([]interface{}, 2, 2+len(masters))
+	args[0] = "sentinel"
+	args[1] = "info-cache"
+	for _, master := range masters {
+		args = append(args, master)
+	}
+	cmd := NewSentinelInfoCacheCmd(ctx, args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// ConfigGet returns the Sentinel global configuration parameters
+// that match the glob-style pattern.
+func (c *SentinelClient) ConfigGet(ctx context.Context, pattern string) *MapStringStringCmd {
+	cmd := NewMapStringStringCmd(ctx, "sentinel", "config", "get", pattern)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// ConfigSet sets the value of a Sentinel global configuration parameter.
+func (c *SentinelClient) ConfigSet(ctx context.Context, parameter, value string) *StatusCmd {
+	cmd := NewStatusCmd(ctx, "sentinel", "config", "set", parameter, value)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// Debug returns the Sentinel timing parameters, for example INFO-PERIOD,
+// in milliseconds.
+func (c *SentinelClient) Debug(ctx context.Context) *MapStringIntCmd {
+	cmd := NewMapStringIntCmd(ctx, "sentinel", "debug")
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// DebugSet changes the Sentinel timing parameters. It should only
+// be used for testing.
+func (c *SentinelClient) DebugSet(ctx context.Context, params map[string]int64) *StatusCmd {
+	args := make([]interface{}, 2, 2+2*len(params))
+	args[0] = "sentinel"
+	args[1] = "debug"
+	for param, value := range params {
+		args = append(args, param, value)
+	}
+	cmd := NewStatusCmd(ctx, args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// IsMasterDownByAddr asks the Sentinel whether the master at the given
+// address is down. When runID is not "*", the Sentinel also votes for
+// the Sentinel with the given run id as the failover leader in the epoch.
+func (c *SentinelClient) IsMasterDownByAddr(
+	ctx context.Context, ip, port string, currentEpoch int64, runID string,
+) *SentinelMasterDownCmd {
+	cmd := NewSentinelMasterDownCmd(ctx, "sentinel", "is-master-down-by-addr", ip, port, currentEpoch, runID)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// MyID returns the ID of the Sentinel instance.
+func (c *SentinelClient) MyID(ctx context.Context) *StringCmd {
+	cmd := NewStringCmd(ctx, "sentinel", "myid")
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// SimulateFailure makes the Sentinel crash at the given points of a failover,
+// for example "crash-after-election" or "crash-after-promotion".
+// It should only be used for testing.
+func (c *SentinelClient) SimulateFailure(ctx context.Context, modes ...string) *StatusCmd {
+	args := make([]interface{}, 2, 2+len(modes))
+	args[0] = "sentinel"
+	args[1] = "simulate-failure"
+	for _, mode := range modes {
+		args = append(args, mode)
+	}
+	cmd := NewStatusCmd(ctx, args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+// PendingScripts returns the notification and reconfiguration scripts
+// that are running or scheduled to run.
+func (c *SentinelClient) PendingScripts(ctx context.Context) *SentinelPendingScriptsCmd {
+	cmd := NewSentinelPendingScriptsCmd(ctx, "sentinel", "pending-scripts")
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
+// SentinelInstance describes the state of an instance monitored by Sentinel.
+type SentinelInstance struct {
+	Name  string
+	IP    string
+	Port  string
+	RunID string
+	// Flags are the instance flags, for example "master", "s_down" or "disconnected".
+	Flags []string
+
+	LinkPendingCommands int64
+	LinkRefcount        int64
+	LastPingSent        time.Duration
+	LastOKPingReply     time.Duration
+	LastPingReply       time.Duration
+	DownAfter           time.Duration
+	InfoRefresh         time.Duration
+	// SDownTime is set when the instance is subjectively down.
+	SDownTime time.Duration
+	// ODownTime is set when the master is objectively down.
+	ODownTime time.Duration
+
+	RoleReported     string
+	RoleReportedTime time.Duration
+}
+
+// Addr returns the host:port address of the instance.
+func (i *SentinelInstance) Addr() string {
+	return net.JoinHostPort(i.IP, i.Port)
+}
+
+// HasFlag reports whether the instance has the given flag.
+func (i *SentinelInstance) HasFlag(flag string) bool {
+	for _, f := range i.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *SentinelInstance) setField(key, value string) (err error) {
+	switch key {
+	case "name":
+		i.Name = value
+	case "ip":
+		i.IP = value
+	case "port":
+		i.Port = value
+	case "runid":
+		i.RunID = value
+	case "flags":
+		i.Flags = strings.Split(value, ",")
+	case "link-pending-commands":
+		i.LinkPendingCommands, err = strconv.ParseInt(value, 10, 64)
+	case "link-refcount":
+		i.LinkRefcount, err = strconv.ParseInt(value, 10, 64)
+	case "last-ping-sent":
+		i.LastPingSent, err = parseSentinelMillis(value)
+	case "last-ok-ping-reply":
+		i.LastOKPingReply, err = parseSentinelMillis(value)
+	case "last-ping-reply":
+		i.LastPingReply, err = parseSentinelMillis(value)
+	case "down-after-milliseconds":
+		i.DownAfter, err = parseSentinelMillis(value)
+	case "info-refresh":
+		i.InfoRefresh, err = parseSentinelMillis(value)
+	case "s-down-time":
+		i.SDownTime, err = parseSentinelMillis(value)
+	case "o-down-time":
+		i.ODownTime, err = parseSentinelMillis(value)
+	case "role-reported":
+		i.RoleReported = value
+	case "role-reported-time":
+		i.RoleReportedTime, err = parseSentinelMillis(value)
+	}
+	return err
+}
+
+// SentinelMaster describes the state of a master monitored by Sentinel.
+type SentinelMaster struct {
+	SentinelInstance
+
+	ConfigEpoch       int64
+	NumReplicas       int64
+	NumOtherSentinels int64
+	Quorum            int64
+	FailoverTimeout   time.Duration
+	ParallelSyncs     int64
+}
+
+func (m *SentinelMaster) setField(key, value string) (err error) {
+	switch key {
+	case "config-epoch":
+		m.ConfigEpoch, err = strconv.ParseInt(value, 10, 64)
+	case "num-slaves":
+		m.NumReplicas, err = strconv.ParseInt(value, 10, 64)
+	case "num-other-sentinels":
+		m.NumOtherSentinels, err = strconv.ParseInt(value, 10, 64)
+	case "quorum":
+		m.Quorum, err = strconv.ParseInt(value, 10, 64)
+	case "failover-timeout":
+		m.FailoverTimeout, err = parseSentinelMillis(value)
+	case "parallel-syncs":
+		m.ParallelSyncs, err = strconv.ParseInt(value, 10, 64)
+	default:
+		err = m.SentinelInstance.setField(key, value)
+	}
+	return err
+}
+
+// SentinelReplica describes the state of a replica monitored by Sentinel.
+type SentinelReplica struct {
+	SentinelInstance
+
+	// MasterLinkDownTime is the time since the link to the master went down.
+	MasterLinkDownTime time.Duration
+	// MasterLinkStatus is "ok" or "err".
+	MasterLinkStatus string
+	MasterHost       string
+	MasterPort       string
+	ReplicaPriority  int64
+	ReplOffset       int64
+	ReplicaAnnounced bool
+}
+
+func (r *SentinelReplica) setField(key, value string) (err error) {
+	switch key {
+	case "master-link-down-time":
+		r.MasterLinkDownTime, err = parseSentinelMillis(value)
+	case "master-link-status":
+		r.MasterLinkStatus = value
+	case "master-host":
+		r.MasterHost = value
+	case "master-port":
+		r.MasterPort = value
+	case "slave-priority":
+		r.ReplicaPriority, err = strconv.ParseInt(value, 10, 64)
+	case "slave-repl-offset":
+		r.ReplOffset, err = strconv.ParseInt(value, 10, 64)
+	case "replica-announced":
+		r.ReplicaAnnounced = value == "1"
+	default:
+		err = r.SentinelInstance.setField(key, value)
+	}
+	return err
+}
+
+func parseSentinelMillis(s string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// readSentinelFields reads a map reply and passes each field to fn.
+func readSentinelFields(rd *proto.Reader, fn func(key, value string) error) error {
+	n, err := rd.ReadMapLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		key, err := rd.ReadString()
+		if err != nil {
+			return err
+		}
+		value, err := rd.ReadString()
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return fmt.Errorf("redis: can't parse sentinel field %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type SentinelMasterCmd struct {
+	baseCmd
+
+	val SentinelMaster
+}
+
+var _ Cmder = (*SentinelMasterCmd)(nil)
+
+func NewSentinelMasterCmd(ctx context.Context, args ...interface{}) *SentinelMasterCmd {
+	return &SentinelMasterCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelMasterCmd) SetVal(val SentinelMaster) {
+	cmd.val = val
+}
+
+func (cmd *SentinelMasterCmd) Val() SentinelMaster {
+	return cmd.val
+}
+
+func (cmd *SentinelMasterCmd) Result() (SentinelMaster, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelMasterCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelMasterCmd) readReply(rd *proto.Reader) error {
+	cmd.val = SentinelMaster{}
+	return readSentinelFields(rd, cmd.val.setField)
+}
+
+//------------------------------------------------------------------------------
+
+type SentinelMastersCmd struct {
+	baseCmd
+
+	val []SentinelMaster
+}
+
+var _ Cmder = (*SentinelMastersCmd)(nil)
+
+func NewSentinelMastersCmd(ctx context.Context, args ...interface{}) *SentinelMastersCmd {
+	return &SentinelMastersCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelMastersCmd) SetVal(val []SentinelMaster) {
+	cmd.val = val
+}
+
+func (cmd *SentinelMastersCmd) Val() []SentinelMaster {
+	return cmd.val
+}
+
+func (cmd *SentinelMastersCmd) Result() ([]SentinelMaster, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelMastersCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelMastersCmd) readReply(rd *proto.Reader) error {
+	n, err := rd.ReadArrayLen()
+	if err != nil {
+		return err
+	}
+	cmd.val = make([]SentinelMaster, n)
+	for i := 0; i < n; i++ {
+		if err := readSentinelFields(rd, cmd.val[i].setField); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type SentinelReplicasCmd struct {
+	baseCmd
+
+	val []SentinelReplica
+}
+
+var _ Cmder = (*SentinelReplicasCmd)(nil)
+
+func NewSentinelReplicasCmd(ctx context.Context, args ...interface{}) *SentinelReplicasCmd {
+	return &SentinelReplicasCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelReplicasCmd) SetVal(val []SentinelReplica) {
+	cmd.val = val
+}
+
+func (cmd *SentinelReplicasCmd) Val() []SentinelReplica {
+	return cmd.val
+}
+
+func (cmd *SentinelReplicasCmd) Result() ([]SentinelReplica, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelReplicasCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelReplicasCmd) readReply(rd *proto.Reader) error {
+	n, err := rd.ReadArrayLen()
+	if err != nil {
+		return err
+	}
+	cmd.val = make([]SentinelReplica, n)
+	for i := 0; i < n; i++ {
+		if err := readSentinelFields(rd, cmd.val[i].setField); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// SentinelCachedInfo is the INFO output of an instance cached by Sentinel.
+type SentinelCachedInfo struct {
+	// Age is the time since the INFO output was received.
+	Age time.Duration
+	// Info is empty when Sentinel has not received INFO from the instance yet.
+	Info string
+}
+
+type SentinelInfoCacheCmd struct {
+	baseCmd
+
+	val map[string][]SentinelCachedInfo
+}
+
+var _ Cmder = (*SentinelInfoCacheCmd)(nil)
+
+func NewSentinelInfoCacheCmd(ctx context.Context, args ...interface{}) *SentinelInfoCacheCmd {
+	return &SentinelInfoCacheCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelInfoCacheCmd) SetVal(val map[string][]SentinelCachedInfo) {
+	cmd.val = val
+}
+
+// Val returns the cached INFO output by master name. The first entry
+// is the master and the rest are its replicas.
+func (cmd *SentinelInfoCacheCmd) Val() map[string][]SentinelCachedInfo {
+	return cmd.val
+}
+
+func (cmd *SentinelInfoCacheCmd) Result() (map[string][]SentinelCachedInfo, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelInfoCacheCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelInfoCacheCmd) readReply(rd *proto.Reader) error {
+	n, err := rd.ReadArrayLen()
+	if err != nil {
+		return err
+	}
+	if n%2 != 0 {
+		return fmt.Errorf("redis: got %d elements in SENTINEL INFO-CACHE reply, wanted an even number", n)
+	}
+
+	cmd.val = make(map[string][]SentinelCachedInfo, n/2)
+	for i := 0; i < n/2; i++ {
+		name, err := rd.ReadString()
+		if err != nil {
+			return err
+		}
+
+		nn, err := rd.ReadArrayLen()
+		if err != nil {
+			return err
+		}
+		infos := make([]SentinelCachedInfo, nn)
+		for j := 0; j < nn; j++ {
+			if err := rd.ReadFixedArrayLen(2); err != nil {
+				return err
+			}
+			age, err := rd.ReadInt()
+			if err != nil {
+				return err
+			}
+			info, err := rd.ReadString()
+			if err != nil && err != Nil {
+				return err
+			}
+			infos[j] = SentinelCachedInfo{
+				Age:  time.Duration(age) * time.Millisecond,
+				Info: info,
+			}
+		}
+		cmd.val[name] = infos
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// SentinelMasterDown is the reply of SENTINEL IS-MASTER-DOWN-BY-ADDR.
+type SentinelMasterDown struct {
+	// Down reports whether the Sentinel considers the master down.
+	Down bool
+	// Leader is the run id of the Sentinel voted as the failover leader,
+	// or "*" when the Sentinel did not vote.
+	Leader      string
+	LeaderEpoch int64
+}
+
+type SentinelMasterDownCmd struct {
+	baseCmd
+
+	val SentinelMasterDown
+}
+
+var _ Cmder = (*SentinelMasterDownCmd)(nil)
+
+func NewSentinelMasterDownCmd(ctx context.Context, args ...interface{}) *SentinelMasterDownCmd {
+	return &SentinelMasterDownCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelMasterDownCmd) SetVal(val SentinelMasterDown) {
+	cmd.val = val
+}
+
+func (cmd *SentinelMasterDownCmd) Val() SentinelMasterDown {
+	return cmd.val
+}
+
+func (cmd *SentinelMasterDownCmd) Result() (SentinelMasterDown, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelMasterDownCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelMasterDownCmd) readReply(rd *proto.Reader) error {
+	if err := rd.ReadFixedArrayLen(3); err != nil {
+		return err
+	}
+	down, err := rd.ReadInt()
+	if err != nil {
+		return err
+	}
+	leader, err := rd.ReadString()
+	if err != nil {
+		return err
+	}
+	epoch, err := rd.ReadInt()
+	if err != nil {
+		return err
+	}
+	cmd.val = SentinelMasterDown{
+		Down:        down == 1,
+		Leader:      leader,
+		LeaderEpoch: epoch,
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// SentinelPendingScript is a notification or reconfiguration script
+// that is running or scheduled to run.
+type SentinelPendingScript struct {
+	Argv []string
+	// Flags is "running" or "scheduled".
+	Flags string
+	// PID is zero for scheduled scripts.
+	PID int64
+	// RunTime is set for running scripts.
+	RunTime time.Duration
+	// RunDelay is set for scheduled scripts.
+	RunDelay time.Duration
+	RetryNum int64
+}
+
+type SentinelPendingScriptsCmd struct {
+	baseCmd
+
+	val []SentinelPendingScript
+}
+
+var _ Cmder = (*SentinelPendingScriptsCmd)(nil)
+
+func NewSentinelPendingScriptsCmd(ctx context.Context, args ...interface{}) *SentinelPendingScriptsCmd {
+	return &SentinelPendingScriptsCmd{
+		baseCmd: baseCmd{
+			ctx:  ctx,
+			args: args,
+		},
+	}
+}
+
+func (cmd *SentinelPendingScriptsCmd) SetVal(val []SentinelPendingScript) {
+	cmd.val = val
+}
+
+func (cmd *SentinelPendingScriptsCmd) Val() []SentinelPendingScript {
+	return cmd.val
+}
+
+func (cmd *SentinelPendingScriptsCmd) Result() ([]SentinelPendingScript, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SentinelPendingScriptsCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SentinelPendingScriptsCmd) readReply(rd *proto.Reader) error {
+	n, err := rd.ReadArrayLen()
+	if err != nil {
+		return err
+	}
+
+	cmd.val = make([]SentinelPendingScript, n)
+	for i := 0; i < n; i++ {
+		nn, err := rd.ReadMapLen()
+		if err != nil {
+			return err
+		}
+
+		script := &cmd.val[i]
+		for j := 0; j < nn; j++ {
+			key, err := rd.ReadString()
+			if err != nil {
+				return err
+			}
+
+			switch key {
+			case "argv":
+				var argc int
+				argc, err = rd.ReadArrayLen()
+				if err != nil {
+					return err
+				}
+				script.Argv = make([]string, argc)
+				for k := 0; k < argc; k++ {
+					if script.Argv[k], err = rd.ReadString(); err != nil {
+						return err
+					}
+				}
+			case "flags":
+				script.Flags, err = rd.ReadString()
+			case "pid":
+				script.PID, err = rd.ReadInt()
+			case "run-time":
+				var ms int64
+				ms, err = rd.ReadInt()
+				script.RunTime = time.Duration(ms) * time.Millisecond
+			case "run-delay":
+				var ms int64
+				ms, err = rd.ReadInt()
+				script.RunDelay = time.Duration(ms) * time.Millisecond
+			case "retry-num":
+				script.RetryNum, err = rd.ReadInt()
+			default:
+				err = rd.DiscardNext()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9/internal"
+)
+
+// Sentinel event channels that can be passed to SentinelClient.SubscribeEvents.
+const (
+	SentinelEventSDown        = "+sdown"
+	SentinelEventSDownCleared = "-sdown"
+	SentinelEventODown        = "+odown"
+	SentinelEventODownCleared = "-odown"
+	SentinelEventSwitchMaster = "+switch-master"
+	SentinelEventReplica      = "+slave"
+	SentinelEventTilt         = "+tilt"
+	SentinelEventTiltCleared  = "-tilt"
+
+	SentinelEventFailoverStateSelectReplica  = "+failover-state-select-slave"
+	SentinelEventFailoverStateSendReplicaOf  = "+failover-state-send-slaveof-noone"
+	SentinelEventFailoverStateWaitPromotion  = "+failover-state-wait-promotion"
+	SentinelEventFailoverStateReconfReplicas = "+failover-state-reconf-slaves"
+)
+
+var sentinelEventChannels = []string{
+	SentinelEventSDown,
+	SentinelEventSDownCleared,
+	SentinelEventODown,
+	SentinelEventODownCleared,
+	SentinelEventSwitchMaster,
+	SentinelEventReplica,
+	SentinelEventTilt,
+	SentinelEventTiltCleared,
+	SentinelEventFailoverStateSelectReplica,
+	SentinelEventFailoverStateSendReplicaOf,
+	SentinelEventFailoverStateWaitPromotion,
+	SentinelEventFailoverStateReconfReplicas,
+}
+
+// SentinelEvent is an event published by Redis Sentinel, for example
+// a master that is subjectively down or a completed failover.
+type SentinelEvent struct {
+	// Channel is the event name, for example "+sdown".
+	Channel string
+	// Payload is the unparsed event payload.
+	Payload string
+
+	// InstanceType is "master", "slave" or "sentinel".
+	// It is empty for events that do not describe an instance.
+	InstanceType string
+	// Name is the instance name. For masters it is the master name.
+	Name string
+	IP   string
+	Port string
+
+	// MasterName, MasterIP and MasterPort describe the master monitored
+	// by the instance. For masters they repeat the instance fields.
+	MasterName string
+	MasterIP   string
+	MasterPort string
+
+	// OldIP and OldPort are set for +switch-master and contain
+	// the address of the previous master.
+	OldIP   string
+	OldPort string
+
+	// Extra is the text after the instance description, for example
+	// "#quorum 2/2" for +odown or "#tilt mode entered" for +tilt.
+	Extra string
+}
+
+// Addr returns the host:port address of the instance.
+func (e *SentinelEvent) Addr() string {
+	if e.IP == "" {
+		return ""
+	}
+	return net.JoinHostPort(e.IP, e.Port)
+}
+
+// MasterAddr returns the host:port address of the master.
+func (e *SentinelEvent) MasterAddr() string {
+	if e.MasterIP == "" {
+		return ""
+	}
+	return net.JoinHostPort(e.MasterIP, e.MasterPort)
+}
+
+// forMaster reports whether the event describes the master with
+// the given name or one of its replicas. Events that don't describe
+// an instance, like +tilt, are reported for every master.
+func (e *SentinelEvent) forMaster(name string) bool {
+	return e.InstanceType == "" || e.Name == name || e.MasterName == name
+}
+
+func (e *SentinelEvent) String() string {
+	return fmt.Sprintf("SentinelEvent<%s: %s>", e.Channel, e.Payload)
+}
+
+// ParseSentinelEvent parses the payload of a message received
+// on a Sentinel event channel.
+func ParseSentinelEvent(channel, payload string) (*SentinelEvent, error) {
+	event := &SentinelEvent{
+		Channel: channel,
+		Payload: payload,
+	}
+
+	if strings.HasPrefix(payload, "#") {
+		event.Extra = payload
+		return event, nil
+	}
+
+	fields := strings.Fields(payload)
+
+	if channel == SentinelEventSwitchMaster {
+		// <master name> <old ip> <old port> <new ip> <new port>
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("redis: can't parse sentinel event %s %q", channel, payload)
+		}
+		event.InstanceType = "master"
+		event.Name = fields[0]
+		event.OldIP, event.OldPort = fields[1], fields[2]
+		event.IP, event.Port = fields[3], fields[4]
+		event.MasterName, event.MasterIP, event.MasterPort = event.Name, event.IP, event.Port
+		return event, nil
+	}
+
+	// <instance type> <name> <ip> <port> [@ <master name> <master ip> <master port>] [extra]
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("redis: can't parse sentinel event %s %q", channel, payload)
+	}
+	event.InstanceType = fields[0]
+	event.Name = fields[1]
+	event.IP, event.Port = fields[2], fields[3]
+	fields = fields[4:]
+
+	if len(fields) > 0 && fields[0] == "@" {
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("redis: can't parse sentinel event %s %q", channel, payload)
+		}
+		event.MasterName = fields[1]
+		event.MasterIP, event.MasterPort = fields[2], fields[3]
+		fields = fields[4:]
+	} else {
+		event.MasterName, event.MasterIP, event.MasterPort = event.Name, event.IP, event.Port
+	}
+
+	event.Extra = strings.Join(fields, " ")
+	return event, nil
+}
+
+//------------------------------------------------------------------------------
+
+// SentinelEvents delivers typed events received from a Sentinel.
+type SentinelEvents struct {
+	pubsub *PubSub
+
+	chOnce sync.Once
+	ch     chan *SentinelEvent
+}
+
+// SubscribeEvents subscribes to the given Sentinel event channels,
+// or to all supported event channels if none are given.
+func (c *SentinelClient) SubscribeEvents(ctx context.Context, channels ...string) *SentinelEvents {
+	if len(channels) == 0 {
+		channels = sentinelEventChannels
+	}
+	return &SentinelEvents{
+		pubsub: c.Subscribe(ctx, channels...),
+	}
+}
+
+// Channel returns a Go channel for concurrently receiving events.
+// The channel is closed together with the SentinelEvents.
+// Events that can't be parsed are logged and dropped.
+func (e *SentinelEvents) Channel(opts ...ChannelOption) <-chan *SentinelEvent {
+	e.chOnce.Do(func() {
+		msgCh := e.pubsub.Channel(opts...)
+		e.ch = make(chan *SentinelEvent, cap(msgCh))
+
+		go func() {
+			defer close(e.ch)
+			for msg := range msgCh {
+				event, err := ParseSentinelEvent(msg.Channel, msg.Payload)
+				if err != nil {
+					internal.Logger.Printf(context.TODO(), "sentinel: %s", err)
+					continue
+				}
+				select {
+				case e.ch <- event:
+				case <-e.pubsub.exit:
+					return
+				}
+			}
+		}()
+	})
+	return e.ch
+}
+
+// Close unsubscribes from the events and closes the channel.
+func (e *SentinelEvents) Close() error {
+	return e.pubsub.Close()
+}
@@ -0,0 +1,486 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal"
+	"github.com/redis/go-redis/v9/internal/pool"
+	"github.com/redis/go-redis/v9/internal/rand"
+)
+
+// FailoverRWClient is a Redis client that uses Redis Sentinel to send
+// write commands to the master and read-only commands to healthy replicas.
+// It's safe for concurrent use by multiple goroutines.
+//
+// The replica set is refreshed from Sentinel periodically and on
+// +slave, +sdown, -sdown and +switch-master events. Read-only commands
+// are sent to the master when there are no healthy replicas.
+type FailoverRWClient struct {
+	cmdable
+	hooksMixin
+
+	opt           *FailoverOptions
+	failover      *sentinelFailover
+	master        *Client
+	replicas      *failoverReplicas
+	cmdsInfoCache *cmdsInfoCache
+
+	refreshCh chan struct{}
+	cancel    context.CancelFunc
+}
+
+var _ UniversalClient = (*FailoverRWClient)(nil)
+
+// NewFailoverRWClient returns a Redis client that uses Redis Sentinel for
+// automatic failover and routes read-only commands to replicas.
+func NewFailoverRWClient(failoverOpt *FailoverOptions) *FailoverRWClient {
+	if failoverOpt.ReplicaOnly {
+		panic("ReplicaOnly can't be used with NewFailoverRWClient")
+	}
+	if failoverOpt.RouteByLatency {
+		panic("to route commands by latency, use NewFailoverClusterClient")
+	}
+	if failoverOpt.RouteRandomly {
+		panic("to route commands randomly, use NewFailoverClusterClient")
+	}
+	if failoverOpt.ReadRouter != nil {
+		panic("to route commands with ReadRouter, use NewFailoverClusterClient")
+	}
+
+	sentinelAddrs := make([]string, len(failoverOpt.SentinelAddrs))
+	copy(sentinelAddrs, failoverOpt.SentinelAddrs)
+
+	rand.Shuffle(len(sentinelAddrs), func(i, j int) {
+		sentinelAddrs[i], sentinelAddrs[j] = sentinelAddrs[j], sentinelAddrs[i]
+	})
+
+	failover := &sentinelFailover{
+		opt:           failoverOpt,
+		sentinelAddrs: sentinelAddrs,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &FailoverRWClient{
+		opt:      failoverOpt,
+		failover: failover,
+		replicas: &failoverReplicas{
+			opt:     failoverOpt,
+			clients: make(map[string]*Client),
+		},
+
+		refreshCh: make(chan struct{}, 1),
+		cancel:    cancel,
+	}
+	// The callback is set before the master client can dial and start
+	// listening to the sentinel, which reads it without a lock.
+	failover.onEvent = c.onSentinelEvent
+	c.master = newFailoverClient(failover)
+	c.cmdsInfoCache = newCmdsInfoCache(c.cmdsInfo)
+	c.cmdable = c.Process
+
+	c.initHooks(hooks{
+		process:    c.process,
+		pipeline:   c.processPipeline,
+		txPipeline: c.master.processTxPipelineHook,
+	})
+
+	frequency := failoverOpt.ReplicaCheckFrequency
+	if frequency <= 0 {
+		frequency = 10 * time.Second
+	}
+	go c.checkReplicas(ctx, frequency)
+
+	return c
+}
+
+// Do create a Cmd from the args and processes the cmd.
+func (c *FailoverRWClient) Do(ctx context.Context, args ...interface{}) *Cmd {
+	cmd := NewCmd(ctx, args...)
+	_ = c.Process(ctx, cmd)
+	return cmd
+}
+
+func (c *FailoverRWClient) Process(ctx context.Context, cmd Cmder) error {
+	err := c.processHook(ctx, cmd)
+	cmd.SetErr(err)
+	return err
+}
+
+// Options returns read-only Options that were used to create the client.
+func (c *FailoverRWClient) Options() *FailoverOptions {
+	return c.opt
+}
+
+// Master returns the client that serves write commands.
+func (c *FailoverRWClient) Master() *Client {
+	return c.master
+}
+
+// ReplicaAddrs returns the addresses of the replicas that currently
+// serve read-only commands.
+func (c *FailoverRWClient) ReplicaAddrs() []string {
+	return c.replicas.Addrs()
+}
+
+// PoolStats returns accumulated connection pool stats.
+func (c *FailoverRWClient) PoolStats() *PoolStats {
+	acc := *c.master.PoolStats()
+	for _, replica := range c.replicas.List() {
+		s := replica.connPool.Stats()
+		acc.Hits += s.Hits
+		acc.Misses += s.Misses
+		acc.Timeouts += s.Timeouts
+		acc.TotalConns += s.TotalConns
+		acc.IdleConns += s.IdleConns
+		acc.StaleConns += s.StaleConns
+	}
+	return &acc
+}
+
+func (c *FailoverRWClient) Subscribe(ctx context.Context, channels ...string) *PubSub {
+	return c.master.Subscribe(ctx, channels...)
+}
+
+func (c *FailoverRWClient) PSubscribe(ctx context.Context, channels ...string) *PubSub {
+	return c.master.PSubscribe(ctx, channels...)
+}
+
+func (c *FailoverRWClient) SSubscribe(ctx context.Context, channels ...string) *PubSub {
+	return c.master.SSubscribe(ctx, channels...)
+}
+
+// Watch runs the transaction on the master.
+func (c *FailoverRWClient) Watch(ctx context.Context, fn func(*Tx) error, keys ...string) error {
+	return c.master.Watch(ctx, fn, keys...)
+}
+
+func (c *FailoverRWClient) Pipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
+	return c.Pipeline().Pipelined(ctx, fn)
+}
+
+func (c *FailoverRWClient) Pipeline() Pipeliner {
+	pipe := Pipeline{
+		exec: pipelineExecer(c.processPipelineHook),
+	}
+	pipe.init()
+	return &pipe
+}
+
+func (c *FailoverRWClient) TxPipelined(ctx context.Context, fn func(Pipeliner) error) ([]Cmder, error) {
+	return c.TxPipeline().Pipelined(ctx, fn)
+}
+
+// TxPipeline acts like Pipeline, but wraps queued commands with MULTI/EXEC.
+// Transactions are always sent to the master.
+func (c *FailoverRWClient) TxPipeline() Pipeliner {
+	pipe := Pipeline{
+		exec: func(ctx context.Context, cmds []Cmder) error {
+			cmds = wrapMultiExec(ctx, cmds)
+			return c.processTxPipelineHook(ctx, cmds)
+		},
+	}
+	pipe.init()
+	return &pipe
+}
+
+// Close closes the master and replica clients.
+func (c *FailoverRWClient) Close() error {
+	c.cancel()
+
+	firstErr := c.replicas.Close()
+	if err := c.master.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (c *FailoverRWClient) cmdsInfo(ctx context.Context) (map[string]*CommandInfo, error) {
+	return c.master.Command(ctx).Result()
+}
+
+func (c *FailoverRWClient) cmdReadOnly(ctx context.Context, cmd Cmder) bool {
+	cmdsInfo, err := c.cmdsInfoCache.Get(ctx)
+	if err != nil {
+		internal.Logger.Printf(ctx, "getting command info: %s", err)
+		return false
+	}
+	info := cmdsInfo[cmd.Name()]
+	return info != nil && info.ReadOnly
+}
+
+func (c *FailoverRWClient) process(ctx context.Context, cmd Cmder) error {
+	if c.cmdReadOnly(ctx, cmd) {
+		if replica := c.replicas.Random(); replica != nil {
+			err := replica.Process(ctx, cmd)
+			if !c.replicaFailed(replica, err, cmd.readTimeout() == nil) {
+				return err
+			}
+		}
+	}
+	return c.master.Process(ctx, cmd)
+}
+
+// processPipeline sends the read-only commands that precede the first
+// write command to a replica and the rest of the pipeline to the master,
+// so the pipeline can read its own writes.
+func (c *FailoverRWClient) processPipeline(ctx context.Context, cmds []Cmder) error {
+	var n int
+	for n < len(cmds) && c.cmdReadOnly(ctx, cmds[n]) {
+		n++
+	}
+
+	masterCmds := cmds
+	if n > 0 {
+		if replica := c.replicas.Random(); replica != nil {
+			err := replica.processPipelineHook(ctx, cmds[:n])
+			if !c.replicaFailed(replica, err, true) {
+				masterCmds = cmds[n:]
+			}
+		}
+	}
+
+	if len(masterCmds) > 0 {
+		_ = c.master.processPipelineHook(ctx, masterCmds)
+	}
+	return cmdsFirstErr(cmds)
+}
+
+// replicaFailed reports whether the command failed because of the replica
+// and should be retried on the master.
+func (c *FailoverRWClient) replicaFailed(replica *Client, err error, retryTimeout bool) bool {
+	if err == nil {
+		return false
+	}
+	if err == pool.ErrClosed || shouldRetry(err, retryTimeout) {
+		c.replicas.Remove(replica.opt.Addr)
+		c.refresh()
+		return true
+	}
+	return false
+}
+
+func (c *FailoverRWClient) onSentinelEvent(ctx context.Context, event *SentinelEvent) {
+	switch event.Channel {
+	case SentinelEventSDown:
+		if event.InstanceType == "slave" {
+			c.replicas.Remove(event.Addr())
+		}
+		c.refresh()
+	case SentinelEventSDownCleared, SentinelEventReplica, SentinelEventSwitchMaster:
+		c.refresh()
+	}
+}
+
+// refresh schedules a refresh of the replica set.
+func (c *FailoverRWClient) refresh() {
+	select {
+	case c.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *FailoverRWClient) checkReplicas(ctx context.Context, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		c.refreshReplicas(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-c.refreshCh:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *FailoverRWClient) refreshReplicas(ctx context.Context) {
+	addrs, err := c.failover.replicaAddrs(ctx, false)
+	if err != nil {
+		if ctx.Err() == nil {
+			internal.Logger.Printf(ctx, "sentinel: Replicas master=%q failed: %s", c.opt.MasterName, err)
+		}
+		return
+	}
+
+	if c.opt.MaxReplicaLag > 0 && len(addrs) > 0 {
+		info, err := c.master.Info(ctx, "replication").Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				internal.Logger.Printf(ctx, "sentinel: INFO replication master=%q failed: %s",
+					c.opt.MasterName, err)
+			}
+			return
+		}
+
+		lags := parseReplicationLags(info)
+		healthy := addrs[:0]
+		for _, addr := range addrs {
+			if lag, ok := lags[addr]; ok && lag <= c.opt.MaxReplicaLag {
+				healthy = append(healthy, addr)
+			}
+		}
+		addrs = healthy
+	}
+
+	c.replicas.SetAddrs(addrs)
+}
+
+// parseReplicationLags parses the replica lags reported by the master in
+// INFO replication, for example:
+//
+//	slave0:ip=127.0.0.1,port=6380,state=online,offset=1234,lag=0
+//
+// Replicas that are not online are omitted.
+func parseReplicationLags(info string) map[string]time.Duration {
+	lags := make(map[string]time.Duration)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "slave") {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+
+		var ip, port, state, lag string
+		for _, kv := range strings.Split(line[i+1:], ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "ip":
+				ip = v
+			case "port":
+				port = v
+			case "state":
+				state = v
+			case "lag":
+				lag = v
+			}
+		}
+		if ip == "" || port == "" || state != "online" {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(lag, 10, 64)
+		if err != nil {
+			continue
+		}
+		lags[net.JoinHostPort(ip, port)] = time.Duration(seconds) * time.Second
+	}
+	return lags
+}
+
+//------------------------------------------------------------------------------
+
+type failoverReplicas struct {
+	opt *FailoverOptions
+
+	mu      sync.RWMutex
+	clients map[string]*Client
+	healthy []string
+	closed  bool
+}
+
+func (r *failoverReplicas) replicaOptions(addr string) *Options {
+	opt := r.opt.clientOptions()
+	opt.Addr = addr
+	if r.opt.AddressMapper != nil {
+		opt.Dialer = addrMapperDialer(opt, r.opt.AddressMapper)
+	}
+	return opt
+}
+
+// SetAddrs replaces the healthy replicas and closes the clients
+// of the replicas that are gone.
+func (r *failoverReplicas) SetAddrs(addrs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	for addr, client := range r.clients {
+		if !contains(addrs, addr) {
+			delete(r.clients, addr)
+			_ = client.Close()
+		}
+	}
+	for _, addr := range addrs {
+		if _, ok := r.clients[addr]; !ok {
+			r.clients[addr] = NewClient(r.replicaOptions(addr))
+		}
+	}
+
+	r.healthy = append(r.healthy[:0:0], addrs...)
+}
+
+// Remove stops routing commands to the replica until the next refresh.
+func (r *failoverReplicas) Remove(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, healthy := range r.healthy {
+		if healthy == addr {
+			r.healthy = append(r.healthy[:i:i], r.healthy[i+1:]...)
+			return
+		}
+	}
+}
+
+// Random returns a random healthy replica or nil.
+func (r *failoverReplicas) Random() *Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.healthy) == 0 {
+		return nil
+	}
+	return r.clients[r.healthy[rand.Intn(len(r.healthy))]]
+}
+
+func (r *failoverReplicas) Addrs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string(nil), r.healthy...)
+}
+
+func (r *failoverReplicas) List() []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func (r *failoverReplicas) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	r.healthy = nil
+
+	var firstErr error
+	for addr, client := range r.clients {
+		delete(r.clients, addr)
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
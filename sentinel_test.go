@@ -3,6 +3,7 @@ package redis_test
 import (
 	"context"
 	"net"
+	"time"
 
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
@@ -140,6 +141,53 @@ var _ = Describe("Sentinel", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("delivers sentinel events", func() {
+		events := make(chan *redis.SentinelEvent, 100)
+		failoverClient := redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    sentinelName,
+			SentinelAddrs: sentinelAddrs,
+			MaxRetries:    -1,
+			OnSentinelEvent: func(ctx context.Context, event *redis.SentinelEvent) {
+				events <- event
+			},
+		})
+		defer failoverClient.Close()
+		Expect(failoverClient.Ping(ctx).Err()).NotTo(HaveOccurred())
+
+		sub := sentinel.SubscribeEvents(ctx, redis.SentinelEventSwitchMaster)
+		defer sub.Close()
+		ch := sub.Channel()
+
+		// Wait until the failover client subscribes to the events.
+		time.Sleep(time.Second)
+
+		err := sentinel.Failover(ctx, sentinelName).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		var event *redis.SentinelEvent
+		Eventually(ch, "15s").Should(Receive(&event))
+		Expect(event.Channel).To(Equal(redis.SentinelEventSwitchMaster))
+		Expect(event.Name).To(Equal(sentinelName))
+		Expect(event.OldPort).To(Equal(masterPort))
+		Expect(event.Port).NotTo(Equal(masterPort))
+
+		seen := make(map[string]bool)
+		Eventually(func() bool {
+			for {
+				select {
+				case event := <-events:
+					if event.InstanceType != "" {
+						Expect(event.MasterName).To(Equal(sentinelName))
+					}
+					seen[event.Channel] = true
+				default:
+					return seen[redis.SentinelEventFailoverStateSelectReplica] &&
+						seen[redis.SentinelEventSwitchMaster]
+				}
+			}
+		}, "15s", "100ms").Should(BeTrue())
+	})
+
 	It("supports DB selection", func() {
 		Expect(client.Close()).NotTo(HaveOccurred())
 
@@ -166,6 +214,224 @@ var _ = Describe("Sentinel", func() {
 	})
 })
 
+var _ = Describe("NewFailoverRWClient", func() {
+	var client *redis.FailoverRWClient
+	var sentinel *redis.SentinelClient
+
+	BeforeEach(func() {
+		client = redis.NewFailoverRWClient(&redis.FailoverOptions{
+			MasterName:    sentinelName,
+			SentinelAddrs: sentinelAddrs,
+			MaxReplicaLag: 10 * time.Second,
+		})
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+
+		sentinel = redis.NewSentinelClient(&redis.Options{
+			Addr:       ":" + sentinelPort1,
+			MaxRetries: -1,
+		})
+
+		Eventually(func() []string {
+			return client.ReplicaAddrs()
+		}, "15s", "100ms").Should(HaveLen(2))
+	})
+
+	AfterEach(func() {
+		_ = client.Close()
+		_ = sentinel.Close()
+	})
+
+	It("routes read-only commands to replicas", func() {
+		// Write a different value on each replica to see which one served the read.
+		for _, addr := range client.ReplicaAddrs() {
+			replica := redis.NewClient(&redis.Options{Addr: addr})
+			Expect(replica.ConfigSet(ctx, "replica-read-only", "no").Err()).NotTo(HaveOccurred())
+			Expect(replica.Set(ctx, "rw:replica", addr, 0).Err()).NotTo(HaveOccurred())
+			Expect(replica.ConfigSet(ctx, "replica-read-only", "yes").Err()).NotTo(HaveOccurred())
+			Expect(replica.Close()).NotTo(HaveOccurred())
+		}
+
+		val, err := client.Get(ctx, "rw:replica").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.ReplicaAddrs()).To(ContainElement(val))
+
+		Expect(client.Set(ctx, "rw:master", "master", 0).Err()).NotTo(HaveOccurred())
+		Eventually(func() string {
+			return client.Get(ctx, "rw:master").Val()
+		}, "15s", "100ms").Should(Equal("master"))
+	})
+
+	It("supports pipelines with mixed commands", func() {
+		cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Exists(ctx, "rw:pipe")
+			pipe.Set(ctx, "rw:pipe", "value", 0)
+			pipe.Get(ctx, "rw:pipe")
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmds).To(HaveLen(3))
+		Expect(cmds[0].(*redis.IntCmd).Val()).To(Equal(int64(0)))
+		Expect(cmds[2].(*redis.StringCmd).Val()).To(Equal("value"))
+
+		cmds, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, "rw:counter")
+			pipe.Get(ctx, "rw:counter")
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmds[1].(*redis.StringCmd).Val()).To(Equal("1"))
+	})
+
+	It("implements UniversalClient", func() {
+		var universal redis.UniversalClient = client
+		Expect(universal.Ping(ctx).Err()).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("SentinelClient commands", func() {
+	var sentinel *redis.SentinelClient
+
+	BeforeEach(func() {
+		sentinel = redis.NewSentinelClient(&redis.Options{
+			Addr:       ":" + sentinelPort1,
+			MaxRetries: -1,
+		})
+	})
+
+	AfterEach(func() {
+		_ = sentinel.Close()
+	})
+
+	It("should MASTERS and MASTER", func() {
+		masters, err := sentinel.MastersInfo(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(masters).To(HaveLen(1))
+		Expect(masters[0].Name).To(Equal(sentinelName))
+		Expect(masters[0].HasFlag("master")).To(BeTrue())
+		Expect(masters[0].Quorum).To(Equal(int64(2)))
+
+		master, err := sentinel.MasterInfo(ctx, sentinelName).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(master.Name).To(Equal(sentinelName))
+		Expect(master.DownAfter).To(BeNumerically(">", 0))
+
+		addr, err := sentinel.GetMasterAddrByName(ctx, sentinelName).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(master.Addr()).To(Equal(net.JoinHostPort(addr[0], addr[1])))
+	})
+
+	It("should REPLICAS", func() {
+		Eventually(func() int {
+			return len(sentinel.ReplicasInfo(ctx, sentinelName).Val())
+		}, "15s", "100ms").Should(Equal(2))
+
+		replicas, err := sentinel.ReplicasInfo(ctx, sentinelName).Result()
+		Expect(err).NotTo(HaveOccurred())
+		for _, replica := range replicas {
+			Expect(replica.HasFlag("slave")).To(BeTrue())
+			Expect(replica.MasterHost).NotTo(BeEmpty())
+			Expect(replica.Port).NotTo(BeEmpty())
+		}
+	})
+
+	It("should INFO-CACHE", func() {
+		Eventually(func() int {
+			return len(sentinel.InfoCache(ctx, sentinelName).Val()[sentinelName])
+		}, "15s", "100ms").Should(BeNumerically(">=", 1))
+
+		infos, err := sentinel.InfoCache(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveKey(sentinelName))
+		Expect(infos[sentinelName][0].Info).To(ContainSubstring("role:master"))
+	})
+
+	It("should CONFIG GET and CONFIG SET", func() {
+		err := sentinel.ConfigSet(ctx, "resolve-hostnames", "no").Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		config, err := sentinel.ConfigGet(ctx, "resolve-hostnames").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(HaveKeyWithValue("resolve-hostnames", "no"))
+	})
+
+	It("should DEBUG", func() {
+		params, err := sentinel.Debug(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(params).To(HaveKey("INFO-PERIOD"))
+
+		err = sentinel.DebugSet(ctx, map[string]int64{"INFO-PERIOD": params["INFO-PERIOD"]}).Err()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should IS-MASTER-DOWN-BY-ADDR", func() {
+		addr, err := sentinel.GetMasterAddrByName(ctx, sentinelName).Result()
+		Expect(err).NotTo(HaveOccurred())
+
+		reply, err := sentinel.IsMasterDownByAddr(ctx, addr[0], addr[1], 0, "*").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply.Down).To(BeFalse())
+		Expect(reply.Leader).To(Equal("*"))
+	})
+
+	It("should MYID and PENDING-SCRIPTS", func() {
+		id, err := sentinel.MyID(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(HaveLen(40))
+
+		scripts, err := sentinel.PendingScripts(ctx).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scripts).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ParseSentinelEvent", func() {
+	It("parses master events", func() {
+		event, err := redis.ParseSentinelEvent("+odown", "master mymaster 127.0.0.1 6379 #quorum 2/2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.InstanceType).To(Equal("master"))
+		Expect(event.Name).To(Equal("mymaster"))
+		Expect(event.Addr()).To(Equal("127.0.0.1:6379"))
+		Expect(event.MasterName).To(Equal("mymaster"))
+		Expect(event.MasterAddr()).To(Equal("127.0.0.1:6379"))
+		Expect(event.Extra).To(Equal("#quorum 2/2"))
+	})
+
+	It("parses replica events", func() {
+		event, err := redis.ParseSentinelEvent("+slave", "slave 127.0.0.1:6380 127.0.0.1 6380 @ mymaster 127.0.0.1 6379")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.InstanceType).To(Equal("slave"))
+		Expect(event.Name).To(Equal("127.0.0.1:6380"))
+		Expect(event.Addr()).To(Equal("127.0.0.1:6380"))
+		Expect(event.MasterName).To(Equal("mymaster"))
+		Expect(event.MasterAddr()).To(Equal("127.0.0.1:6379"))
+		Expect(event.Extra).To(BeEmpty())
+	})
+
+	It("parses +switch-master", func() {
+		event, err := redis.ParseSentinelEvent("+switch-master", "mymaster 127.0.0.1 6379 127.0.0.1 6380")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Name).To(Equal("mymaster"))
+		Expect(event.OldIP).To(Equal("127.0.0.1"))
+		Expect(event.OldPort).To(Equal("6379"))
+		Expect(event.Addr()).To(Equal("127.0.0.1:6380"))
+		Expect(event.MasterAddr()).To(Equal("127.0.0.1:6380"))
+	})
+
+	It("parses +tilt", func() {
+		event, err := redis.ParseSentinelEvent("+tilt", "#tilt mode entered")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.InstanceType).To(BeEmpty())
+		Expect(event.Extra).To(Equal("#tilt mode entered"))
+	})
+
+	It("returns an error for malformed events", func() {
+		_, err := redis.ParseSentinelEvent("+sdown", "master mymaster")
+		Expect(err).To(HaveOccurred())
+		_, err = redis.ParseSentinelEvent("+switch-master", "mymaster 127.0.0.1 6379")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
 var _ = Describe("NewFailoverClusterClient PROTO 2", func() {
 	var client *redis.ClusterClient
 
@@ -43,6 +43,7 @@ type StreamCmdable interface {
 //   - XAddArgs.Values = []interface{}{"key1", "value1", "key2", "value2"}
 //   - XAddArgs.Values = []string("key1", "value1", "key2", "value2")
 //   - XAddArgs.Values = map[string]interface{}{"key1": "value1", "key2": "value2"}
+//   - XAddArgs.Values = struct with `redis:"key1"` tags, see XMessage.Scan
 //
 // Note that map will not preserve the order of key-value pairs.
 // MaxLen/MaxLenApprox and MinID are in conflict, only one of them can be used.
@@ -133,6 +134,33 @@ func (c cmdable) XRevRangeN(ctx context.Context, stream, start, stop string, cou
 	return cmd
 }
 
+// XRangeIteratorArgs are the arguments of NewXRangeIterator.
+type XRangeIteratorArgs struct {
+	Stream string
+	// Start and End are the IDs of the range, "-" and "+" by default.
+	// A "(" prefix excludes the ID.
+	Start string
+	End   string
+	// StartTime and EndTime set Start and End to the first and the last
+	// ID of their millisecond.
+	StartTime time.Time
+	EndTime   time.Time
+	// Count is the number of entries fetched at once. Default is 100.
+	Count int64
+	// Reverse iterates from End to Start with XREVRANGE.
+	Reverse bool
+
+	// Tail makes the iterator wait for new entries with XREAD BLOCK once
+	// the end of the stream is reached, so backfill and live entries are
+	// read by one loop. It can't be used with Reverse or End.
+	Tail bool
+	// Block is how long each XREAD waits in Tail mode. Next keeps reading
+	// until an entry is added and only returns false on errors, including
+	// the context being done, which is checked after each read.
+	// Default is 1 second.
+	Block time.Duration
+}
+
 type XReadArgs struct {
 	Streams []string // list of streams and ids, e.g. stream1 stream2 id1 id2
 	Count   int64
@@ -0,0 +1,417 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9/internal"
+)
+
+// StreamMessage is a message delivered to a StreamHandler.
+type StreamMessage struct {
+	XMessage
+	// Stream is the stream of the message.
+	Stream string
+	// Deliveries is the number of times the message was delivered to
+	// the group, including this one. It is 0 when the counter of a claimed
+	// message could not be read.
+	Deliveries int64
+}
+
+// StreamHandler handles a message read by a StreamConsumer.
+// The message is acknowledged when the handler returns nil.
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// StreamConsumerOptions are used to configure a StreamConsumer.
+type StreamConsumerOptions struct {
+	// Streams are the streams to read. In a cluster they must hash
+	// to the same slot.
+	Streams []string
+	// Group is the consumer group. It is created with the streams
+	// if it doesn't exist.
+	Group string
+	// Consumer is the name of the consumer in the group.
+	// Default is "<hostname>-<pid>".
+	Consumer string
+	// StartID is the ID the group is created at. Default is "$".
+	StartID string
+
+	// Concurrency is the number of messages handled at the same time.
+	// Default is 1.
+	Concurrency int
+	// BatchSize is the number of messages read at once. Default is 10.
+	BatchSize int64
+	// Block is how long XREADGROUP waits for new messages. Default is 1 second.
+	Block time.Duration
+
+	// ClaimInterval is how often messages of other consumers that stayed
+	// pending for ClaimMinIdle are claimed. Default is 30 seconds;
+	// -1 disables claiming.
+	ClaimInterval time.Duration
+	// ClaimMinIdle is the idle time after which a pending message is
+	// claimed and delivered again. Default is 1 minute.
+	ClaimMinIdle time.Duration
+
+	// MaxDeliveries is the number of deliveries after which a message
+	// that failed is moved to the dead-letter stream. Default is 0,
+	// which retries the messages forever.
+	MaxDeliveries int64
+	// DeadLetterStream returns the dead-letter stream of a stream.
+	// Dead letters keep the values of the message and add the fields
+	// "dlq_stream", "dlq_id", "dlq_deliveries" and "dlq_error".
+	// Default is "<stream>:dlq".
+	DeadLetterStream func(stream string) string
+
+	// OnError is called when a handler returns an error or panics and
+	// when a command of the consumer fails. The message is nil for the
+	// errors of reading and claiming.
+	OnError func(ctx context.Context, msg *StreamMessage, err error)
+}
+
+func (opt *StreamConsumerOptions) init() {
+	if opt.Consumer == "" {
+		host, _ := os.Hostname()
+		opt.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opt.StartID == "" {
+		opt.StartID = "$"
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = 1
+	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 10
+	}
+	if opt.Block <= 0 {
+		opt.Block = time.Second
+	}
+	switch opt.ClaimInterval {
+	case -1:
+		opt.ClaimInterval = 0
+	case 0:
+		opt.ClaimInterval = 30 * time.Second
+	}
+	if opt.ClaimMinIdle <= 0 {
+		opt.ClaimMinIdle = time.Minute
+	}
+	if opt.DeadLetterStream == nil {
+		opt.DeadLetterStream = func(stream string) string {
+			return stream + ":dlq"
+		}
+	}
+}
+
+// StreamConsumer reads the messages of a consumer group and calls the
+// handler for each of them. Messages are acknowledged when the handler
+// succeeds. Messages that stay pending, because a handler failed or a
+// consumer died, are claimed and delivered again until MaxDeliveries.
+type StreamConsumer struct {
+	client  Cmdable
+	opt     *StreamConsumerOptions
+	handler StreamHandler
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	closed bool
+}
+
+// NewStreamConsumer returns a consumer that calls the handler for the
+// messages of the streams.
+func NewStreamConsumer(client Cmdable, opt *StreamConsumerOptions, handler StreamHandler) *StreamConsumer {
+	opt.init()
+	return &StreamConsumer{
+		client:  client,
+		opt:     opt,
+		handler: handler,
+	}
+}
+
+// Run creates the group if needed and handles the messages until Shutdown
+// is called or the context is done. The context is passed to the handlers.
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if len(c.opt.Streams) == 0 || c.opt.Group == "" {
+		return errors.New("redis: StreamConsumer requires Streams and Group")
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if c.done != nil {
+		c.mu.Unlock()
+		return errors.New("redis: StreamConsumer is already running")
+	}
+	readCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.mu.Unlock()
+
+	defer func() {
+		cancel()
+		close(c.done)
+	}()
+
+	if err := c.createGroup(ctx); err != nil {
+		return err
+	}
+
+	msgs := make(chan *StreamMessage)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				c.handle(ctx, msg)
+			}
+		}()
+	}
+
+	c.fetch(readCtx, msgs)
+	close(msgs)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// Shutdown stops reading messages and waits for the handlers of the
+// messages already read, or until the context is done. Messages that
+// were read but not handled stay pending and are claimed later.
+func (c *StreamConsumer) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *StreamConsumer) createGroup(ctx context.Context) error {
+	for _, stream := range c.opt.Streams {
+		err := c.client.XGroupCreateMkStream(ctx, stream, c.opt.Group, c.opt.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch claims and reads messages until the context is done.
+func (c *StreamConsumer) fetch(ctx context.Context, msgs chan<- *StreamMessage) {
+	streams := make([]string, 0, 2*len(c.opt.Streams))
+	streams = append(streams, c.opt.Streams...)
+	for range c.opt.Streams {
+		streams = append(streams, ">")
+	}
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if c.opt.ClaimInterval > 0 && time.Since(lastClaim) >= c.opt.ClaimInterval {
+			lastClaim = time.Now()
+			for _, stream := range c.opt.Streams {
+				c.claim(ctx, stream, msgs)
+			}
+		}
+
+		res, err := c.client.XReadGroup(ctx, &XReadGroupArgs{
+			Group:    c.opt.Group,
+			Consumer: c.opt.Consumer,
+			Streams:  streams,
+			Count:    c.opt.BatchSize,
+			Block:    c.opt.Block,
+		}).Result()
+		if err != nil {
+			if err == Nil || ctx.Err() != nil {
+				continue
+			}
+			c.onError(ctx, nil, err)
+			_ = internal.Sleep(ctx, c.opt.Block)
+			continue
+		}
+
+		for _, stream := range res {
+			for _, msg := range stream.Messages {
+				if !sendStreamMessage(ctx, msgs, &StreamMessage{
+					XMessage:   msg,
+					Stream:     stream.Stream,
+					Deliveries: 1,
+				}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// claim delivers the messages of the stream that are pending for longer
+// than ClaimMinIdle and moves the messages delivered too many times to
+// the dead-letter stream.
+func (c *StreamConsumer) claim(ctx context.Context, stream string, msgs chan<- *StreamMessage) {
+	start := "0-0"
+	for {
+		claimed, next, err := c.client.XAutoClaim(ctx, &XAutoClaimArgs{
+			Stream:   stream,
+			Group:    c.opt.Group,
+			MinIdle:  c.opt.ClaimMinIdle,
+			Start:    start,
+			Count:    c.opt.BatchSize,
+			Consumer: c.opt.Consumer,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				c.onError(ctx, nil, err)
+			}
+			return
+		}
+
+		deliveries := c.deliveries(ctx, stream, claimed)
+		for _, msg := range claimed {
+			m := &StreamMessage{
+				XMessage:   msg,
+				Stream:     stream,
+				Deliveries: deliveries[msg.ID],
+			}
+			if c.opt.MaxDeliveries > 0 && m.Deliveries > c.opt.MaxDeliveries {
+				err := fmt.Errorf("redis: stream message %s was delivered %d times", m.ID, m.Deliveries)
+				if err := c.deadLetter(ctx, m, err); err != nil {
+					c.onError(ctx, m, err)
+				}
+				continue
+			}
+			if !sendStreamMessage(ctx, msgs, m) {
+				return
+			}
+		}
+
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// deliveries returns the delivery counters of the claimed messages.
+// The pending entries are read by ID, because other pending entries can
+// sit between the claimed messages. Messages without an entry are missing
+// from the map.
+func (c *StreamConsumer) deliveries(ctx context.Context, stream string, msgs []XMessage) map[string]int64 {
+	deliveries := make(map[string]int64, len(msgs))
+	if len(msgs) == 0 {
+		return deliveries
+	}
+
+	cmds := make([]*XPendingExtCmd, len(msgs))
+	_, err := c.client.Pipelined(ctx, func(pipe Pipeliner) error {
+		for i, msg := range msgs {
+			cmds[i] = pipe.XPendingExt(ctx, &XPendingExtArgs{
+				Stream: stream,
+				Group:  c.opt.Group,
+				Start:  msg.ID,
+				End:    msg.ID,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		c.onError(ctx, nil, err)
+	}
+	for _, cmd := range cmds {
+		for _, p := range cmd.Val() {
+			deliveries[p.ID] = p.RetryCount
+		}
+	}
+	return deliveries
+}
+
+// handle calls the handler and acknowledges the message, or moves it to
+// the dead-letter stream when it failed MaxDeliveries times. The message
+// is acknowledged even if the context was cancelled while it was handled.
+func (c *StreamConsumer) handle(ctx context.Context, msg *StreamMessage) {
+	err := c.call(ctx, msg)
+	ackCtx := streamAckContext{ctx}
+	if err == nil {
+		if err := c.client.XAck(ackCtx, msg.Stream, c.opt.Group, msg.ID).Err(); err != nil {
+			c.onError(ctx, msg, err)
+		}
+		return
+	}
+
+	c.onError(ctx, msg, err)
+	if c.opt.MaxDeliveries > 0 && msg.Deliveries >= c.opt.MaxDeliveries {
+		if err := c.deadLetter(ackCtx, msg, err); err != nil {
+			c.onError(ctx, msg, err)
+		}
+	}
+}
+
+// streamAckContext keeps the values of the context but is never done.
+type streamAckContext struct {
+	context.Context
+}
+
+func (streamAckContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (streamAckContext) Done() <-chan struct{}       { return nil }
+func (streamAckContext) Err() error                  { return nil }
+
+func (c *StreamConsumer) call(ctx context.Context, msg *StreamMessage) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("redis: stream handler for %s panicked: %v", msg.ID, v)
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+// deadLetter adds the message to the dead-letter stream and acknowledges it.
+func (c *StreamConsumer) deadLetter(ctx context.Context, msg *StreamMessage, reason error) error {
+	values := make(map[string]interface{}, len(msg.Values)+4)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["dlq_stream"] = msg.Stream
+	values["dlq_id"] = msg.ID
+	values["dlq_deliveries"] = msg.Deliveries
+	values["dlq_error"] = reason.Error()
+
+	err := c.client.XAdd(ctx, &XAddArgs{
+		Stream: c.opt.DeadLetterStream(msg.Stream),
+		Values: values,
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return c.client.XAck(ctx, msg.Stream, c.opt.Group, msg.ID).Err()
+}
+
+func (c *StreamConsumer) onError(ctx context.Context, msg *StreamMessage, err error) {
+	if c.opt.OnError != nil {
+		c.opt.OnError(ctx, msg, err)
+	}
+}
+
+func sendStreamMessage(ctx context.Context, msgs chan<- *StreamMessage, msg *StreamMessage) bool {
+	select {
+	case msgs <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,242 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ = Describe("StreamConsumer", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	run := func(consumer *redis.StreamConsumer) func() {
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Run(ctx)
+		}()
+		return func() {
+			Expect(consumer.Shutdown(ctx)).NotTo(HaveOccurred())
+			Expect(<-done).NotTo(HaveOccurred())
+		}
+	}
+
+	add := func(values ...interface{}) string {
+		id, err := client.XAdd(ctx, &redis.XAddArgs{
+			Stream: "mystream",
+			Values: values,
+		}).Result()
+		Expect(err).NotTo(HaveOccurred())
+		return id
+	}
+
+	pending := func() int64 {
+		res, err := client.XPending(ctx, "mystream", "mygroup").Result()
+		Expect(err).NotTo(HaveOccurred())
+		return res.Count
+	}
+
+	It("handles and acknowledges messages", func() {
+		var mu sync.Mutex
+		var payloads []string
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:     []string{"mystream"},
+			Group:       "mygroup",
+			StartID:     "0",
+			Concurrency: 4,
+			Block:       100 * time.Millisecond,
+		}, func(ctx context.Context, msg *redis.StreamMessage) error {
+			mu.Lock()
+			payloads = append(payloads, msg.Stream+":"+msg.Values["payload"].(string))
+			mu.Unlock()
+			return nil
+		})
+		stop := run(consumer)
+
+		add("payload", "1")
+		add("payload", "2")
+		add("payload", "3")
+
+		Eventually(func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), payloads...)
+		}).Should(ConsistOf("mystream:1", "mystream:2", "mystream:3"))
+		Eventually(pending).Should(BeZero())
+
+		stop()
+	})
+
+	It("retries failed messages and moves poison messages to the dead-letter stream", func() {
+		var mu sync.Mutex
+		deliveries := make(map[string][]int64)
+		var errs []error
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:       []string{"mystream"},
+			Group:         "mygroup",
+			StartID:       "0",
+			Block:         50 * time.Millisecond,
+			ClaimInterval: 50 * time.Millisecond,
+			ClaimMinIdle:  10 * time.Millisecond,
+			MaxDeliveries: 3,
+			OnError: func(ctx context.Context, msg *redis.StreamMessage, err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			},
+		}, func(ctx context.Context, msg *redis.StreamMessage) error {
+			mu.Lock()
+			payload := msg.Values["payload"].(string)
+			deliveries[payload] = append(deliveries[payload], msg.Deliveries)
+			mu.Unlock()
+
+			switch payload {
+			case "flaky":
+				if msg.Deliveries < 2 {
+					return errors.New("flaky")
+				}
+				return nil
+			case "poison":
+				panic("poison")
+			}
+			return nil
+		})
+		stop := run(consumer)
+
+		add("payload", "flaky")
+		poisonID := add("payload", "poison")
+
+		Eventually(func() int64 {
+			n, err := client.XLen(ctx, "mystream:dlq").Result()
+			Expect(err).NotTo(HaveOccurred())
+			return n
+		}, 5*time.Second).Should(Equal(int64(1)))
+		Eventually(pending).Should(BeZero())
+		stop()
+
+		Expect(deliveries["flaky"]).To(Equal([]int64{1, 2}))
+		Expect(deliveries["poison"]).To(Equal([]int64{1, 2, 3}))
+		Expect(errs).To(HaveLen(4))
+
+		dead, err := client.XRange(ctx, "mystream:dlq", "-", "+").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dead[0].Values).To(HaveKeyWithValue("payload", "poison"))
+		Expect(dead[0].Values).To(HaveKeyWithValue("dlq_stream", "mystream"))
+		Expect(dead[0].Values).To(HaveKeyWithValue("dlq_id", poisonID))
+		Expect(dead[0].Values).To(HaveKeyWithValue("dlq_deliveries", "3"))
+		Expect(dead[0].Values).To(HaveKey("dlq_error"))
+	})
+
+	It("reads the delivery counters of the claimed messages", func() {
+		Expect(client.XGroupCreateMkStream(ctx, "mystream", "mygroup", "0").Err()).NotTo(HaveOccurred())
+		first := add("payload", "1")
+		second := add("payload", "2")
+		third := add("payload", "3")
+
+		// All messages are pending for the consumer, and the second one is
+		// claimed again so it is not idle.
+		err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "mygroup",
+			Consumer: "me",
+			Streams:  []string{"mystream", ">"},
+		}).Err()
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(300 * time.Millisecond)
+		err = client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   "mystream",
+			Group:    "mygroup",
+			Consumer: "me",
+			Messages: []string{second},
+		}).Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		var mu sync.Mutex
+		deliveries := make(map[string]int64)
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams:       []string{"mystream"},
+			Group:         "mygroup",
+			Consumer:      "me",
+			Block:         50 * time.Millisecond,
+			ClaimInterval: time.Hour,
+			ClaimMinIdle:  200 * time.Millisecond,
+		}, func(ctx context.Context, msg *redis.StreamMessage) error {
+			mu.Lock()
+			deliveries[msg.ID] = msg.Deliveries
+			mu.Unlock()
+			return nil
+		})
+		stop := run(consumer)
+
+		Eventually(pending).Should(Equal(int64(1)))
+		stop()
+
+		Expect(deliveries).To(Equal(map[string]int64{first: 2, third: 2}))
+	})
+
+	It("acknowledges handled messages after the context is cancelled", func() {
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams: []string{"mystream"},
+			Group:   "mygroup",
+			StartID: "0",
+			Block:   50 * time.Millisecond,
+		}, func(ctx context.Context, msg *redis.StreamMessage) error {
+			cancel()
+			<-ctx.Done()
+			return nil
+		})
+		add("payload", "1")
+
+		Expect(consumer.Run(runCtx)).To(Equal(context.Canceled))
+		Expect(pending()).To(BeZero())
+	})
+
+	It("drains in-flight messages on Shutdown", func() {
+		started := make(chan struct{})
+		var handled bool
+
+		consumer := redis.NewStreamConsumer(client, &redis.StreamConsumerOptions{
+			Streams: []string{"mystream"},
+			Group:   "mygroup",
+			StartID: "0",
+			Block:   time.Second,
+		}, func(ctx context.Context, msg *redis.StreamMessage) error {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			handled = true
+			return nil
+		})
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Run(ctx)
+		}()
+
+		add("payload", "1")
+		Eventually(started).Should(BeClosed())
+
+		Expect(consumer.Shutdown(ctx)).NotTo(HaveOccurred())
+		Expect(handled).To(BeTrue())
+		Expect(<-done).NotTo(HaveOccurred())
+		Expect(pending()).To(BeZero())
+
+		Expect(consumer.Run(ctx)).To(Equal(redis.ErrClosed))
+	})
+})
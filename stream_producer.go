@@ -0,0 +1,246 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrStreamProducerFull is returned by StreamProducer.Add when the buffer
+// is full and StreamProducerOptions.DropWhenFull is set.
+var ErrStreamProducerFull = errors.New("redis: stream producer buffer is full")
+
+// StreamProducerOptions are used to configure a StreamProducer.
+type StreamProducerOptions struct {
+	// BatchSize is the number of buffered entries that triggers a flush.
+	// Default is 100.
+	BatchSize int
+	// FlushInterval is how often the buffered entries are flushed.
+	// Default is 100 milliseconds.
+	FlushInterval time.Duration
+	// BufferSize is the maximum number of entries waiting for a flush.
+	// Default is 10000.
+	BufferSize int
+	// DropWhenFull makes Add fail with ErrStreamProducerFull instead of
+	// blocking when the buffer is full.
+	DropWhenFull bool
+
+	// MaxLen trims the streams with MAXLEN ~ on every XADD.
+	// It overrides the trimming of the XAddArgs.
+	MaxLen int64
+	// MaxAge trims the streams with MINID ~ of the current time minus
+	// MaxAge on every XADD. It overrides the trimming of the XAddArgs
+	// and is ignored when MaxLen is set.
+	MaxAge time.Duration
+
+	// OnResult is called with the ID or the error of each entry after
+	// it is flushed.
+	OnResult func(a *XAddArgs, id string, err error)
+}
+
+func (opt *StreamProducerOptions) init() {
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = 100
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = 100 * time.Millisecond
+	}
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = 10000
+	}
+}
+
+// StreamProducer buffers XADD commands and sends them in pipelines,
+// so adding an entry doesn't cost a round trip.
+type StreamProducer struct {
+	client Cmdable
+	opt    *StreamProducerOptions
+
+	// slots limits the number of buffered entries.
+	slots chan struct{}
+	flush chan struct{}
+	exit  chan struct{}
+	done  chan struct{}
+
+	// flushMu serializes the flushes, so the entries are added in order.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	entries []*StreamProducerResult
+	closed  bool
+}
+
+// StreamProducerResult is the result of an entry added to a StreamProducer.
+type StreamProducerResult struct {
+	args *XAddArgs
+	cmd  *StringCmd
+	done chan struct{}
+}
+
+// Done returns a channel that is closed when the entry is flushed.
+func (r *StreamProducerResult) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the entry to be flushed and returns its ID.
+func (r *StreamProducerResult) Wait(ctx context.Context) (string, error) {
+	select {
+	case <-r.done:
+		return r.cmd.Result()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// NewStreamProducer returns a producer that adds entries with the client.
+func NewStreamProducer(client Cmdable, opt *StreamProducerOptions) *StreamProducer {
+	if opt == nil {
+		opt = &StreamProducerOptions{}
+	}
+	opt.init()
+
+	p := &StreamProducer{
+		client: client,
+		opt:    opt,
+		slots:  make(chan struct{}, opt.BufferSize),
+		flush:  make(chan struct{}, 1),
+		exit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Add buffers the entry. It blocks while the buffer is full, unless
+// DropWhenFull is set.
+func (p *StreamProducer) Add(ctx context.Context, a *XAddArgs) (*StreamProducerResult, error) {
+	if p.opt.DropWhenFull {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			return nil, ErrStreamProducerFull
+		}
+	} else {
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.exit:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	res := &StreamProducerResult{
+		args: a,
+		done: make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrClosed
+	}
+	p.entries = append(p.entries, res)
+	full := len(p.entries) >= p.opt.BatchSize
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+	return res, nil
+}
+
+func (p *StreamProducer) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.opt.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flush:
+		case <-p.exit:
+			_ = p.Flush(context.Background())
+			return
+		}
+		_ = p.Flush(context.Background())
+	}
+}
+
+// Flush sends the buffered entries in a pipeline and returns the first error.
+// It waits for the running flush, if any.
+func (p *StreamProducer) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	entries := p.entries
+	p.entries = nil
+	p.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var minID string
+	if p.opt.MaxLen <= 0 && p.opt.MaxAge > 0 {
+		minID = strconv.FormatInt(time.Now().Add(-p.opt.MaxAge).UnixMilli(), 10)
+	}
+
+	_, _ = p.client.Pipelined(ctx, func(pipe Pipeliner) error {
+		for _, res := range entries {
+			res.cmd = pipe.XAdd(ctx, p.trim(res.args, minID))
+		}
+		return nil
+	})
+
+	var firstErr error
+	for _, res := range entries {
+		id, err := res.cmd.Result()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		close(res.done)
+		<-p.slots
+
+		if p.opt.OnResult != nil {
+			p.opt.OnResult(res.args, id, err)
+		}
+	}
+	return firstErr
+}
+
+// trim returns the arguments with the trimming of the options.
+func (p *StreamProducer) trim(a *XAddArgs, minID string) *XAddArgs {
+	if p.opt.MaxLen <= 0 && minID == "" {
+		return a
+	}
+
+	trimmed := *a
+	trimmed.MaxLen = p.opt.MaxLen
+	trimmed.MinID = minID
+	trimmed.Approx = true
+	return &trimmed
+}
+
+// Close flushes the buffered entries and stops the producer.
+func (p *StreamProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.exit)
+	<-p.done
+	return nil
+}
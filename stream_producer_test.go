@@ -0,0 +1,183 @@
+package redis_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ = Describe("StreamProducer", func() {
+	var client *redis.Client
+
+	BeforeEach(func() {
+		client = redis.NewClient(redisOptions())
+		Expect(client.FlushDB(ctx).Err()).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).NotTo(HaveOccurred())
+	})
+
+	It("flushes entries by size and reports their IDs", func() {
+		var mu sync.Mutex
+		var ids []string
+
+		producer := redis.NewStreamProducer(client, &redis.StreamProducerOptions{
+			BatchSize:     3,
+			FlushInterval: time.Hour,
+			OnResult: func(a *redis.XAddArgs, id string, err error) {
+				Expect(err).NotTo(HaveOccurred())
+				mu.Lock()
+				ids = append(ids, id)
+				mu.Unlock()
+			},
+		})
+		defer producer.Close()
+
+		var results []*redis.StreamProducerResult
+		for i := 0; i < 3; i++ {
+			stream := "stream1"
+			if i == 1 {
+				stream = "stream2"
+			}
+			res, err := producer.Add(ctx, &redis.XAddArgs{
+				Stream: stream,
+				Values: []string{"n", "1"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			results = append(results, res)
+		}
+
+		for _, res := range results {
+			id, err := res.Wait(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).NotTo(BeEmpty())
+		}
+		Expect(client.XLen(ctx, "stream1").Val()).To(Equal(int64(2)))
+		Expect(client.XLen(ctx, "stream2").Val()).To(Equal(int64(1)))
+
+		mu.Lock()
+		Expect(ids).To(HaveLen(3))
+		mu.Unlock()
+	})
+
+	It("keeps the order of the entries with concurrent flushes", func() {
+		producer := redis.NewStreamProducer(client, &redis.StreamProducerOptions{
+			BatchSize:     5,
+			FlushInterval: time.Millisecond,
+		})
+		defer producer.Close()
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						_ = producer.Flush(ctx)
+					}
+				}
+			}()
+		}
+
+		var results []*redis.StreamProducerResult
+		for i := 0; i < 200; i++ {
+			res, err := producer.Add(ctx, &redis.XAddArgs{
+				Stream: "stream",
+				Values: []string{"n", strconv.Itoa(i)},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			results = append(results, res)
+		}
+		close(stop)
+		wg.Wait()
+
+		for _, res := range results {
+			_, err := res.Wait(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		msgs, err := client.XRange(ctx, "stream", "-", "+").Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msgs).To(HaveLen(200))
+		for i, msg := range msgs {
+			Expect(msg.Values["n"]).To(Equal(strconv.Itoa(i)))
+		}
+	})
+
+	It("flushes entries by interval and trims the streams", func() {
+		producer := redis.NewStreamProducer(client, &redis.StreamProducerOptions{
+			FlushInterval: 10 * time.Millisecond,
+			MaxLen:        1,
+		})
+		defer producer.Close()
+
+		res, err := producer.Add(ctx, &redis.XAddArgs{
+			Stream: "stream",
+			ID:     "1-0",
+			Values: []string{"n", "1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Wait(ctx)).To(Equal("1-0"))
+	})
+
+	It("reports errors", func() {
+		producer := redis.NewStreamProducer(client, nil)
+		defer producer.Close()
+
+		Expect(client.Set(ctx, "key", "value", 0).Err()).NotTo(HaveOccurred())
+		res, err := producer.Add(ctx, &redis.XAddArgs{
+			Stream: "key",
+			Values: []string{"n", "1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = res.Wait(ctx)
+		Expect(err).To(MatchError(ContainSubstring("WRONGTYPE")))
+	})
+
+	It("drops or blocks when the buffer is full", func() {
+		producer := redis.NewStreamProducer(client, &redis.StreamProducerOptions{
+			BatchSize:     10,
+			BufferSize:    1,
+			FlushInterval: time.Hour,
+			DropWhenFull:  true,
+		})
+
+		args := &redis.XAddArgs{Stream: "stream", Values: []string{"n", "1"}}
+		_, err := producer.Add(ctx, args)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = producer.Add(ctx, args)
+		Expect(err).To(Equal(redis.ErrStreamProducerFull))
+		Expect(producer.Close()).NotTo(HaveOccurred())
+
+		producer = redis.NewStreamProducer(client, &redis.StreamProducerOptions{
+			BatchSize:     10,
+			BufferSize:    1,
+			FlushInterval: time.Hour,
+		})
+		defer producer.Close()
+
+		_, err = producer.Add(ctx, args)
+		Expect(err).NotTo(HaveOccurred())
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = producer.Add(timeoutCtx, args)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		Expect(producer.Flush(ctx)).NotTo(HaveOccurred())
+		Expect(client.XLen(ctx, "stream").Val()).To(Equal(int64(2)))
+	})
+})
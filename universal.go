@@ -54,18 +54,26 @@ type UniversalOptions struct {
 
 	TLSConfig *tls.Config
 
+	// Only cluster and failover clients.
+
+	AddressMapper func(addr string) string
+
 	// Only cluster clients.
 
 	MaxRedirects   int
 	ReadOnly       bool
 	RouteByLatency bool
 	RouteRandomly  bool
+	ReadRouter     ReadRouter
+	NodeZone       func(addr string) string
 
 	// The sentinel master name.
 	// Only failover clients.
 
 	MasterName string
 
+	OnSentinelEvent func(ctx context.Context, event *SentinelEvent)
+
 	DisableIndentity bool
 	IdentitySuffix   string
 }
@@ -90,6 +98,9 @@ func (o *UniversalOptions) Cluster() *ClusterOptions {
 		ReadOnly:       o.ReadOnly,
 		RouteByLatency: o.RouteByLatency,
 		RouteRandomly:  o.RouteRandomly,
+		ReadRouter:     o.ReadRouter,
+		NodeZone:       o.NodeZone,
+		AddressMapper:  o.AddressMapper,
 
 		MaxRetries:      o.MaxRetries,
 		MinRetryBackoff: o.MinRetryBackoff,
@@ -138,6 +149,9 @@ func (o *UniversalOptions) Failover() *FailoverOptions {
 		SentinelUsername: o.SentinelUsername,
 		SentinelPassword: o.SentinelPassword,
 
+		AddressMapper:   o.AddressMapper,
+		OnSentinelEvent: o.OnSentinelEvent,
+
 		MaxRetries:      o.MaxRetries,
 		MinRetryBackoff: o.MinRetryBackoff,
 		MaxRetryBackoff: o.MaxRetryBackoff,